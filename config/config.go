@@ -3,14 +3,35 @@ package config
 import (
 	"fmt"
 	"github.com/joho/godotenv"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+const defaultStorageQuotaBytes = 1 << 30
+
 type Config struct {
 	DBUser, DBPassword, DBName, DBHost                          string
 	ZohoUser, ZohoPassword, ZohoHost, ZohoServiceName, ZohoPort string
+	EmailTransport, EmailFrom, EmailFromName                    string
+	SendGridAPIKey, EmailOutboxDir                              string
+	DKIMDomain, DKIMSelector, DKIMPrivateKeyPath                string
 	JwtSecret                                                   string
-	IPFSAPIKey, IPFSAPISecret                                   string
+	TOTPIssuer                                                  string
+	IPFSAPIKey, IPFSAPISecret, IPFSGatewayURL                   string
+	PublicBaseURL, ExportDir                                    string
+	StorageQuotaBytes                                           int64
+	BlocklistFile                                               string
+	OIDCProviderName, OIDCIssuerURL, OIDCRedirectURL            string
+	OIDCClientID, OIDCClientSecret                              string
+	OIDCScopes                                                  []string
+	LogFormat, LogLevel                                         string
+	TracingEndpoint, TracingServiceName                         string
+	TracingSampleRatio                                          float64
+	TrustedProxies                                              []netip.Prefix
+	MetricsAddr                                                 string
 }
 
 func LoadConfig() (*Config, error) {
@@ -32,12 +53,53 @@ func LoadConfig() (*Config, error) {
 	ZohoHost := os.Getenv("EMAIL_SMTP_HOST")
 	ZohoPort := os.Getenv("EMAIL_SMTP_PORT")
 
-	if ZohoUser == "" || ZohoPassword == "" || ZohoHost == "" || ZohoPort == "" {
-		return nil, fmt.Errorf("missing one or more required Email SMTP env vars")
+	EmailTransport := strings.ToLower(os.Getenv("EMAIL_TRANSPORT"))
+	if EmailTransport == "" {
+		EmailTransport = "smtp"
+	}
+	EmailFrom := os.Getenv("FROM_EMAIL")
+	if EmailFrom == "" {
+		EmailFrom = ZohoUser
+	}
+	EmailFromName := os.Getenv("FROM_NAME")
+	SendGridAPIKey := os.Getenv("SENDGRID_API_KEY")
+	EmailOutboxDir := os.Getenv("EMAIL_OUTBOX_DIR")
+	if EmailOutboxDir == "" {
+		EmailOutboxDir = filepath.Join(os.TempDir(), "arkive-outbox")
+	}
+
+	DKIMDomain := os.Getenv("DKIM_DOMAIN")
+	DKIMSelector := os.Getenv("DKIM_SELECTOR")
+	DKIMPrivateKeyPath := os.Getenv("DKIM_PRIVATE_KEY_PATH")
+	if (DKIMDomain != "" || DKIMSelector != "" || DKIMPrivateKeyPath != "") &&
+		(DKIMDomain == "" || DKIMSelector == "" || DKIMPrivateKeyPath == "") {
+		return nil, fmt.Errorf("missing one or more required DKIM env vars")
+	}
+
+	switch EmailTransport {
+	case "smtp":
+		if ZohoUser == "" || ZohoPassword == "" || ZohoHost == "" || ZohoPort == "" {
+			return nil, fmt.Errorf("missing one or more required Email SMTP env vars")
+		}
+	case "sendgrid":
+		if SendGridAPIKey == "" || EmailFrom == "" {
+			return nil, fmt.Errorf("missing one or more required SendGrid env vars")
+		}
+	case "memory", "file":
+	default:
+		return nil, fmt.Errorf("invalid EMAIL_TRANSPORT: %q", EmailTransport)
+	}
+	if EmailFrom == "" {
+		EmailFrom = "no-reply@localhost"
 	}
 
 	JwtSecret := os.Getenv("JWT_SECRET")
 
+	TOTPIssuer := os.Getenv("TOTP_ISSUER")
+	if TOTPIssuer == "" {
+		TOTPIssuer = "Arkive"
+	}
+
 	IPFSAPIKey := os.Getenv("IPFS_API_KEY")
 	IPFSAPISecret := os.Getenv("IPFS_API_SECRET")
 
@@ -45,6 +107,83 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("missing one or more required IPFS env vars")
 	}
 
+	IPFSGatewayURL := os.Getenv("IPFS_GATEWAY_URL")
+
+	PublicBaseURL := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if PublicBaseURL == "" {
+		PublicBaseURL = "http://localhost:8080"
+	}
+
+	ExportDir := os.Getenv("EXPORT_DIR")
+	if ExportDir == "" {
+		ExportDir = filepath.Join(os.TempDir(), "arkive-exports")
+	}
+
+	StorageQuotaBytes := int64(defaultStorageQuotaBytes)
+	if rawQuota := os.Getenv("STORAGE_QUOTA_BYTES"); rawQuota != "" {
+		parsedQuota, parseErr := strconv.ParseInt(rawQuota, 10, 64)
+		if parseErr != nil || parsedQuota < 0 {
+			return nil, fmt.Errorf("invalid STORAGE_QUOTA_BYTES: %q", rawQuota)
+		}
+		StorageQuotaBytes = parsedQuota
+	}
+
+	BlocklistFile := os.Getenv("BLOCKLIST_FILE")
+
+	OIDCIssuerURL := os.Getenv("OIDC_ISSUER_URL")
+	OIDCClientID := os.Getenv("OIDC_CLIENT_ID")
+	OIDCClientSecret := os.Getenv("OIDC_CLIENT_SECRET")
+	OIDCRedirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	OIDCProviderName := os.Getenv("OIDC_PROVIDER_NAME")
+	if OIDCProviderName == "" {
+		OIDCProviderName = "oidc"
+	}
+	OIDCScopes := strings.Fields(strings.ReplaceAll(os.Getenv("OIDC_SCOPES"), ",", " "))
+
+	if OIDCIssuerURL != "" && (OIDCClientID == "" || OIDCRedirectURL == "") {
+		return nil, fmt.Errorf("missing one or more required OIDC env vars")
+	}
+
+	LogFormat := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	if LogFormat == "" {
+		LogFormat = "text"
+	}
+	if LogFormat != "text" && LogFormat != "json" {
+		return nil, fmt.Errorf("invalid LOG_FORMAT: %q", LogFormat)
+	}
+	LogLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
+	if LogLevel == "" {
+		LogLevel = "info"
+	}
+
+	TracingEndpoint := os.Getenv("TRACING_ENDPOINT")
+	TracingServiceName := os.Getenv("TRACING_SERVICE_NAME")
+	if TracingServiceName == "" {
+		TracingServiceName = "arkive"
+	}
+	TracingSampleRatio := 1.0
+	if rawRatio := os.Getenv("TRACING_SAMPLE_RATIO"); rawRatio != "" {
+		parsedRatio, parseErr := strconv.ParseFloat(rawRatio, 64)
+		if parseErr != nil || parsedRatio < 0 || parsedRatio > 1 {
+			return nil, fmt.Errorf("invalid TRACING_SAMPLE_RATIO: %q", rawRatio)
+		}
+		TracingSampleRatio = parsedRatio
+	}
+
+	MetricsAddr := os.Getenv("METRICS_ADDR")
+	if MetricsAddr == "" {
+		MetricsAddr = ":9090"
+	}
+
+	var TrustedProxies []netip.Prefix
+	for _, rawProxy := range strings.Fields(strings.ReplaceAll(os.Getenv("TRUSTED_PROXIES"), ",", " ")) {
+		proxy, parseErr := parseProxy(rawProxy)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry: %q", rawProxy)
+		}
+		TrustedProxies = append(TrustedProxies, proxy)
+	}
+
 	cfg := &Config{
 		DBUser:     DBUser,
 		DBPassword: DBPassword,
@@ -56,11 +195,60 @@ func LoadConfig() (*Config, error) {
 		ZohoHost:     ZohoHost,
 		ZohoPort:     ZohoPort,
 
-		JwtSecret: JwtSecret,
+		EmailTransport: EmailTransport,
+		EmailFrom:      EmailFrom,
+		EmailFromName:  EmailFromName,
+		SendGridAPIKey: SendGridAPIKey,
+		EmailOutboxDir: EmailOutboxDir,
+
+		DKIMDomain:         DKIMDomain,
+		DKIMSelector:       DKIMSelector,
+		DKIMPrivateKeyPath: DKIMPrivateKeyPath,
+
+		JwtSecret:  JwtSecret,
+		TOTPIssuer: TOTPIssuer,
 
 		IPFSAPIKey:    IPFSAPIKey,
 		IPFSAPISecret: IPFSAPISecret,
+
+		IPFSGatewayURL: IPFSGatewayURL,
+		PublicBaseURL:  PublicBaseURL,
+		ExportDir:      ExportDir,
+
+		StorageQuotaBytes: StorageQuotaBytes,
+		BlocklistFile:     BlocklistFile,
+
+		OIDCProviderName: OIDCProviderName,
+		OIDCIssuerURL:    OIDCIssuerURL,
+		OIDCRedirectURL:  OIDCRedirectURL,
+		OIDCClientID:     OIDCClientID,
+		OIDCClientSecret: OIDCClientSecret,
+		OIDCScopes:       OIDCScopes,
+
+		LogFormat: LogFormat,
+		LogLevel:  LogLevel,
+
+		TracingEndpoint:    TracingEndpoint,
+		TracingServiceName: TracingServiceName,
+		TracingSampleRatio: TracingSampleRatio,
+
+		TrustedProxies: TrustedProxies,
+		MetricsAddr:    MetricsAddr,
 	}
 
 	return cfg, nil
 }
+
+// parseProxy accepts a CIDR range or a single address.
+func parseProxy(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, parseErr := netip.ParsePrefix(value)
+		return prefix.Masked(), parseErr
+	}
+	addr, parseErr := netip.ParseAddr(value)
+	if parseErr != nil {
+		return netip.Prefix{}, parseErr
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+	"time"
+)
+
+type AccountHandler struct {
+	AccountDeletionService *service.AccountDeletionService
+	DataExportService      *service.DataExportService
+	ProfileService         *service.ProfileService
+}
+
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Website     *string `json:"website"`
+	Username    *string `json:"username"`
+	Locale      *string `json:"locale"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Code string `json:"code"`
+}
+
+type AccountProfileResponse struct {
+	ID              uuid.UUID `json:"id"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	DisplayName     string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	Website         string    `json:"website"`
+	ProfileImageCID string    `json:"profile_image_cid"`
+	Locale          string    `json:"locale"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type DataExportResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func NewAccountHandler(accountDeletionService *service.AccountDeletionService, dataExportService *service.DataExportService, profileService *service.ProfileService) *AccountHandler {
+	return &AccountHandler{
+		AccountDeletionService: accountDeletionService,
+		DataExportService:      dataExportService,
+		ProfileService:         profileService,
+	}
+}
+
+func newAccountProfileResponse(user *users.User) AccountProfileResponse {
+	return AccountProfileResponse{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		Website:         user.Website,
+		ProfileImageCID: user.ProfileImageCID,
+		Locale:          user.Locale,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+func (ah *AccountHandler) UpdateProfile(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := UpdateProfileRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	user, updateErr := ah.ProfileService.UpdateProfile(ctx, userID, service.ProfileUpdate{
+		DisplayName: reqBody.DisplayName,
+		Bio:         reqBody.Bio,
+		Website:     reqBody.Website,
+		Username:    reqBody.Username,
+		Locale:      reqBody.Locale,
+	})
+	if updateErr != nil {
+		writeServiceErr(writer, request, "update profile", updateErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Profile Updated!",
+		Data:   newAccountProfileResponse(user),
+	})
+}
+
+func (ah *AccountHandler) ChangeEmail(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := ChangeEmailRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil || reqBody.Email == "" {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	issuedAt, _ := ctx.Value(middleware.ContextKeyIssuedAt).(time.Time)
+
+	if changeErr := ah.ProfileService.RequestEmailChange(ctx, userID, reqBody.Email, reqBody.Password, issuedAt); changeErr != nil {
+		writeServiceErr(writer, request, "request email change", changeErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Confirmation Code Sent To The New Address!",
+	})
+}
+
+func (ah *AccountHandler) ConfirmEmailChange(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := ConfirmEmailChangeRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil || reqBody.Code == "" {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	user, confirmErr := ah.ProfileService.ConfirmEmailChange(ctx, userID, reqBody.Code)
+	if confirmErr != nil {
+		writeServiceErr(writer, request, "confirm email change", confirmErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Email Changed!",
+		Data:   newAccountProfileResponse(user),
+	})
+}
+
+func (ah *AccountHandler) DeleteAccount(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := DeleteAccountRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	issuedAt, _ := ctx.Value(middleware.ContextKeyIssuedAt).(time.Time)
+
+	if deleteErr := ah.AccountDeletionService.RequestDeletion(ctx, userID, reqBody.Password, reqBody.Code, issuedAt); deleteErr != nil {
+		writeServiceErr(writer, request, "request account deletion", deleteErr)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusAccepted)
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusAccepted,
+		Status: "Accepted",
+		Data:   "Account Scheduled For Deletion!",
+	})
+}
+
+func (ah *AccountHandler) RequestExport(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	export, exportErr := ah.DataExportService.RequestExport(ctx, userID)
+	if exportErr != nil {
+		writeServiceErr(writer, request, "request data export", exportErr)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusAccepted)
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusAccepted,
+		Status: "Export Started! A download link will be emailed when it is ready.",
+		Data: DataExportResponse{
+			ID:        export.ID,
+			Status:    export.Status,
+			CreatedAt: export.CreatedAt,
+		},
+	})
+}
+
+// DownloadExport is reached through the link in the export email, so it is
+// authorized by the signed token in the query string rather than a bearer token.
+func (ah *AccountHandler) DownloadExport(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	exportID, parseErr := uuid.Parse(params.ByName("exportId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	export, file, openErr := ah.DataExportService.OpenExport(request.Context(), exportID, request.URL.Query().Get("token"))
+	if openErr != nil {
+		writeServiceErr(writer, request, "download data export", openErr)
+		return
+	}
+	defer file.Close()
+
+	writer.Header().Set("Content-Type", "application/zip")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "arkive-export-"+export.ID.String()+".zip"))
+	http.ServeContent(writer, request, "", *export.CompletedAt, file)
+}
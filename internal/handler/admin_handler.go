@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+	"time"
+)
+
+type AdminHandler struct {
+	AdminService *service.AdminService
+}
+
+type AdminUserResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	IsVerified  bool       `json:"is_verified"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type SetStorageQuotaRequest struct {
+	QuotaBytes *int64 `json:"quota_bytes"`
+}
+
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{AdminService: adminService}
+}
+
+func (ah *AdminHandler) ListUsers(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	limit, offset := helper.ParsePagination(request)
+
+	userList, listErr := ah.AdminService.ListUsers(request.Context(), limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list users", listErr)
+		return
+	}
+
+	response := make([]AdminUserResponse, 0, len(userList))
+	for _, user := range userList {
+		response = append(response, AdminUserResponse{
+			ID:          user.ID,
+			Username:    user.Username,
+			Email:       user.Email,
+			Role:        user.Role,
+			IsVerified:  user.IsVerified,
+			SuspendedAt: user.SuspendedAt,
+			CreatedAt:   user.CreatedAt,
+		})
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (ah *AdminHandler) SuspendUser(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ah.setSuspended(writer, request, params, true)
+}
+
+func (ah *AdminHandler) UnsuspendUser(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ah.setSuspended(writer, request, params, false)
+}
+
+func (ah *AdminHandler) setSuspended(writer http.ResponseWriter, request *http.Request, params httprouter.Params, suspended bool) {
+	ctx := request.Context()
+	adminID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	userID, parseErr := uuid.Parse(params.ByName("userId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if updateErr := ah.AdminService.SetSuspended(ctx, adminID, userID, suspended); updateErr != nil {
+		writeServiceErr(writer, request, "update suspension", updateErr)
+		return
+	}
+
+	message := "User Suspended!"
+	if !suspended {
+		message = "User Unsuspended!"
+	}
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   message,
+	})
+}
+
+func (ah *AdminHandler) SetRole(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	adminID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	userID, parseErr := uuid.Parse(params.ByName("userId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	reqBody := SetRoleRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if updateErr := ah.AdminService.SetRole(ctx, adminID, userID, reqBody.Role); updateErr != nil {
+		writeServiceErr(writer, request, "update role", updateErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Role Updated!",
+	})
+}
+
+func (ah *AdminHandler) SetStorageQuota(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	userID, parseErr := uuid.Parse(params.ByName("userId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	reqBody := SetStorageQuotaRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if updateErr := ah.AdminService.SetStorageQuota(request.Context(), userID, reqBody.QuotaBytes); updateErr != nil {
+		writeServiceErr(writer, request, "update storage quota", updateErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Storage Quota Updated!",
+	})
+}
+
+func (ah *AdminHandler) ForceDeletePhoto(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	adminID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if deleteErr := ah.AdminService.ForceDeletePhoto(ctx, adminID, photoID); deleteErr != nil {
+		writeServiceErr(writer, request, "force delete photo", deleteErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Photo Deleted Successfully!",
+	})
+}
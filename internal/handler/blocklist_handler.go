@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/service"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxBlocklistImportBytes = 5 << 20
+
+type BlocklistHandler struct {
+	BlocklistService *service.BlocklistService
+}
+
+type AddBlockedHashRequest struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+	Note  string `json:"note"`
+}
+
+type BlockedHashResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	Note      string     `json:"note"`
+	AddedBy   *uuid.UUID `json:"added_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type BlockedUploadResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	BlockedHashID  *uuid.UUID `json:"blocked_hash_id"`
+	SHA256         string     `json:"sha256"`
+	PerceptualHash string     `json:"phash"`
+	Filename       string     `json:"filename"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type BlocklistImportResponse struct {
+	Added   int `json:"added"`
+	Skipped int `json:"skipped"`
+}
+
+func NewBlocklistHandler(blocklistService *service.BlocklistService) *BlocklistHandler {
+	return &BlocklistHandler{BlocklistService: blocklistService}
+}
+
+func (bh *BlocklistHandler) ListBlockedHashes(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	limit, offset := helper.ParsePagination(request)
+
+	hashes, listErr := bh.BlocklistService.List(request.Context(), limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list blocked hashes", listErr)
+		return
+	}
+
+	response := make([]BlockedHashResponse, 0, len(hashes))
+	for _, hash := range hashes {
+		response = append(response, BlockedHashResponse{
+			ID:        hash.ID,
+			Kind:      hash.Kind,
+			Value:     hash.Value,
+			Note:      hash.Note,
+			AddedBy:   hash.AddedBy,
+			CreatedAt: hash.CreatedAt,
+		})
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (bh *BlocklistHandler) AddBlockedHash(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	moderatorID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := AddBlockedHashRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	added, addErr := bh.BlocklistService.Add(ctx, moderatorID, reqBody.Kind, reqBody.Value, reqBody.Note)
+	if addErr != nil {
+		writeServiceErr(writer, request, "add blocked hash", addErr)
+		return
+	}
+
+	message := "Hash Blocked!"
+	if !added {
+		message = "Hash Already Blocked!"
+	}
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   message,
+	})
+}
+
+// ImportBlocklist accepts a hash list either as a multipart "file" field or as
+// the raw request body.
+func (bh *BlocklistHandler) ImportBlocklist(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	moderatorID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(writer, request.Body, maxBlocklistImportBytes)
+	var source io.Reader = request.Body
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, fileErr := request.FormFile("file")
+		if fileErr != nil {
+			helper.WriteErr(writer, helper.ErrInvalidInput)
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	added, skipped, importErr := bh.BlocklistService.Import(ctx, &moderatorID, source)
+	if importErr != nil {
+		writeServiceErr(writer, request, "import blocklist", importErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   BlocklistImportResponse{Added: added, Skipped: skipped},
+	})
+}
+
+func (bh *BlocklistHandler) RemoveBlockedHash(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	hashID, parseErr := uuid.Parse(params.ByName("hashId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	if removeErr := bh.BlocklistService.Remove(request.Context(), hashID); removeErr != nil {
+		writeServiceErr(writer, request, "remove blocked hash", removeErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Hash Unblocked!",
+	})
+}
+
+func (bh *BlocklistHandler) ListBlockedUploads(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	limit, offset := helper.ParsePagination(request)
+
+	attempts, listErr := bh.BlocklistService.Attempts(request.Context(), limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list blocked uploads", listErr)
+		return
+	}
+
+	response := make([]BlockedUploadResponse, 0, len(attempts))
+	for _, attempt := range attempts {
+		response = append(response, BlockedUploadResponse{
+			ID:             attempt.ID,
+			UserID:         attempt.UserID,
+			BlockedHashID:  attempt.BlockedHashID,
+			SHA256:         attempt.SHA256,
+			PerceptualHash: attempt.PerceptualHash,
+			Filename:       attempt.Filename,
+			CreatedAt:      attempt.CreatedAt,
+		})
+	}
+	helper.WriteToResponseBody(writer, response)
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+)
+
+type CommentHandler struct {
+	CommentService *service.CommentService
+}
+
+type CreateCommentRequest struct {
+	Body     string     `json:"body"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type EditCommentRequest struct {
+	Body string `json:"body"`
+}
+
+type UpdatePhotoRequest struct {
+	CommentsEnabled *bool `json:"comments_enabled"`
+}
+
+func NewCommentHandler(commentService *service.CommentService) *CommentHandler {
+	return &CommentHandler{CommentService: commentService}
+}
+
+func (ch *CommentHandler) ListComments(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	limit, offset := helper.ParsePagination(request)
+	threads, listErr := ch.CommentService.ListComments(request.Context(), photoID, limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list comments", listErr)
+		return
+	}
+	helper.WriteToResponseBody(writer, toCommentThreads(threads))
+}
+
+func (ch *CommentHandler) ListHiddenComments(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	limit, offset := helper.ParsePagination(request)
+	hidden, listErr := ch.CommentService.ListHiddenComments(ctx, userID, photoID, limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list hidden comments", listErr)
+		return
+	}
+
+	response := make([]CommentResponse, 0, len(hidden))
+	for _, comment := range hidden {
+		response = append(response, toCommentResponse(comment))
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (ch *CommentHandler) CreateComment(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	reqBody := CreateCommentRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	comment, createErr := ch.CommentService.AddComment(ctx, userID, photoID, reqBody.ParentID, reqBody.Body)
+	if createErr != nil {
+		writeServiceErr(writer, request, "create comment", createErr)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusCreated,
+		Status: "Comment Posted!",
+		Data:   toCommentResponse(comment),
+	})
+}
+
+func (ch *CommentHandler) EditComment(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	commentID, parseErr := uuid.Parse(params.ByName("commentId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	reqBody := EditCommentRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	comment, editErr := ch.CommentService.EditComment(ctx, userID, commentID, reqBody.Body)
+	if editErr != nil {
+		writeServiceErr(writer, request, "edit comment", editErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Comment Updated!",
+		Data:   toCommentResponse(comment),
+	})
+}
+
+func (ch *CommentHandler) DeleteComment(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	commentID, parseErr := uuid.Parse(params.ByName("commentId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	if deleteErr := ch.CommentService.DeleteComment(ctx, userID, commentID); deleteErr != nil {
+		writeServiceErr(writer, request, "delete comment", deleteErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Comment Deleted!",
+	})
+}
+
+func (ch *CommentHandler) HideComment(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ch.setHidden(writer, request, params, true)
+}
+
+func (ch *CommentHandler) UnhideComment(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ch.setHidden(writer, request, params, false)
+}
+
+func (ch *CommentHandler) setHidden(writer http.ResponseWriter, request *http.Request, params httprouter.Params, hidden bool) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	commentID, parseErr := uuid.Parse(params.ByName("commentId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	if updateErr := ch.CommentService.SetCommentHidden(ctx, userID, commentID, hidden); updateErr != nil {
+		writeServiceErr(writer, request, "update comment visibility", updateErr)
+		return
+	}
+
+	message := "Comment Hidden!"
+	if !hidden {
+		message = "Comment Unhidden!"
+	}
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   message,
+	})
+}
+
+// UpdatePhoto changes the owner-controlled settings of a photo; currently
+// only whether it accepts comments.
+func (ch *CommentHandler) UpdatePhoto(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	reqBody := UpdatePhotoRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil || reqBody.CommentsEnabled == nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if updateErr := ch.CommentService.SetCommentsEnabled(ctx, userID, photoID, *reqBody.CommentsEnabled); updateErr != nil {
+		writeServiceErr(writer, request, "update photo", updateErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Photo Updated!",
+	})
+}
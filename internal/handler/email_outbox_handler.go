@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+	"time"
+)
+
+type EmailOutboxHandler struct {
+	EmailOutboxService *service.EmailOutboxService
+}
+
+type DeadLetterResponse struct {
+	ID        uuid.UUID `json:"id"`
+	ToEmail   string    `json:"to_email"`
+	Subject   string    `json:"subject"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewEmailOutboxHandler(emailOutboxService *service.EmailOutboxService) *EmailOutboxHandler {
+	return &EmailOutboxHandler{EmailOutboxService: emailOutboxService}
+}
+
+func (eh *EmailOutboxHandler) ListDeadLetters(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	limit, offset := helper.ParsePagination(request)
+
+	deadEmails, listErr := eh.EmailOutboxService.DeadLetters(request.Context(), limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list dead-lettered emails", listErr)
+		return
+	}
+
+	response := make([]DeadLetterResponse, 0, len(deadEmails))
+	for _, email := range deadEmails {
+		response = append(response, DeadLetterResponse{
+			ID:        email.ID,
+			ToEmail:   email.ToEmail,
+			Subject:   email.Subject,
+			Attempts:  email.Attempts,
+			LastError: email.LastError,
+			CreatedAt: email.CreatedAt,
+		})
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (eh *EmailOutboxHandler) RetryEmail(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	emailID, parseErr := uuid.Parse(params.ByName("emailId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	if retryErr := eh.EmailOutboxService.Retry(request.Context(), emailID); retryErr != nil {
+		writeServiceErr(writer, request, "retry email", retryErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Email Requeued!",
+	})
+}
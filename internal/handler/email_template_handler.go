@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+)
+
+type EmailTemplateHandler struct {
+	TemplateRegistry *service.TemplateRegistry
+}
+
+func NewEmailTemplateHandler(templateRegistry *service.TemplateRegistry) *EmailTemplateHandler {
+	return &EmailTemplateHandler{TemplateRegistry: templateRegistry}
+}
+
+func (th *EmailTemplateHandler) ListTemplates(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	helper.WriteToResponseBody(writer, th.TemplateRegistry.List())
+}
+
+// PreviewTemplate renders a template with sample data. ?format=html returns
+// the HTML body itself so it can be opened in a browser.
+func (th *EmailTemplateHandler) PreviewTemplate(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	query := request.URL.Query()
+	rendered, renderErr := th.TemplateRegistry.Preview(params.ByName("name"), query.Get("locale"))
+	if renderErr != nil {
+		writeServiceErr(writer, request, "preview email template", renderErr)
+		return
+	}
+
+	if query.Get("format") == "html" {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = writer.Write([]byte(rendered.HTML))
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   rendered,
+	})
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"github.com/meliocool/arkive/internal/helper"
+	"log/slog"
+	"net/http"
+)
+
+var clientErrors = []error{
+	helper.ErrBadRequest,
+	helper.ErrTooLarge,
+	helper.ErrNotFound,
+	helper.ErrUnsupportedMediaType,
+	helper.ErrUnauthorized,
+	helper.ErrForbidden,
+	helper.ErrConflict,
+	helper.ErrTooManyRequests,
+	helper.ErrQuotaExceeded,
+	helper.ErrBlockedContent,
+}
+
+// writeServiceErr maps the sentinel errors returned by services onto their
+// HTTP responses and logs anything unexpected as an internal error. Client
+// errors keep the detail the service wrapped around the sentinel, such as the
+// field that was invalid; internal errors never reach the client.
+func writeServiceErr(writer http.ResponseWriter, request *http.Request, action string, err error) {
+	for _, clientErr := range clientErrors {
+		if errors.Is(err, clientErr) {
+			helper.WriteErr(writer, err)
+			return
+		}
+	}
+	slog.ErrorContext(request.Context(), "failed to "+action, "error", err)
+	helper.WriteErr(writer, helper.ErrInternal)
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/service"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// eventHeartbeatInterval keeps idle streams from being closed by proxies.
+const eventHeartbeatInterval = 25 * time.Second
+
+type EventHandler struct {
+	EventBus *service.EventBus
+}
+
+func NewEventHandler(eventBus *service.EventBus) *EventHandler {
+	return &EventHandler{EventBus: eventBus}
+}
+
+// Stream sends the caller's events as Server-Sent Events until the client
+// disconnects. A Last-Event-ID header (or lastEventId query parameter) replays
+// the events the client missed while it was reconnecting.
+func (eh *EventHandler) Stream(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrInternal)
+		return
+	}
+
+	lastEventID := request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = request.URL.Query().Get("lastEventId")
+	}
+	resumeFrom, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	events, missed, unsubscribe := eh.EventBus.Subscribe(userID, resumeFrom)
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	fmt.Fprint(writer, "retry: 5000\n\n")
+
+	for _, event := range missed {
+		if writeErr := writeEvent(writer, event); writeErr != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			if writeErr := writeEvent(writer, event); writeErr != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, writeErr := fmt.Fprint(writer, ": heartbeat\n\n"); writeErr != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(writer http.ResponseWriter, event service.Event) error {
+	data, marshalErr := json.Marshal(event.Data)
+	if marshalErr != nil {
+		slog.Error("failed to encode event", "type", event.Type, "error", marshalErr)
+		return nil
+	}
+	_, writeErr := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return writeErr
+}
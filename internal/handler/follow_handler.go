@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+)
+
+type FollowHandler struct {
+	FollowService *service.FollowService
+}
+
+func NewFollowHandler(followService *service.FollowService) *FollowHandler {
+	return &FollowHandler{FollowService: followService}
+}
+
+func (fh *FollowHandler) Follow(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	followerID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	followeeID, parseErr := uuid.Parse(params.ByName("userId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	if followErr := fh.FollowService.Follow(ctx, followerID, followeeID); followErr != nil {
+		writeServiceErr(writer, request, "follow user", followErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "User Followed!",
+	})
+}
+
+func (fh *FollowHandler) Unfollow(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	followerID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	followeeID, parseErr := uuid.Parse(params.ByName("userId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	if unfollowErr := fh.FollowService.Unfollow(ctx, followerID, followeeID); unfollowErr != nil {
+		writeServiceErr(writer, request, "unfollow user", unfollowErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "User Unfollowed!",
+	})
+}
+
+func (fh *FollowHandler) ListFollowers(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	fh.listUsers(writer, request, params, "list followers", fh.FollowService.Followers)
+}
+
+func (fh *FollowHandler) ListFollowing(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	fh.listUsers(writer, request, params, "list following", fh.FollowService.Following)
+}
+
+type listFollowsFunc func(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error)
+
+func (fh *FollowHandler) listUsers(writer http.ResponseWriter, request *http.Request, params httprouter.Params, action string, list listFollowsFunc) {
+	userID, parseErr := uuid.Parse(params.ByName("userId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	limit, offset := helper.ParsePagination(request)
+	userList, listErr := list(request.Context(), userID, limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, action, listErr)
+		return
+	}
+
+	response := make([]PublicUserResponse, 0, len(userList))
+	for _, user := range userList {
+		response = append(response, toPublicUser(user))
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (fh *FollowHandler) Feed(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	limit, offset := helper.ParsePagination(request)
+	photoList, feedErr := fh.FollowService.Feed(ctx, userID, limit, offset)
+	if feedErr != nil {
+		writeServiceErr(writer, request, "load feed", feedErr)
+		return
+	}
+	helper.WriteToResponseBody(writer, toPublicPhotos(photoList))
+}
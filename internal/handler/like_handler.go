@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+)
+
+type LikeHandler struct {
+	LikeService *service.LikeService
+}
+
+func NewLikeHandler(likeService *service.LikeService) *LikeHandler {
+	return &LikeHandler{LikeService: likeService}
+}
+
+func (lh *LikeHandler) LikePhoto(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	lh.changeLike(writer, request, params, "like photo", "Photo Liked!", lh.LikeService.Like)
+}
+
+func (lh *LikeHandler) UnlikePhoto(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	lh.changeLike(writer, request, params, "unlike photo", "Photo Unliked!", lh.LikeService.Unlike)
+}
+
+type changeLikeFunc func(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (*photos.Photo, error)
+
+func (lh *LikeHandler) changeLike(writer http.ResponseWriter, request *http.Request, params httprouter.Params, action string, status string, change changeLikeFunc) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	photo, changeErr := change(ctx, userID, photoID)
+	if changeErr != nil {
+		writeServiceErr(writer, request, action, changeErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: status,
+		Data:   toPublicPhoto(photo),
+	})
+}
+
+func (lh *LikeHandler) ListFavorites(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, resolveErr := resolveUserParam(ctx, params.ByName("userId"))
+	if resolveErr != nil {
+		helper.WriteErr(writer, resolveErr)
+		return
+	}
+
+	limit, offset := helper.ParsePagination(request)
+	photoList, listErr := lh.LikeService.Favorites(ctx, userID, limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list favorites", listErr)
+		return
+	}
+	helper.WriteToResponseBody(writer, toPublicPhotos(photoList))
+}
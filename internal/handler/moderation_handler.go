@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/repository/moderation"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+	"time"
+)
+
+type ModerationHandler struct {
+	ModerationService *service.ModerationService
+}
+
+type ReportPhotoRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+type ModeratePhotoRequest struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+type ReportResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	PhotoID    uuid.UUID  `json:"photo_id"`
+	ReporterID uuid.UUID  `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ModerationQueueResponse struct {
+	PhotoID         uuid.UUID  `json:"photo_id"`
+	UploaderID      uuid.UUID  `json:"uploader_id"`
+	Filename        string     `json:"filename"`
+	IPFSCid         string     `json:"ipfs_cid"`
+	HiddenAt        *time.Time `json:"hidden_at"`
+	ReportCount     int        `json:"report_count"`
+	Reasons         []string   `json:"reasons"`
+	FirstReportedAt time.Time  `json:"first_reported_at"`
+	LastReportedAt  time.Time  `json:"last_reported_at"`
+}
+
+type ModerationActionResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	ModeratorID  uuid.UUID  `json:"moderator_id"`
+	Action       string     `json:"action"`
+	PhotoID      *uuid.UUID `json:"photo_id"`
+	TargetUserID *uuid.UUID `json:"target_user_id"`
+	Note         string     `json:"note"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func NewModerationHandler(moderationService *service.ModerationService) *ModerationHandler {
+	return &ModerationHandler{ModerationService: moderationService}
+}
+
+func toReportResponse(report *moderation.Report) ReportResponse {
+	return ReportResponse{
+		ID:         report.ID,
+		PhotoID:    report.PhotoID,
+		ReporterID: report.ReporterID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+		ResolvedAt: report.ResolvedAt,
+		CreatedAt:  report.CreatedAt,
+	}
+}
+
+func (mh *ModerationHandler) ReportPhoto(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	reqBody := ReportPhotoRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	report, reportErr := mh.ModerationService.ReportPhoto(ctx, userID, photoID, reqBody.Reason, reqBody.Details)
+	if reportErr != nil {
+		writeServiceErr(writer, request, "report photo", reportErr)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusCreated,
+		Status: "Photo Reported!",
+		Data:   toReportResponse(report),
+	})
+}
+
+func (mh *ModerationHandler) ListQueue(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	limit, offset := helper.ParsePagination(request)
+
+	queue, listErr := mh.ModerationService.Queue(request.Context(), limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list moderation queue", listErr)
+		return
+	}
+
+	response := make([]ModerationQueueResponse, 0, len(queue))
+	for _, item := range queue {
+		response = append(response, ModerationQueueResponse{
+			PhotoID:         item.PhotoID,
+			UploaderID:      item.UploaderID,
+			Filename:        item.Filename,
+			IPFSCid:         item.IPFSCid,
+			HiddenAt:        item.HiddenAt,
+			ReportCount:     item.ReportCount,
+			Reasons:         item.Reasons,
+			FirstReportedAt: item.FirstReportedAt,
+			LastReportedAt:  item.LastReportedAt,
+		})
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (mh *ModerationHandler) ListPhotoReports(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	reports, listErr := mh.ModerationService.Reports(request.Context(), photoID)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list photo reports", listErr)
+		return
+	}
+
+	response := make([]ReportResponse, 0, len(reports))
+	for _, report := range reports {
+		response = append(response, toReportResponse(report))
+	}
+	helper.WriteToResponseBody(writer, response)
+}
+
+func (mh *ModerationHandler) ModeratePhoto(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	moderatorID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	photoID, parseErr := uuid.Parse(params.ByName("photoId"))
+	if parseErr != nil {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+
+	reqBody := ModeratePhotoRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if moderateErr := mh.ModerationService.ModeratePhoto(ctx, moderatorID, photoID, reqBody.Action, reqBody.Note); moderateErr != nil {
+		writeServiceErr(writer, request, "moderate photo", moderateErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Moderation Action Applied!",
+	})
+}
+
+func (mh *ModerationHandler) AuditLog(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	limit, offset := helper.ParsePagination(request)
+
+	actions, listErr := mh.ModerationService.AuditLog(request.Context(), limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list moderation actions", listErr)
+		return
+	}
+
+	response := make([]ModerationActionResponse, 0, len(actions))
+	for _, action := range actions {
+		response = append(response, ModerationActionResponse{
+			ID:           action.ID,
+			ModeratorID:  action.ModeratorID,
+			Action:       action.Action,
+			PhotoID:      action.PhotoID,
+			TargetUserID: action.TargetUserID,
+			Note:         action.Note,
+			CreatedAt:    action.CreatedAt,
+		})
+	}
+	helper.WriteToResponseBody(writer, response)
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/repository/notifications"
+	"github.com/meliocool/arkive/internal/service"
+	"net/http"
+	"time"
+)
+
+type NotificationHandler struct {
+	NotificationService *service.NotificationService
+	PreferenceService   *service.PreferenceService
+}
+
+type NotificationResponse struct {
+	ID        uuid.UUID      `json:"id"`
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Data      map[string]any `json:"data"`
+	Read      bool           `json:"read"`
+	ReadAt    *time.Time     `json:"read_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type NotificationListResponse struct {
+	UnreadCount   int                    `json:"unread_count"`
+	Notifications []NotificationResponse `json:"notifications"`
+}
+
+type MarkNotificationsReadRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+// NotificationPreferencesRequest maps category to channel to enabled, e.g.
+// {"photos": {"in_app": true, "email": false}}. Omitted entries are unchanged.
+type NotificationPreferencesRequest map[string]map[string]bool
+
+func NewNotificationHandler(notificationService *service.NotificationService, preferenceService *service.PreferenceService) *NotificationHandler {
+	return &NotificationHandler{NotificationService: notificationService, PreferenceService: preferenceService}
+}
+
+func toNotificationResponses(notificationList []*notifications.Notification) []NotificationResponse {
+	response := make([]NotificationResponse, 0, len(notificationList))
+	for _, notification := range notificationList {
+		response = append(response, NotificationResponse{
+			ID:        notification.ID,
+			Type:      notification.Type,
+			Title:     notification.Title,
+			Body:      notification.Body,
+			Data:      notification.Data,
+			Read:      notification.ReadAt != nil,
+			ReadAt:    notification.ReadAt,
+			CreatedAt: notification.CreatedAt,
+		})
+	}
+	return response
+}
+
+func (nh *NotificationHandler) ListNotifications(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	limit, offset := helper.ParsePagination(request)
+	unreadOnly := request.URL.Query().Get("unread") == "true"
+	page, listErr := nh.NotificationService.List(ctx, userID, unreadOnly, limit, offset)
+	if listErr != nil {
+		writeServiceErr(writer, request, "list notifications", listErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data: NotificationListResponse{
+			UnreadCount:   page.UnreadCount,
+			Notifications: toNotificationResponses(page.Notifications),
+		},
+	})
+}
+
+// MarkRead marks the listed notifications as read, or every notification when
+// the body is empty or has no ids.
+func (nh *NotificationHandler) MarkRead(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := MarkNotificationsReadRequest{}
+	if request.ContentLength != 0 {
+		if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+			helper.WriteErr(writer, helper.ErrBadRequest)
+			return
+		}
+	}
+
+	unread, markErr := nh.NotificationService.MarkRead(ctx, userID, reqBody.IDs)
+	if markErr != nil {
+		writeServiceErr(writer, request, "mark notifications read", markErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   map[string]int{"unread_count": unread},
+	})
+}
+
+func (nh *NotificationHandler) GetPreferences(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	nh.writePreferences(writer, request, userID)
+}
+
+func (nh *NotificationHandler) UpdatePreferences(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := NotificationPreferencesRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
+
+	if updateErr := nh.PreferenceService.Update(ctx, userID, reqBody); updateErr != nil {
+		writeServiceErr(writer, request, "update notification preferences", updateErr)
+		return
+	}
+
+	nh.writePreferences(writer, request, userID)
+}
+
+func (nh *NotificationHandler) writePreferences(writer http.ResponseWriter, request *http.Request, userID uuid.UUID) {
+	preferences, prefErr := nh.PreferenceService.Preferences(request.Context(), userID)
+	if prefErr != nil {
+		writeServiceErr(writer, request, "load notification preferences", prefErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   preferences,
+	})
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/service"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const oidcStateCookie = "arkive_oidc_state"
+
+type OIDCHandler struct {
+	OIDCService *service.OIDCService
+}
+
+func NewOIDCHandler(oidcService *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{OIDCService: oidcService}
+}
+
+func (oh *OIDCHandler) Login(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	authURL, stateToken, startErr := oh.OIDCService.StartLogin(request.Context())
+	if startErr != nil {
+		slog.ErrorContext(request.Context(), "failed to start OIDC login", "error", startErr)
+		helper.WriteErr(writer, helper.ErrInternal)
+		return
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(oh.OIDCService.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(writer, request, authURL, http.StatusFound)
+}
+
+func (oh *OIDCHandler) Callback(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	query := request.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		slog.WarnContext(request.Context(), "OIDC provider returned error", "error", providerErr, "description", query.Get("error_description"))
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	code := query.Get("code")
+	state := query.Get("state")
+	stateCookie, cookieErr := request.Cookie(oidcStateCookie)
+	if code == "" || state == "" || cookieErr != nil {
+		helper.WriteErr(writer, helper.ErrInvalidInput)
+		return
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	result, loginErr := oh.OIDCService.CompleteLogin(request.Context(), stateCookie.Value, state, code, helper.ClientIP(request))
+	if loginErr != nil {
+		if errors.Is(loginErr, helper.ErrUnauthorized) {
+			slog.WarnContext(request.Context(), "OIDC login rejected", "error", loginErr)
+		}
+		writeServiceErr(writer, request, "complete OIDC login", loginErr)
+		return
+	}
+
+	writeLoginResponse(writer, "", result)
+}
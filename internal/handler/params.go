@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+// resolveUserParam turns the :userId of an authenticated /users/:userId/...
+// route into a user ID. "me" stands for the caller; other users' resources are
+// only reachable by admins. The routes cannot live under /users/me/... because
+// httprouter does not allow it next to the public GET /users/:userId.
+func resolveUserParam(ctx context.Context, param string) (uuid.UUID, error) {
+	callerID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		return uuid.Nil, helper.ErrUnauthorized
+	}
+	if param == "me" {
+		return callerID, nil
+	}
+
+	userID, parseErr := uuid.Parse(param)
+	if parseErr != nil {
+		return uuid.Nil, helper.ErrNotFound
+	}
+	if userID == callerID {
+		return userID, nil
+	}
+
+	role, _ := ctx.Value(middleware.ContextKeyRole).(string)
+	if !users.HasRole(role, users.RoleAdmin) {
+		return uuid.Nil, helper.ErrForbidden
+	}
+	return userID, nil
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/meliocool/arkive/internal/helper"
 	"github.com/meliocool/arkive/internal/middleware"
 	"github.com/meliocool/arkive/internal/service"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -45,10 +45,9 @@ func (ph *PhotoHandler) UploadPhoto(writer http.ResponseWriter, request *http.Re
 	}
 	defer file.Close()
 
-	newPhoto, uploadErr := ph.PhotoService.UploadPhoto(ctx, userIDUUID, fileHeader.Filename, file)
+	newPhoto, uploadErr := ph.PhotoService.UploadPhoto(ctx, userIDUUID, fileHeader.Filename, file, fileHeader.Size)
 	if uploadErr != nil {
-		log.Printf("Error uploading photo: %v", uploadErr)
-		helper.WriteErr(writer, helper.ErrInternal)
+		writeServiceErr(writer, request, "upload photo", uploadErr)
 		return
 	}
 	helper.WriteToResponseBody(writer, newPhoto)
@@ -70,7 +69,7 @@ func (ph *PhotoHandler) ListPhotos(writer http.ResponseWriter, request *http.Req
 	}
 	photos, listErr := ph.PhotoService.ListPhotos(ctx, userUUID)
 	if listErr != nil {
-		log.Printf("Error listing photos: %v", listErr)
+		slog.ErrorContext(ctx, "failed to list photos", "user_id", userUUID, "error", listErr)
 		helper.WriteErr(writer, helper.ErrInternal)
 		return
 	}
@@ -158,3 +157,36 @@ func (ph *PhotoHandler) SetProfilePicture(writer http.ResponseWriter, request *h
 		return
 	}
 }
+
+type StorageUsageResponse struct {
+	PhotoCount     int   `json:"photo_count"`
+	UsedBytes      int64 `json:"used_bytes"`
+	QuotaBytes     int64 `json:"quota_bytes"`
+	RemainingBytes int64 `json:"remaining_bytes"`
+}
+
+func (ph *PhotoHandler) GetUsage(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, resolveErr := resolveUserParam(ctx, params.ByName("userId"))
+	if resolveErr != nil {
+		helper.WriteErr(writer, resolveErr)
+		return
+	}
+
+	usage, usageErr := ph.PhotoService.Usage(ctx, userID)
+	if usageErr != nil {
+		writeServiceErr(writer, request, "get storage usage", usageErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data: StorageUsageResponse{
+			PhotoCount:     usage.PhotoCount,
+			UsedBytes:      usage.UsedBytes,
+			QuotaBytes:     usage.QuotaBytes,
+			RemainingBytes: usage.RemainingBytes,
+		},
+	})
+}
@@ -6,9 +6,8 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/meliocool/arkive/internal/helper"
 	"github.com/meliocool/arkive/internal/repository/photos"
-	"github.com/meliocool/arkive/internal/repository/users"
 	"github.com/meliocool/arkive/internal/service"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -16,24 +15,30 @@ type PublicHandler struct {
 	PublicService service.PublicService
 }
 
-type ProfileResponse struct {
-	UserInfo   *users.User
-	UserPhotos []*photos.Photo
-}
-
 func NewPublicHandler(publicService *service.PublicService) *PublicHandler {
 	return &PublicHandler{PublicService: *publicService}
 }
 
 func (ph *PublicHandler) ListAllPublicPhotos(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	ctx := request.Context()
-	photos, listErr := ph.PublicService.FindAll(ctx)
+	var photoList []*photos.Photo
+	var listErr error
+	switch request.URL.Query().Get("sort") {
+	case "", "recent":
+		photoList, listErr = ph.PublicService.FindAll(ctx)
+	case "popular":
+		limit, offset := helper.ParsePagination(request)
+		photoList, listErr = ph.PublicService.FindPopular(ctx, limit, offset)
+	default:
+		helper.WriteErr(writer, helper.ErrBadRequest)
+		return
+	}
 	if listErr != nil {
-		log.Printf("Error listing all photos: %v", listErr)
+		slog.ErrorContext(ctx, "failed to list public photos", "error", listErr)
 		helper.WriteErr(writer, helper.ErrInternal)
 		return
 	}
-	helper.WriteToResponseBody(writer, photos)
+	helper.WriteToResponseBody(writer, toPublicPhotos(photoList))
 }
 
 func (ph *PublicHandler) ViewUserProfile(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -50,21 +55,35 @@ func (ph *PublicHandler) ViewUserProfile(writer http.ResponseWriter, request *ht
 	}
 	userInfo, userPhotos, getUserProfileErr := ph.PublicService.FindUserProfile(ctx, userIDUUID)
 	if getUserProfileErr != nil {
-		switch {
-		case errors.Is(getUserProfileErr, helper.ErrNotFound):
-			helper.WriteErr(writer, helper.ErrNotFound)
-			return
-		case errors.Is(getUserProfileErr, helper.ErrUnauthorized):
-			helper.WriteErr(writer, helper.ErrUnauthorized)
-			return
-		default:
-			log.Printf("ViewUserProfile error userID=%s: %v", userId, getUserProfileErr)
-			helper.WriteErr(writer, helper.ErrInternal)
-			return
-		}
+		writePublicProfileErr(writer, request, userId, getUserProfileErr)
+		return
+	}
+	helper.WriteToResponseBody(writer, toPublicProfile(userInfo, userPhotos))
+}
+
+func (ph *PublicHandler) ViewUserProfileByUsername(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	username := params.ByName("username")
+	if username == "" {
+		helper.WriteErr(writer, helper.ErrNotFound)
+		return
+	}
+	userInfo, userPhotos, getUserProfileErr := ph.PublicService.FindUserProfileByUsername(ctx, username)
+	if getUserProfileErr != nil {
+		writePublicProfileErr(writer, request, username, getUserProfileErr)
+		return
+	}
+	helper.WriteToResponseBody(writer, toPublicProfile(userInfo, userPhotos))
+}
+
+func writePublicProfileErr(writer http.ResponseWriter, request *http.Request, lookup string, err error) {
+	switch {
+	case errors.Is(err, helper.ErrNotFound):
+		helper.WriteErr(writer, helper.ErrNotFound)
+	case errors.Is(err, helper.ErrUnauthorized):
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+	default:
+		slog.ErrorContext(request.Context(), "failed to view user profile", "user", lookup, "error", err)
+		helper.WriteErr(writer, helper.ErrInternal)
 	}
-	helper.WriteToResponseBody(writer, &ProfileResponse{
-		UserInfo:   userInfo,
-		UserPhotos: userPhotos,
-	})
 }
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/repository/comments"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"github.com/meliocool/arkive/internal/service"
+	"time"
+)
+
+// Public responses are the only shapes unauthenticated endpoints may write.
+// They copy fields over one by one, so a column added to users.User or
+// photos.Photo stays private until it is deliberately listed here.
+
+type PublicUserResponse struct {
+	ID              uuid.UUID `json:"id"`
+	Username        string    `json:"username"`
+	DisplayName     string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	Website         string    `json:"website"`
+	ProfileImageCID string    `json:"profile_image_cid"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type PublicPhotoResponse struct {
+	ID        uuid.UUID `json:"id"`
+	IPFSCid   string    `json:"ipfs_cid"`
+	Filename  string    `json:"filename"`
+	UserID    uuid.UUID `json:"user_id"`
+	LikeCount int       `json:"like_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PublicProfileResponse struct {
+	User   PublicUserResponse    `json:"user"`
+	Photos []PublicPhotoResponse `json:"photos"`
+}
+
+func toPublicUser(user *users.User) PublicUserResponse {
+	return PublicUserResponse{
+		ID:              user.ID,
+		Username:        user.Username,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		Website:         user.Website,
+		ProfileImageCID: user.ProfileImageCID,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+func toPublicPhoto(photo *photos.Photo) PublicPhotoResponse {
+	return PublicPhotoResponse{
+		ID:        photo.ID,
+		IPFSCid:   photo.IPFSCid,
+		Filename:  photo.Filename,
+		UserID:    photo.UserID,
+		LikeCount: photo.LikeCount,
+		CreatedAt: photo.CreatedAt,
+	}
+}
+
+func toPublicPhotos(photoList []*photos.Photo) []PublicPhotoResponse {
+	response := make([]PublicPhotoResponse, 0, len(photoList))
+	for _, photo := range photoList {
+		response = append(response, toPublicPhoto(photo))
+	}
+	return response
+}
+
+func toPublicProfile(user *users.User, photoList []*photos.Photo) PublicProfileResponse {
+	return PublicProfileResponse{
+		User:   toPublicUser(user),
+		Photos: toPublicPhotos(photoList),
+	}
+}
+
+type CommentAuthorResponse struct {
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+}
+
+type CommentResponse struct {
+	ID        uuid.UUID             `json:"id"`
+	PhotoID   uuid.UUID             `json:"photo_id"`
+	ParentID  *uuid.UUID            `json:"parent_id"`
+	Author    CommentAuthorResponse `json:"author"`
+	Body      string                `json:"body"`
+	HiddenAt  *time.Time            `json:"hidden_at,omitempty"`
+	EditedAt  *time.Time            `json:"edited_at"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+type CommentThreadResponse struct {
+	CommentResponse
+	Replies []CommentResponse `json:"replies"`
+}
+
+func toCommentResponse(comment *comments.Comment) CommentResponse {
+	return CommentResponse{
+		ID:       comment.ID,
+		PhotoID:  comment.PhotoID,
+		ParentID: comment.ParentID,
+		Author: CommentAuthorResponse{
+			ID:       comment.UserID,
+			Username: comment.AuthorUsername,
+		},
+		Body:      comment.Body,
+		HiddenAt:  comment.HiddenAt,
+		EditedAt:  comment.EditedAt,
+		CreatedAt: comment.CreatedAt,
+	}
+}
+
+func toCommentThreads(threads []*service.CommentThread) []CommentThreadResponse {
+	response := make([]CommentThreadResponse, 0, len(threads))
+	for _, thread := range threads {
+		replies := make([]CommentResponse, 0, len(thread.Replies))
+		for _, reply := range thread.Replies {
+			replies = append(replies, toCommentResponse(reply))
+		}
+		response = append(response, CommentThreadResponse{
+			CommentResponse: toCommentResponse(thread.Comment),
+			Replies:         replies,
+		})
+	}
+	return response
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/service"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// unsubscribePage asks for confirmation on GET, since mail scanners follow
+// links, and reports the result after the form is posted.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8" /><title>Arkive - Unsubscribe</title></head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 48px auto;">
+{{if .Done}}
+<p>You will no longer receive <strong>{{.Category}}</strong> emails from Arkive.
+You can turn them back on from your notification preferences.</p>
+{{else}}
+<p>Stop receiving <strong>{{.Category}}</strong> emails from Arkive?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+{{end}}
+</body>
+</html>
+`))
+
+type unsubscribePageData struct {
+	Category string
+	Done     bool
+}
+
+type UnsubscribeHandler struct {
+	PreferenceService *service.PreferenceService
+}
+
+type UnsubscribeResponse struct {
+	Category string `json:"category"`
+	Channel  string `json:"channel"`
+}
+
+func NewUnsubscribeHandler(preferenceService *service.PreferenceService) *UnsubscribeHandler {
+	return &UnsubscribeHandler{PreferenceService: preferenceService}
+}
+
+// ConfirmUnsubscribe shows what the link unsubscribes from without changing
+// anything.
+func (uh *UnsubscribeHandler) ConfirmUnsubscribe(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	_, category, targetErr := uh.PreferenceService.UnsubscribeTarget(params.ByName("token"))
+	if targetErr != nil {
+		writeServiceErr(writer, request, "check unsubscribe token", targetErr)
+		return
+	}
+
+	writeUnsubscribePage(writer, request, unsubscribePageData{Category: category})
+}
+
+// Unsubscribe turns off email for the token's category. It serves both the
+// confirmation form and RFC 8058 one-click requests, which POST
+// "List-Unsubscribe=One-Click" with no session.
+func (uh *UnsubscribeHandler) Unsubscribe(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	category, unsubscribeErr := uh.PreferenceService.Unsubscribe(request.Context(), params.ByName("token"))
+	if unsubscribeErr != nil {
+		writeServiceErr(writer, request, "unsubscribe", unsubscribeErr)
+		return
+	}
+
+	if strings.Contains(request.Header.Get("Accept"), "text/html") {
+		writeUnsubscribePage(writer, request, unsubscribePageData{Category: category, Done: true})
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   UnsubscribeResponse{Category: category, Channel: service.ChannelEmail},
+	})
+}
+
+func writeUnsubscribePage(writer http.ResponseWriter, request *http.Request, data unsubscribePageData) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribePage.Execute(writer, data); err != nil {
+		slog.ErrorContext(request.Context(), "failed to render unsubscribe page", "error", err)
+	}
+}
@@ -1,19 +1,21 @@
 package handler
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"github.com/julienschmidt/httprouter"
 	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/middleware"
 	"github.com/meliocool/arkive/internal/service"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type UserHandler struct {
 	RegistrationService service.RegistrationService
 	LoginService        service.LoginService
+	TwoFactorService    service.TwoFactorService
 }
 
 type RegisterRequest struct {
@@ -21,6 +23,7 @@ type RegisterRequest struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirmPassword"`
+	Locale          string `json:"locale"`
 }
 
 type RegisterResponse struct {
@@ -49,12 +52,32 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Email string `json:"email"`
-	Token string `json:"token"`
+	Email             string `json:"email"`
+	Token             string `json:"token"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
 }
 
-func NewUserHandler(registrationService *service.RegistrationService, loginService *service.LoginService) *UserHandler {
-	return &UserHandler{RegistrationService: *registrationService, LoginService: *loginService}
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func NewUserHandler(registrationService *service.RegistrationService, loginService *service.LoginService, twoFactorService *service.TwoFactorService) *UserHandler {
+	return &UserHandler{RegistrationService: *registrationService, LoginService: *loginService, TwoFactorService: *twoFactorService}
 }
 
 func (uh *UserHandler) RegisterUser(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -68,9 +91,13 @@ func (uh *UserHandler) RegisterUser(writer http.ResponseWriter, request *http.Re
 		helper.WriteErr(writer, helper.ErrInvalidInput)
 		return
 	}
-	user, regErr := uh.RegistrationService.Register(request.Context(), reqBody.Username, reqBody.Email, reqBody.Password)
+	locale := reqBody.Locale
+	if locale == "" {
+		locale = acceptedLocale(request)
+	}
+	user, regErr := uh.RegistrationService.Register(request.Context(), reqBody.Username, reqBody.Email, reqBody.Password, locale)
 	if regErr != nil {
-		helper.WriteErr(writer, helper.ErrInternal)
+		writeServiceErr(writer, request, "register user", regErr)
 		return
 	}
 	writer.Header().Add("Content-Type", "application/json")
@@ -103,7 +130,7 @@ func (uh *UserHandler) VerifyUser(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
-	user, token, verifyErr := uh.RegistrationService.VerifyUser(context.Background(), reqBody.Email, reqBody.VerificationCode)
+	user, token, verifyErr := uh.RegistrationService.VerifyUser(request.Context(), reqBody.Email, reqBody.VerificationCode)
 	if verifyErr != nil {
 		helper.WriteErr(writer, helper.ErrInternal)
 		return
@@ -140,24 +167,141 @@ func (uh *UserHandler) LoginUser(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	token, loginErr := uh.LoginService.Login(context.Background(), reqBody.Email, reqBody.Password)
+	result, loginErr := uh.LoginService.Login(request.Context(), reqBody.Email, reqBody.Password, helper.ClientIP(request))
 	if loginErr != nil {
 		if errors.Is(loginErr, helper.ErrUnauthorized) {
 			helper.WriteErr(writer, helper.ErrUnauthorized)
 			return
 		}
+		if errors.Is(loginErr, helper.ErrForbidden) {
+			helper.WriteErr(writer, helper.ErrForbidden)
+			return
+		}
+		if errors.Is(loginErr, helper.ErrTooManyRequests) {
+			helper.WriteErr(writer, helper.ErrTooManyRequests)
+			return
+		}
 		helper.WriteErr(writer, helper.ErrInternal)
 		return
 	}
 
+	writeLoginResponse(writer, reqBody.Email, result)
+}
+
+func (uh *UserHandler) LoginTwoFactor(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	decoder := json.NewDecoder(request.Body)
+	reqBody := TwoFactorLoginRequest{}
+	if err := decoder.Decode(&reqBody); err != nil {
+		helper.WriteErr(writer, helper.ErrInvalidInput)
+		return
+	}
+	if reqBody.ChallengeToken == "" || reqBody.Code == "" {
+		helper.WriteErr(writer, helper.ErrInvalidInput)
+		return
+	}
+
+	result, verifyErr := uh.LoginService.VerifyTwoFactor(request.Context(), reqBody.ChallengeToken, reqBody.Code, helper.ClientIP(request))
+	if verifyErr != nil {
+		writeServiceErr(writer, request, "verify two-factor login", verifyErr)
+		return
+	}
+
+	writeLoginResponse(writer, "", result)
+}
+
+func (uh *UserHandler) EnrollTwoFactor(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	enrollment, enrollErr := uh.TwoFactorService.Enroll(ctx, userID)
+	if enrollErr != nil {
+		writeServiceErr(writer, request, "enroll two-factor", enrollErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Two-Factor Enrollment Started!",
+		Data: TwoFactorEnrollResponse{
+			Secret:     enrollment.Secret,
+			OtpauthURI: enrollment.URI,
+		},
+	})
+}
+
+func (uh *UserHandler) ConfirmTwoFactor(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := TwoFactorCodeRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil || reqBody.Code == "" {
+		helper.WriteErr(writer, helper.ErrInvalidInput)
+		return
+	}
+
+	codes, confirmErr := uh.TwoFactorService.Confirm(ctx, userID, reqBody.Code)
+	if confirmErr != nil {
+		writeServiceErr(writer, request, "confirm two-factor", confirmErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "Two-Factor Authentication Enabled!",
+		Data:   TwoFactorConfirmResponse{RecoveryCodes: codes},
+	})
+}
+
+func (uh *UserHandler) DisableTwoFactor(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	ctx := request.Context()
+	userID, ok := middleware.UserIDFromContext(ctx)
+	if !ok {
+		helper.WriteErr(writer, helper.ErrUnauthorized)
+		return
+	}
+
+	reqBody := TwoFactorCodeRequest{}
+	if err := json.NewDecoder(request.Body).Decode(&reqBody); err != nil || reqBody.Code == "" {
+		helper.WriteErr(writer, helper.ErrInvalidInput)
+		return
+	}
+
+	if disableErr := uh.TwoFactorService.Disable(ctx, userID, reqBody.Code); disableErr != nil {
+		writeServiceErr(writer, request, "disable two-factor", disableErr)
+		return
+	}
+
+	helper.WriteToResponseBody(writer, helper.WebResponse{
+		Code:   http.StatusOK,
+		Status: "OK",
+		Data:   "Two-Factor Authentication Disabled!",
+	})
+}
+
+func writeLoginResponse(writer http.ResponseWriter, email string, result *service.LoginResult) {
 	writer.Header().Add("Content-Type", "application/json")
 
+	status := "Login Success!"
+	if result.ChallengeToken != "" {
+		status = "Two-Factor Code Required!"
+	}
+
 	response := helper.WebResponse{
 		Code:   http.StatusOK,
-		Status: "Login Success!",
+		Status: status,
 		Data: LoginResponse{
-			Email: reqBody.Email,
-			Token: token,
+			Email:             email,
+			Token:             result.Token,
+			TwoFactorRequired: result.ChallengeToken != "",
+			ChallengeToken:    result.ChallengeToken,
 		},
 	}
 	if err := json.NewEncoder(writer).Encode(response); err != nil {
@@ -165,3 +309,15 @@ func (uh *UserHandler) LoginUser(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 }
+
+// acceptedLocale returns the client's preferred language from Accept-Language,
+// or "" when it is missing or not a usable tag.
+func acceptedLocale(request *http.Request) string {
+	preferred, _, _ := strings.Cut(request.Header.Get("Accept-Language"), ",")
+	preferred, _, _ = strings.Cut(preferred, ";")
+	locale, localeErr := service.ValidateLocale(preferred)
+	if localeErr != nil {
+		return ""
+	}
+	return locale
+}
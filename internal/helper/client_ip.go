@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP records the address ClientIP reports for requests carrying ctx,
+// once it has been resolved through any trusted proxies.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the client address resolved by middleware.ClientIP, or the
+// address of the peer when the request did not pass through it.
+func ClientIP(request *http.Request) string {
+	if ip, ok := request.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return RemoteIP(request)
+}
+
+// RemoteIP returns the address of the peer the request was received from.
+func RemoteIP(request *http.Request) string {
+	host, _, splitErr := net.SplitHostPort(request.RemoteAddr)
+	if splitErr != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -19,6 +19,11 @@ var ErrInvalidInput = errors.New("invalid input")
 var ErrInternal = errors.New("internal server error")
 var ErrUnsupportedMediaType = errors.New("unsupported media type")
 var ErrUnauthorized = errors.New("not authorized")
+var ErrConflict = errors.New("resource conflict")
+var ErrForbidden = errors.New("forbidden")
+var ErrTooManyRequests = errors.New("too many requests")
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+var ErrBlockedContent = errors.New("content is blocked")
 
 func WriteErr(w http.ResponseWriter, err error) {
 	w.Header().Set("Content-Type", "application/json")
@@ -67,6 +72,51 @@ func WriteErr(w http.ResponseWriter, err error) {
 			Data:   err.Error(),
 		}
 		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		encoder := json.NewEncoder(w)
+		webResponse := WebResponse{
+			Code:   http.StatusForbidden,
+			Status: "Forbidden!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrTooManyRequests) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		encoder := json.NewEncoder(w)
+		webResponse := WebResponse{
+			Code:   http.StatusTooManyRequests,
+			Status: "Too Many Requests!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrConflict) {
+		w.WriteHeader(http.StatusConflict)
+		encoder := json.NewEncoder(w)
+		webResponse := WebResponse{
+			Code:   http.StatusConflict,
+			Status: "Conflict!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrQuotaExceeded) {
+		w.WriteHeader(http.StatusInsufficientStorage)
+		encoder := json.NewEncoder(w)
+		webResponse := WebResponse{
+			Code:   http.StatusInsufficientStorage,
+			Status: "Storage Quota Exceeded!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
+	} else if errors.Is(err, ErrBlockedContent) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		encoder := json.NewEncoder(w)
+		webResponse := WebResponse{
+			Code:   http.StatusUnprocessableEntity,
+			Status: "Blocked Content!",
+			Data:   err.Error(),
+		}
+		encoder.Encode(webResponse)
 	} else {
 		w.WriteHeader(http.StatusInternalServerError)
 		encoder := json.NewEncoder(w)
@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"image"
+)
+
+// DifferenceHash computes a 64-bit perceptual hash of img: the image is reduced
+// to a 9x8 grayscale grid and each bit records whether a cell is darker than
+// its right-hand neighbour. Re-encoded, resized or slightly edited copies of an
+// image end up a small Hamming distance apart.
+func DifferenceHash(img image.Image) uint64 {
+	const columns, rows = 9, 8
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	var grid [rows][columns]float64
+	for row := 0; row < rows; row++ {
+		y0 := bounds.Min.Y + row*height/rows
+		y1 := max(bounds.Min.Y+(row+1)*height/rows, y0+1)
+		for column := 0; column < columns; column++ {
+			x0 := bounds.Min.X + column*width/columns
+			x1 := max(bounds.Min.X+(column+1)*width/columns, x0+1)
+			grid[row][column] = averageLuminance(img, x0, y0, min(x1, bounds.Max.X), min(y1, bounds.Max.Y))
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns-1; column++ {
+			hash <<= 1
+			if grid[row][column] < grid[row][column+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// averageLuminance samples at most 16x16 pixels of the cell so large images
+// stay cheap to hash.
+func averageLuminance(img image.Image, x0, y0, x1, y1 int) float64 {
+	stepX := max((x1-x0)/16, 1)
+	stepY := max((y1-y0)/16, 1)
+
+	var sum float64
+	var count int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
@@ -0,0 +1,50 @@
+package helper
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+// testPattern draws a smooth grayscale pattern so the hash does not depend on
+// where cell boundaries fall.
+func testPattern(width, height int, mirrored bool) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			if mirrored {
+				fx = 1 - fx
+			}
+			value := 128 + 100*math.Sin(3*math.Pi*fx+math.Pi*fy)
+			img.SetGray(x, y, color.Gray{Y: uint8(value)})
+		}
+	}
+	return img
+}
+
+func TestDifferenceHashSurvivesResizing(t *testing.T) {
+	original := DifferenceHash(testPattern(320, 240, false))
+	resized := DifferenceHash(testPattern(1280, 960, false))
+	if distance := bits.OnesCount64(original ^ resized); distance > 4 {
+		t.Errorf("resized copy is %d bits away, want at most 4", distance)
+	}
+}
+
+func TestDifferenceHashSeparatesDifferentImages(t *testing.T) {
+	original := DifferenceHash(testPattern(320, 240, false))
+	mirrored := DifferenceHash(testPattern(320, 240, true))
+	if distance := bits.OnesCount64(original ^ mirrored); distance < 32 {
+		t.Errorf("mirrored image is only %d bits away", distance)
+	}
+}
+
+func TestDifferenceHashHandlesTinyImages(t *testing.T) {
+	if hash := DifferenceHash(image.NewGray(image.Rect(0, 0, 0, 0))); hash != 0 {
+		t.Errorf("empty image hashed to %016x, want 0", hash)
+	}
+	// Smaller than the 9x8 grid; must not read outside the bounds.
+	DifferenceHash(testPattern(3, 2, false))
+}
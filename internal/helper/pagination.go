@@ -0,0 +1,32 @@
+package helper
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ParsePagination reads the limit and offset query parameters, falling back to
+// the defaults for missing or malformed values.
+func ParsePagination(request *http.Request) (int, int) {
+	query := request.URL.Query()
+
+	limit, limitErr := strconv.Atoi(query.Get("limit"))
+	if limitErr != nil || limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	offset, offsetErr := strconv.Atoi(query.Get("offset"))
+	if offsetErr != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+// Token purposes mark special-use tokens such as the short-lived token handed
+// out between the password step and the TOTP step of a login. Only tokens
+// without a purpose are accepted as access tokens.
+const (
+	TokenPurposeTwoFactor = "2fa"
+	TokenPurposeOIDCState = "oidc-state"
+	TokenPurposeExport    = "export"
+	// TokenPurposeUnsubscribe tokens carry the notification category in Scope
+	// and do not expire, so links in old emails keep working.
+	TokenPurposeUnsubscribe = "unsubscribe"
+)
+
+type Claims struct {
+	Purpose string `json:"purpose,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Version int    `json:"ver,omitempty"`
+	Scope   string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func SignToken(secret string, claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	if ttl > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+func ParseToken(secret string, tokenString string) (*Claims, error) {
+	var claims Claims
+	if parseErr := ParseTokenClaims(secret, tokenString, &claims); parseErr != nil {
+		return nil, parseErr
+	}
+	return &claims, nil
+}
+
+func ParseTokenClaims(secret string, tokenString string, claims jwt.Claims) error {
+	token, parseErr := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(secret), nil
+	})
+	if parseErr != nil {
+		return parseErr
+	}
+	if !token.Valid {
+		return ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from RFC 6238 appendix B.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; a 6-digit code is their last six digits.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, vector := range vectors {
+		step, valid := ValidateTOTP(rfc6238Secret, vector.code, time.Unix(vector.unix, 0))
+		if !valid {
+			t.Errorf("code %s at %d was rejected", vector.code, vector.unix)
+			continue
+		}
+		if step != vector.unix/totpPeriod {
+			t.Errorf("code %s at %d returned step %d, want %d", vector.code, vector.unix, step, vector.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPToleratesOneStepOfDrift(t *testing.T) {
+	issuedAt := time.Unix(1111111111, 0)
+	code := totpCode([]byte("12345678901234567890"), uint64(issuedAt.Unix()/totpPeriod))
+	wantStep := issuedAt.Unix() / totpPeriod
+
+	for _, drift := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+		step, valid := ValidateTOTP(rfc6238Secret, code, issuedAt.Add(drift))
+		if !valid || step != wantStep {
+			t.Errorf("drift %s: got step %d valid %v, want step %d", drift, step, valid, wantStep)
+		}
+	}
+	for _, drift := range []time.Duration{-2 * totpPeriod * time.Second, 2 * totpPeriod * time.Second} {
+		if _, valid := ValidateTOTP(rfc6238Secret, code, issuedAt.Add(drift)); valid {
+			t.Errorf("drift %s: code was accepted", drift)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	cases := map[string]struct{ secret, code string }{
+		"wrong code":       {rfc6238Secret, "000000"},
+		"too short":        {rfc6238Secret, "05047"},
+		"too long":         {rfc6238Secret, "0050471"},
+		"empty":            {rfc6238Secret, ""},
+		"undecodable key":  {"not base32!", "050471"},
+		"empty secret":     {"", "050471"},
+		"eight digit code": {rfc6238Secret, "14050471"},
+	}
+	for name, input := range cases {
+		if _, valid := ValidateTOTP(input.secret, input.code, now); valid {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestValidateTOTPIgnoresSpacingAndSecretCase(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	if _, valid := ValidateTOTP(strings.ToLower(rfc6238Secret), " 050471 ", now); !valid {
+		t.Error("code with surrounding spaces and a lower case secret was rejected")
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrips(t *testing.T) {
+	secret, secretErr := GenerateTOTPSecret()
+	if secretErr != nil {
+		t.Fatal(secretErr)
+	}
+	key, decodeErr := totpEncoding.DecodeString(secret)
+	if decodeErr != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), decodeErr)
+	}
+	now := time.Now()
+	if _, valid := ValidateTOTP(secret, totpCode(key, uint64(now.Unix()/totpPeriod)), now); !valid {
+		t.Error("current code for a generated secret was rejected")
+	}
+}
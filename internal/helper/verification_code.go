@@ -2,6 +2,7 @@ package helper
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 )
 
@@ -13,3 +14,11 @@ func GenerateVerificationCode() (string, error) {
 	code := int(num[0])<<16 | int(num[1])<<8 | int(num[2])
 	return fmt.Sprintf("%06d", code%1000000), nil
 }
+
+func GenerateRandomToken(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
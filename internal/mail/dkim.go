@@ -0,0 +1,201 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimSignedHeaders are signed when present in the message. From is required
+// by RFC 6376; the rest keep the visible and unsubscribe headers intact.
+var dkimSignedHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIMSigner adds a DKIM-Signature header using relaxed/relaxed
+// canonicalization (RFC 6376) with an RSA or Ed25519 (RFC 8463) key.
+type DKIMSigner struct {
+	Domain    string
+	Selector  string
+	key       crypto.Signer
+	algorithm string
+}
+
+// LoadDKIMSigner reads a PEM encoded PKCS#1 or PKCS#8 private key from keyPath.
+func LoadDKIMSigner(domain string, selector string, keyPath string) (*DKIMSigner, error) {
+	keyPEM, readErr := os.ReadFile(keyPath)
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read DKIM key: %w", readErr)
+	}
+	return NewDKIMSigner(domain, selector, keyPEM)
+}
+
+func NewDKIMSigner(domain string, selector string, keyPEM []byte) (*DKIMSigner, error) {
+	if domain == "" || selector == "" {
+		return nil, fmt.Errorf("DKIM domain and selector are required")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("DKIM key is not PEM encoded")
+	}
+
+	var parsed any
+	var parseErr error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, parseErr = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, parseErr = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %q", block.Type)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse DKIM key: %w", parseErr)
+	}
+
+	signer := &DKIMSigner{Domain: domain, Selector: selector}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		signer.key, signer.algorithm = key, "rsa-sha256"
+	case ed25519.PrivateKey:
+		signer.key, signer.algorithm = key, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key algorithm %T", parsed)
+	}
+	return signer, nil
+}
+
+// Sign returns message with a DKIM-Signature header prepended.
+func (d *DKIMSigner) Sign(message []byte, now time.Time) ([]byte, error) {
+	headerEnd := bytes.Index(message, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, fmt.Errorf("message has no header/body separator")
+	}
+	fields := splitHeaderFields(message[:headerEnd+2])
+	body := message[headerEnd+4:]
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	var signedNames []string
+	var signedData bytes.Buffer
+	for _, name := range dkimSignedHeaders {
+		field, found := lastHeaderField(fields, name)
+		if !found {
+			continue
+		}
+		signedNames = append(signedNames, strings.ToLower(name))
+		signedData.WriteString(relaxedHeader(field))
+		signedData.WriteString("\r\n")
+	}
+
+	signatureHeader := "DKIM-Signature: v=1; a=" + d.algorithm + "; c=relaxed/relaxed;\r\n" +
+		"\td=" + d.Domain + "; s=" + d.Selector + "; t=" + strconv.FormatInt(now.Unix(), 10) + ";\r\n" +
+		"\th=" + strings.Join(signedNames, ":") + ";\r\n" +
+		"\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n" +
+		"\tb="
+	// The signature covers its own header with an empty b= and no final CRLF.
+	signedData.WriteString(relaxedHeader(signatureHeader))
+
+	digest := sha256.Sum256(signedData.Bytes())
+	var signature []byte
+	var signErr error
+	switch key := d.key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, digest[:])
+	default:
+		signature, signErr = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if signErr != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", signErr)
+	}
+
+	signed := make([]byte, 0, len(signatureHeader)+len(message)+512)
+	signed = append(signed, signatureHeader...)
+	signed = append(signed, foldBase64(base64.StdEncoding.EncodeToString(signature))...)
+	signed = append(signed, "\r\n"...)
+	return append(signed, message...), nil
+}
+
+// splitHeaderFields splits a header block into fields, keeping continuation
+// lines with the field they belong to.
+func splitHeaderFields(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func lastHeaderField(fields []string, name string) (string, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		fieldName, _, found := strings.Cut(fields[i], ":")
+		if found && strings.EqualFold(strings.TrimSpace(fieldName), name) {
+			return fields[i], true
+		}
+	}
+	return "", false
+}
+
+// relaxedHeader canonicalizes one header field per RFC 6376 section 3.4.2,
+// without the trailing CRLF.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + value
+}
+
+// relaxedBody canonicalizes the body per RFC 6376 section 3.4.4.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		collapsed := strings.Join(strings.FieldsFunc(line, isWSP), " ")
+		if len(line) > 0 && isWSP(rune(line[0])) && collapsed != "" {
+			collapsed = " " + collapsed
+		}
+		lines[i] = collapsed
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// foldBase64 breaks the signature into continuation lines; whitespace inside
+// b= is ignored by verifiers.
+func foldBase64(value string) string {
+	var folded strings.Builder
+	for len(value) > base64LineLength-4 {
+		folded.WriteString(value[:base64LineLength-4])
+		folded.WriteString("\r\n\t")
+		value = value[base64LineLength-4:]
+	}
+	folded.WriteString(value)
+	return folded.String()
+}
@@ -0,0 +1,207 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/emersion/go-msgauth/dkim"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMessage(t *testing.T) []byte {
+	t.Helper()
+	message, buildErr := BuildMIME(&Message{
+		From:                Address{Name: "Arkive", Email: "no-reply@arkive.test"},
+		To:                  Address{Name: "Ana Souza", Email: "ana@example.com"},
+		Subject:             "Verifique sua conta — código 123456",
+		Text:                "Your code is 123456.\r\n\r\nTrailing spaces   \r\n",
+		HTML:                "<p>Your code is <b>123456</b>.</p>",
+		ListUnsubscribe:     []string{"https://arkive.test/unsubscribe?token=abc"},
+		OneClickUnsubscribe: true,
+	}, time.Now())
+	if buildErr != nil {
+		t.Fatalf("BuildMIME: %v", buildErr)
+	}
+	return message
+}
+
+// verify checks the signature with an independent implementation, serving the
+// public key the way it would be published in DNS.
+func verify(t *testing.T, signed []byte, record string) *dkim.Verification {
+	t.Helper()
+	verifications, verifyErr := dkim.VerifyWithOptions(bytes.NewReader(signed), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "mail._domainkey.arkive.test" {
+				return nil, fmt.Errorf("unexpected lookup of %q", domain)
+			}
+			return []string{record}, nil
+		},
+	})
+	if verifyErr != nil {
+		t.Fatalf("Verify: %v", verifyErr)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("got %d signatures, want 1", len(verifications))
+	}
+	return verifications[0]
+}
+
+func TestDKIMSignerRSA(t *testing.T) {
+	key, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	if keyErr != nil {
+		t.Fatal(keyErr)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	signer, signerErr := NewDKIMSigner("arkive.test", "mail", keyPEM)
+	if signerErr != nil {
+		t.Fatalf("NewDKIMSigner: %v", signerErr)
+	}
+
+	signed, signErr := signer.Sign(testMessage(t), time.Now())
+	if signErr != nil {
+		t.Fatalf("Sign: %v", signErr)
+	}
+
+	publicKey, marshalErr := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	verification := verify(t, signed, "v=DKIM1; k=rsa; p="+base64.StdEncoding.EncodeToString(publicKey))
+	if verification.Err != nil {
+		t.Fatalf("signature did not verify: %v", verification.Err)
+	}
+	if verification.Domain != "arkive.test" {
+		t.Errorf("domain = %q, want arkive.test", verification.Domain)
+	}
+	for _, name := range []string{"from", "to", "subject", "list-unsubscribe", "list-unsubscribe-post"} {
+		if !containsFold(verification.HeaderKeys, name) {
+			t.Errorf("%s is not signed; signed headers: %v", name, verification.HeaderKeys)
+		}
+	}
+}
+
+func TestDKIMSignerEd25519(t *testing.T) {
+	publicKey, key, keyErr := ed25519.GenerateKey(rand.Reader)
+	if keyErr != nil {
+		t.Fatal(keyErr)
+	}
+	der, marshalErr := x509.MarshalPKCS8PrivateKey(key)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	signer, signerErr := NewDKIMSigner("arkive.test", "mail", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if signerErr != nil {
+		t.Fatalf("NewDKIMSigner: %v", signerErr)
+	}
+
+	signed, signErr := signer.Sign(testMessage(t), time.Now())
+	if signErr != nil {
+		t.Fatalf("Sign: %v", signErr)
+	}
+
+	record := "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(publicKey)
+	if verification := verify(t, signed, record); verification.Err != nil {
+		t.Fatalf("signature did not verify: %v", verification.Err)
+	}
+}
+
+func TestDKIMSignerDetectsTampering(t *testing.T) {
+	publicKey, key, keyErr := ed25519.GenerateKey(rand.Reader)
+	if keyErr != nil {
+		t.Fatal(keyErr)
+	}
+	der, marshalErr := x509.MarshalPKCS8PrivateKey(key)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	signer, signerErr := NewDKIMSigner("arkive.test", "mail", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if signerErr != nil {
+		t.Fatalf("NewDKIMSigner: %v", signerErr)
+	}
+
+	signed, signErr := signer.Sign(testMessage(t), time.Now())
+	if signErr != nil {
+		t.Fatalf("Sign: %v", signErr)
+	}
+	tampered := bytes.Replace(signed, []byte("Subject: "), []byte("Subject: Re: "), 1)
+
+	record := "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(publicKey)
+	if verification := verify(t, tampered, record); verification.Err == nil {
+		t.Fatal("tampered message verified")
+	}
+}
+
+func TestNewDKIMSignerRejectsBadKeys(t *testing.T) {
+	if _, signerErr := NewDKIMSigner("arkive.test", "mail", []byte("not a key")); signerErr == nil {
+		t.Error("accepted a key that is not PEM encoded")
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{0}})
+	if _, signerErr := NewDKIMSigner("arkive.test", "mail", block); signerErr == nil {
+		t.Error("accepted an unsupported key type")
+	}
+	if _, signerErr := NewDKIMSigner("", "mail", block); signerErr == nil {
+		t.Error("accepted an empty domain")
+	}
+}
+
+func containsFold(values []string, want string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// The canonicalization cases below include the examples in RFC 6376 section
+// 3.4.5.
+func TestRelaxedHeader(t *testing.T) {
+	cases := map[string]string{
+		"A: X\r\n":                     "a:X",
+		"B : Y\t\r\n\tZ  \r\n":         "b:Y Z",
+		"Subject:  two  spaces \r\n":   "subject:two spaces",
+		"List-Unsubscribe-Post:\r\n":   "list-unsubscribe-post:",
+		"X-Folded: one\r\n two\r\n\t3": "x-folded:one two 3",
+	}
+	for field, want := range cases {
+		if got := relaxedHeader(field); got != want {
+			t.Errorf("relaxedHeader(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestRelaxedBody(t *testing.T) {
+	cases := map[string]string{
+		" C \r\nD \t E\r\n\r\n\r\n": " C\r\nD E\r\n",
+		"no trailing newline":       "no trailing newline\r\n",
+		"a\r\n\r\nb\r\n":            "a\r\n\r\nb\r\n",
+		"\t \r\n":                   "",
+		"":                          "",
+	}
+	for body, want := range cases {
+		if got := string(relaxedBody([]byte(body))); got != want {
+			t.Errorf("relaxedBody(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestLastHeaderFieldKeepsContinuationLines(t *testing.T) {
+	fields := splitHeaderFields([]byte("To: a@example.com\r\nSubject: first\r\nsubject: second\r\n\tline\r\n"))
+	if len(fields) != 3 {
+		t.Fatalf("split into %d fields, want 3: %q", len(fields), fields)
+	}
+	field, found := lastHeaderField(fields, "SUBJECT")
+	if !found || field != "subject: second\r\n\tline\r\n" {
+		t.Errorf("lastHeaderField = %q, %v; want the last subject with its continuation", field, found)
+	}
+	if _, found := lastHeaderField(fields, "Cc"); found {
+		t.Error("found a header that is not there")
+	}
+}
@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	netmail "net/mail"
+	"time"
+)
+
+type Address struct {
+	Name  string
+	Email string
+}
+
+// String formats the address for a header, encoding a non-ASCII name as an
+// RFC 2047 encoded-word.
+func (a Address) String() string {
+	return (&netmail.Address{Name: a.Name, Address: a.Email}).String()
+}
+
+// InlineImage is an image the HTML body references as cid:<ContentID>.
+type InlineImage struct {
+	ContentID   string `json:"content_id"`
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename"`
+	Data        []byte `json:"data"`
+}
+
+// Message is a transactional email with a plain text and an HTML body.
+type Message struct {
+	From    Address
+	To      Address
+	Subject string
+	Text    string
+	HTML    string
+	// ListUnsubscribe holds https: and mailto: URIs for the List-Unsubscribe
+	// header; OneClickUnsubscribe adds List-Unsubscribe-Post (RFC 8058).
+	ListUnsubscribe     []string
+	OneClickUnsubscribe bool
+	Inline              []InlineImage
+	// SentAt is only filled in by the outboxes.
+	SentAt time.Time
+}
+
+// Mailer delivers a message through one transport.
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
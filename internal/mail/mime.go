@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// base64LineLength is the longest encoded line RFC 2045 allows.
+const base64LineLength = 76
+
+// BuildMIME renders message as an RFC 5322 message: a multipart/alternative
+// text and HTML body, wrapped in multipart/related when there are inline
+// images. Bodies are quoted-printable, non-ASCII headers are RFC 2047 encoded
+// and every part boundary is random.
+func BuildMIME(message *Message, now time.Time) ([]byte, error) {
+	messageID, idErr := newMessageID(message.From.Email)
+	if idErr != nil {
+		return nil, idErr
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", message.From.String())
+	header("To", foldEncodedWords(message.To.String()))
+	header("Subject", foldEncodedWords(mime.QEncoding.Encode("utf-8", message.Subject)))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	header("MIME-Version", "1.0")
+	if len(message.ListUnsubscribe) > 0 {
+		uris := make([]string, 0, len(message.ListUnsubscribe))
+		for _, uri := range message.ListUnsubscribe {
+			uris = append(uris, "<"+uri+">")
+		}
+		header("List-Unsubscribe", strings.Join(uris, ", "))
+		if message.OneClickUnsubscribe {
+			header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		}
+	}
+
+	alternative, altErr := buildAlternative(message)
+	if altErr != nil {
+		return nil, altErr
+	}
+
+	if len(message.Inline) == 0 {
+		header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.boundary}))
+		buf.WriteString("\r\n")
+		buf.Write(alternative.body)
+		return buf.Bytes(), nil
+	}
+
+	related := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/related", map[string]string{
+		"boundary": related.Boundary(),
+		"type":     "multipart/alternative",
+	}))
+	buf.WriteString("\r\n")
+
+	altPart, partErr := related.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.boundary})},
+	})
+	if partErr != nil {
+		return nil, partErr
+	}
+	if _, writeErr := altPart.Write(alternative.body); writeErr != nil {
+		return nil, writeErr
+	}
+
+	for _, image := range message.Inline {
+		imagePart, imageErr := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {image.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + image.ContentID + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": image.Filename})},
+		})
+		if imageErr != nil {
+			return nil, imageErr
+		}
+		if writeErr := writeBase64Lines(imagePart, image.Data); writeErr != nil {
+			return nil, writeErr
+		}
+	}
+	if closeErr := related.Close(); closeErr != nil {
+		return nil, closeErr
+	}
+	return buf.Bytes(), nil
+}
+
+type multipartBody struct {
+	boundary string
+	body     []byte
+}
+
+func buildAlternative(message *Message) (*multipartBody, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	for _, body := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		part, partErr := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if partErr != nil {
+			return nil, partErr
+		}
+		encoder := quotedprintable.NewWriter(part)
+		if _, writeErr := encoder.Write([]byte(body.content)); writeErr != nil {
+			return nil, writeErr
+		}
+		if closeErr := encoder.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+	}
+	if closeErr := writer.Close(); closeErr != nil {
+		return nil, closeErr
+	}
+	return &multipartBody{boundary: writer.Boundary(), body: buf.Bytes()}, nil
+}
+
+func writeBase64Lines(part io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		line := encoded
+		if len(line) > base64LineLength {
+			line = encoded[:base64LineLength]
+		}
+		encoded = encoded[len(line):]
+		if _, writeErr := part.Write([]byte(line + "\r\n")); writeErr != nil {
+			return writeErr
+		}
+	}
+	return nil
+}
+
+// foldEncodedWords puts each RFC 2047 encoded-word of a long header on its own
+// continuation line to stay within the 78 character line limit.
+func foldEncodedWords(value string) string {
+	return strings.ReplaceAll(value, "?= =?", "?=\r\n =?")
+}
+
+// newMessageID returns a random Message-ID in the sender's domain.
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	random := make([]byte, 16)
+	if _, randErr := rand.Read(random); randErr != nil {
+		return "", fmt.Errorf("failed to generate message id: %w", randErr)
+	}
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(random), time.Now().UnixNano(), domain), nil
+}
@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryOutbox keeps sent messages in memory so tests can assert on them.
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (m *MemoryOutbox) Send(ctx context.Context, message *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sent := *message
+	sent.SentAt = time.Now()
+	m.messages = append(m.messages, sent)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far, oldest first.
+func (m *MemoryOutbox) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func (m *MemoryOutbox) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// FileOutbox writes every message as an .eml file into Dir, for local runs
+// without a mail provider; the files open in any mail client.
+type FileOutbox struct {
+	Dir string
+}
+
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if mkdirErr := os.MkdirAll(dir, 0o700); mkdirErr != nil {
+		return nil, fmt.Errorf("failed to create outbox dir: %w", mkdirErr)
+	}
+	return &FileOutbox{Dir: dir}, nil
+}
+
+func (f *FileOutbox) Send(ctx context.Context, message *Message) error {
+	sent := *message
+	sent.SentAt = time.Now()
+
+	data, buildErr := BuildMIME(&sent, sent.SentAt)
+	if buildErr != nil {
+		return fmt.Errorf("failed to build message: %w", buildErr)
+	}
+
+	file, createErr := os.CreateTemp(f.Dir, sent.SentAt.UTC().Format("20060102T150405.000000000")+"-*.eml")
+	if createErr != nil {
+		return fmt.Errorf("failed to create outbox file: %w", createErr)
+	}
+	defer file.Close()
+	if _, writeErr := file.Write(data); writeErr != nil {
+		return fmt.Errorf("failed to write outbox file: %w", writeErr)
+	}
+	return nil
+}
+
+var (
+	_ Mailer = (*MemoryOutbox)(nil)
+	_ Mailer = (*FileOutbox)(nil)
+	_ Mailer = (*SMTPMailer)(nil)
+	_ Mailer = (*SendGridMailer)(nil)
+)
@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/meliocool/arkive/internal/tracing"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultSendGridEndpoint = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridMailer sends through the SendGrid v3 HTTP API, for hosts where
+// outbound SMTP ports are blocked.
+type SendGridMailer struct {
+	APIKey   string
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewSendGridMailer(apiKey string) *SendGridMailer {
+	return &SendGridMailer{
+		APIKey:   apiKey,
+		Endpoint: defaultSendGridEndpoint,
+		Client:   &http.Client{Timeout: 10 * time.Second, Transport: tracing.NewTransport(http.DefaultTransport)},
+	}
+}
+
+func (s *SendGridMailer) Send(ctx context.Context, message *Message) error {
+	headers := map[string]string{}
+	if len(message.ListUnsubscribe) > 0 {
+		uris := make([]string, 0, len(message.ListUnsubscribe))
+		for _, uri := range message.ListUnsubscribe {
+			uris = append(uris, "<"+uri+">")
+		}
+		headers["List-Unsubscribe"] = strings.Join(uris, ", ")
+		if message.OneClickUnsubscribe {
+			headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+		}
+	}
+
+	payload := map[string]any{
+		"personalizations": []map[string]any{{
+			"to": []map[string]string{{"email": message.To.Email, "name": message.To.Name}},
+		}},
+		"from":    map[string]string{"email": message.From.Email, "name": message.From.Name},
+		"subject": message.Subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": message.Text},
+			{"type": "text/html", "value": message.HTML},
+		},
+	}
+	if len(headers) > 0 {
+		payload["headers"] = headers
+	}
+	if len(message.Inline) > 0 {
+		attachments := make([]map[string]string, 0, len(message.Inline))
+		for _, image := range message.Inline {
+			attachments = append(attachments, map[string]string{
+				"content":     base64.StdEncoding.EncodeToString(image.Data),
+				"type":        image.ContentType,
+				"filename":    image.Filename,
+				"disposition": "inline",
+				"content_id":  image.ContentID,
+			})
+		}
+		payload["attachments"] = attachments
+	}
+
+	body, marshalErr := json.Marshal(payload)
+	if marshalErr != nil {
+		return fmt.Errorf("failed to encode sendgrid request: %w", marshalErr)
+	}
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if reqErr != nil {
+		return fmt.Errorf("failed to create sendgrid request: %w", reqErr)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sendgrid status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+type SMTPMailer struct {
+	Host, Port         string
+	Username, Password string
+	// DKIM signs outgoing messages when set.
+	DKIM *DKIMSigner
+}
+
+func NewSMTPMailer(host, port, username, password string) *SMTPMailer {
+	return &SMTPMailer{Host: host, Port: port, Username: username, Password: password}
+}
+
+func (s *SMTPMailer) Send(ctx context.Context, message *Message) error {
+	now := time.Now()
+	msg, buildErr := BuildMIME(message, now)
+	if buildErr != nil {
+		return fmt.Errorf("failed to build message: %w", buildErr)
+	}
+	if s.DKIM != nil {
+		signed, signErr := s.DKIM.Sign(msg, now)
+		if signErr != nil {
+			return fmt.Errorf("failed to DKIM sign message: %w", signErr)
+		}
+		msg = signed
+	}
+	addr := net.JoinHostPort(s.Host, s.Port)
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// net/smtp has no context support; the deadline and the close on cancel
+	// keep a relay that stops responding from blocking the caller.
+	if deadline, ok := ctx.Deadline(); ok {
+		if deadlineErr := conn.SetDeadline(deadline); deadlineErr != nil {
+			return deadlineErr
+		}
+	}
+	stopClose := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopClose()
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Quit()
+
+	// STARTTLS upgrade (587)
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsCfg := &tls.Config{ServerName: s.Host}
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return err
+		}
+	}
+
+	// AUTH STUFF
+	if ok, _ := c.Extension("AUTH"); ok {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(message.From.Email); err != nil {
+		return err
+	}
+	if err := c.Rcpt(message.To.Email); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,74 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// stallingRelay accepts connections and never answers, like a relay that has
+// hung after the TCP handshake.
+func stallingRelay(t *testing.T) (string, string) {
+	t.Helper()
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port
+}
+
+func TestSMTPMailerGivesUpOnStalledRelayAtDeadline(t *testing.T) {
+	host, port := stallingRelay(t)
+	mailer := NewSMTPMailer(host, port, "user", "password")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if sendErr := mailer.Send(ctx, testSMTPMessage()); sendErr == nil {
+		t.Fatal("Send succeeded against a relay that never answered")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send returned after %s, want about the 200ms deadline", elapsed)
+	}
+}
+
+func TestSMTPMailerGivesUpOnStalledRelayWhenCancelled(t *testing.T) {
+	host, port := stallingRelay(t)
+	mailer := NewSMTPMailer(host, port, "user", "password")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() { done <- mailer.Send(ctx, testSMTPMessage()) }()
+	select {
+	case sendErr := <-done:
+		if sendErr == nil {
+			t.Fatal("Send succeeded against a relay that never answered")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Send did not return after its context was cancelled")
+	}
+}
+
+func testSMTPMessage() *Message {
+	return &Message{
+		From:    Address{Email: "no-reply@arkive.test"},
+		To:      Address{Email: "ana@example.com"},
+		Subject: "Verify your account",
+		Text:    "Your code is 123456.",
+	}
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "arkive"
+
+// Outcomes recorded for emails leaving the outbox.
+const (
+	EmailQueued = "queued"
+	EmailSent   = "sent"
+	EmailRetry  = "retry"
+	EmailDead   = "dead"
+)
+
+// Operations recorded for calls to Pinata.
+const (
+	IPFSPin   = "pin"
+	IPFSUnpin = "unpin"
+	IPFSFetch = "fetch"
+)
+
+// Metrics holds every collector the service exports on /metrics. All methods
+// may be called on a nil *Metrics, which records nothing.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests   *prometheus.CounterVec
+	httpDuration   *prometheus.HistogramVec
+	uploadBytes    prometheus.Histogram
+	uploadDuration *prometheus.HistogramVec
+	ipfsDuration   *prometheus.HistogramVec
+	ipfsErrors     *prometheus.CounterVec
+	emails         *prometheus.CounterVec
+	droppedEvents  prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent serving HTTP requests, by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		uploadBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "photo_upload_size_bytes",
+			Help:      "Size of stored photo uploads.",
+			Buckets:   prometheus.ExponentialBuckets(64<<10, 4, 8),
+		}),
+		uploadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "photo_upload_duration_seconds",
+			Help:      "Time taken to check, pin and store a photo upload, by outcome.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"outcome"}),
+		ipfsDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ipfs_request_duration_seconds",
+			Help:      "Latency of Pinata and gateway requests, by operation.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"operation"}),
+		ipfsErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ipfs_request_errors_total",
+			Help:      "Failed Pinata and gateway requests, by operation.",
+		}, []string{"operation"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "emails_total",
+			Help:      "Emails queued and delivery attempts, by outcome.",
+		}, []string{"outcome"}),
+		droppedEvents: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_dropped_total",
+			Help:      "Events not delivered to an event stream because it had fallen too far behind.",
+		}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.uploadBytes,
+		m.uploadDuration,
+		m.ipfsDuration,
+		m.ipfsErrors,
+		m.emails,
+		m.droppedEvents,
+	)
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+func (m *Metrics) ObserveRequest(method string, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveUpload records how long an upload took; the size is only recorded
+// for uploads that were stored.
+func (m *Metrics) ObserveUpload(sizeBytes int64, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "stored"
+	if err != nil {
+		outcome = "failed"
+	} else {
+		m.uploadBytes.Observe(float64(sizeBytes))
+	}
+	m.uploadDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveIPFS(operation string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.ipfsDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		m.ipfsErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+func (m *Metrics) ObserveEmail(outcome string) {
+	if m == nil {
+		return
+	}
+	m.emails.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) ObserveDroppedEvent() {
+	if m == nil {
+		return
+	}
+	m.droppedEvents.Inc()
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/meliocool/arkive/internal/logging"
+	"github.com/meliocool/arkive/internal/metrics"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	HeaderRequestID                 = "X-Request-ID"
+	maxRequestIDLength              = 128
+	contextKeyRequestLog contextKey = "requestLog"
+)
+
+// requestLog collects what the access log reports but only inner handlers
+// know: the matched route and the authenticated user.
+type requestLog struct {
+	Route  string
+	UserID string
+}
+
+// Router registers routes on an httprouter.Router, recording each route's
+// pattern so requests can be reported by route rather than by path.
+type Router struct {
+	*httprouter.Router
+}
+
+func NewRouter() *Router {
+	return &Router{Router: httprouter.New()}
+}
+
+func (r *Router) Handle(method string, path string, handle httprouter.Handle) {
+	r.Router.Handle(method, path, func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		if entry, ok := request.Context().Value(contextKeyRequestLog).(*requestLog); ok {
+			entry.Route = path
+		}
+		handle(writer, request, params)
+	})
+}
+
+// Handler registers a plain http.Handler under the route pattern path.
+func (r *Router) Handler(method string, path string, handler http.Handler) {
+	r.Handle(method, path, func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+func (r *Router) GET(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodGet, path, handle)
+}
+
+func (r *Router) POST(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPost, path, handle)
+}
+
+func (r *Router) PUT(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPut, path, handle)
+}
+
+func (r *Router) PATCH(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPatch, path, handle)
+}
+
+func (r *Router) DELETE(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodDelete, path, handle)
+}
+
+// RequestID keeps a caller supplied X-Request-ID, or assigns a new one, and
+// echoes it on the response and in every log record for the request.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(HeaderRequestID)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		writer.Header().Set(HeaderRequestID, requestID)
+		next.ServeHTTP(writer, request.WithContext(logging.WithRequestID(request.Context(), requestID)))
+	})
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < '!' || requestID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs one record per request once it has been served. It must run
+// inside RequestID so the record carries the request ID.
+func AccessLog(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		ctx, entry := withRequestLog(request.Context())
+		recorder := &responseRecorder{ResponseWriter: writer}
+
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		logger.LogAttrs(ctx, slog.LevelInfo, "request",
+			slog.String("method", request.Method),
+			slog.String("route", entry.route()),
+			slog.Int("status", recorder.Status()),
+			slog.Int64("bytes", recorder.Bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("user_id", entry.UserID),
+		)
+	})
+}
+
+// Metrics records the count and duration of requests per route.
+func Metrics(next http.Handler, appMetrics *metrics.Metrics) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		ctx, entry := withRequestLog(request.Context())
+		recorder := &responseRecorder{ResponseWriter: writer}
+
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		appMetrics.ObserveRequest(request.Method, entry.route(), recorder.Status(), time.Since(start))
+	})
+}
+
+// withRequestLog returns the request's requestLog, adding one to ctx when no
+// outer middleware has yet.
+func withRequestLog(ctx context.Context) (context.Context, *requestLog) {
+	if entry, ok := ctx.Value(contextKeyRequestLog).(*requestLog); ok {
+		return ctx, entry
+	}
+	entry := &requestLog{}
+	return context.WithValue(ctx, contextKeyRequestLog, entry), entry
+}
+
+// route is the matched pattern, or "unmatched" for requests no route served,
+// which keeps unknown paths out of metric labels.
+func (e *requestLog) route() string {
+	if e.Route == "" {
+		return "unmatched"
+	}
+	return e.Route
+}
+
+// setRequestUser records the authenticated user for the access log.
+func setRequestUser(ctx context.Context, userID string) {
+	if entry, ok := ctx.Value(contextKeyRequestLog).(*requestLog); ok {
+		entry.UserID = userID
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	StatusCode int
+	Bytes      int64
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.StatusCode == 0 {
+		r.StatusCode = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.StatusCode == 0 {
+		r.StatusCode = http.StatusOK
+	}
+	written, err := r.ResponseWriter.Write(data)
+	r.Bytes += int64(written)
+	return written, err
+}
+
+func (r *responseRecorder) Status() int {
+	if r.StatusCode == 0 {
+		return http.StatusOK
+	}
+	return r.StatusCode
+}
+
+// Flush keeps event streams working through the recorder.
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"github.com/meliocool/arkive/internal/helper"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const HeaderForwardedFor = "X-Forwarded-For"
+
+// ClientIP resolves the client address that helper.ClientIP reports, and with
+// it what login throttling is keyed on. X-Forwarded-For is only believed when
+// the connection comes from one of trustedProxies, and is read from the right,
+// skipping trusted hops, so a client cannot pick its own address by sending
+// the header itself.
+func ClientIP(next http.Handler, trustedProxies []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if len(trustedProxies) > 0 {
+			if clientIP, ok := forwardedClientIP(request, trustedProxies); ok {
+				request = request.WithContext(helper.WithClientIP(request.Context(), clientIP.String()))
+			}
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+func forwardedClientIP(request *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	peer, parseErr := netip.ParseAddr(helper.RemoteIP(request))
+	if parseErr != nil || !isTrustedProxy(peer.Unmap(), trustedProxies) {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, header := range request.Header.Values(HeaderForwardedFor) {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := peer.Unmap()
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, hopErr := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if hopErr != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !isTrustedProxy(client, trustedProxies) {
+			break
+		}
+	}
+	return client, true
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"context"
-	"github.com/golang-jwt/jwt/v5"
+	"errors"
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/meliocool/arkive/internal/helper"
-	"log"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"log/slog"
 	"net/http"
 	"strings"
 )
@@ -13,15 +15,18 @@ import (
 type contextKey string
 
 const (
-	ContextKeyUserID contextKey = "userID"
+	ContextKeyUserID   contextKey = "userID"
+	ContextKeyRole     contextKey = "role"
+	ContextKeyIssuedAt contextKey = "issuedAt"
 )
 
-type Claims struct {
-	UserID string `json:"user_id"`
-	jwt.RegisteredClaims
+// SessionValidator lets AuthMiddleware reject tokens that are still signed
+// correctly but were revoked, e.g. after a suspension or account deletion.
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, userID uuid.UUID, tokenVersion int) error
 }
 
-func AuthMiddleware(next httprouter.Handle, jwtSecret string) httprouter.Handle {
+func AuthMiddleware(next httprouter.Handle, jwtSecret string, sessions SessionValidator) httprouter.Handle {
 	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 		authHeader := strings.TrimSpace(request.Header.Get("Authorization"))
 		if authHeader == "" {
@@ -37,28 +42,74 @@ func AuthMiddleware(next httprouter.Handle, jwtSecret string) httprouter.Handle
 
 		tokenString := strings.TrimSpace(parts[1])
 
-		var claims Claims
+		claims, parseErr := helper.ParseToken(jwtSecret, tokenString)
+		if parseErr != nil {
+			slog.DebugContext(request.Context(), "failed to parse token", "error", parseErr)
+			helper.WriteErr(writer, helper.ErrUnauthorized)
+			return
+		}
 
-		token, parseErr := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(jwtSecret), nil
-		})
+		if claims.Purpose != "" {
+			helper.WriteErr(writer, helper.ErrUnauthorized)
+			return
+		}
 
-		if parseErr != nil {
-			log.Printf("Failed to parse token: %v", parseErr)
+		userID, uuidErr := uuid.Parse(claims.Subject)
+		if uuidErr != nil {
 			helper.WriteErr(writer, helper.ErrUnauthorized)
 			return
 		}
 
-		if !token.Valid {
+		if sessionErr := sessions.ValidateSession(request.Context(), userID, claims.Version); sessionErr != nil {
+			if errors.Is(sessionErr, helper.ErrForbidden) {
+				helper.WriteErr(writer, helper.ErrForbidden)
+				return
+			}
 			helper.WriteErr(writer, helper.ErrUnauthorized)
 			return
 		}
 
+		role := claims.Role
+		if role == "" {
+			role = users.RoleUser
+		}
+
+		setRequestUser(request.Context(), claims.Subject)
 		ctx := context.WithValue(request.Context(), ContextKeyUserID, claims.Subject)
+		ctx = context.WithValue(ctx, ContextKeyRole, role)
+		if claims.IssuedAt != nil {
+			ctx = context.WithValue(ctx, ContextKeyIssuedAt, claims.IssuedAt.Time)
+		}
 
 		next(writer, request.WithContext(ctx), params)
 	}
 }
+
+// RequireRole must run inside AuthMiddleware, which places the caller's role
+// into the request context.
+func RequireRole(next httprouter.Handle, role string) httprouter.Handle {
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		callerRole, ok := request.Context().Value(ContextKeyRole).(string)
+		if !ok {
+			helper.WriteErr(writer, helper.ErrUnauthorized)
+			return
+		}
+		if !users.HasRole(callerRole, role) {
+			helper.WriteErr(writer, helper.ErrForbidden)
+			return
+		}
+		next(writer, request, params)
+	}
+}
+
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(ContextKeyUserID).(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userUUID, parseErr := uuid.Parse(userID)
+	if parseErr != nil {
+		return uuid.Nil, false
+	}
+	return userUUID, true
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/meliocool/arkive/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Tracing opens a server span per request, continuing the caller's trace when
+// it sends a traceparent header. The span is named after the matched route
+// once the router has served the request.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, request.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.URLPath(request.URL.Path),
+				semconv.UserAgentOriginal(request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		ctx, entry := withRequestLog(ctx)
+		recorder := &responseRecorder{ResponseWriter: writer}
+
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		route := entry.route()
+		span.SetName(request.Method + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(recorder.Status()),
+		)
+		if entry.UserID != "" {
+			span.SetAttributes(semconv.EnduserID(entry.UserID))
+		}
+		if recorder.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.Status()))
+		}
+	})
+}
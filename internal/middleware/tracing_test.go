@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTracedRouter(t *testing.T) (http.Handler, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+		_ = provider.Shutdown(t.Context())
+	})
+
+	router := NewRouter()
+	router.GET("/photos/:photoId", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		if params.ByName("photoId") == "broken" {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	})
+	return Tracing(router), exporter
+}
+
+func onlySpan(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStub {
+	t.Helper()
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	return spans[0]
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingNamesSpanAfterRoute(t *testing.T) {
+	handler, exporter := newTracedRouter(t)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/photos/3f1c7a52", nil))
+
+	span := onlySpan(t, exporter)
+	if span.Name != "GET /photos/:photoId" {
+		t.Errorf("span name = %q, want %q", span.Name, "GET /photos/:photoId")
+	}
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("span kind = %v, want server", span.SpanKind)
+	}
+	if route, ok := spanAttribute(span, semconv.HTTPRouteKey); !ok || route.AsString() != "/photos/:photoId" {
+		t.Errorf("http.route = %q, want /photos/:photoId", route.AsString())
+	}
+	if status, ok := spanAttribute(span, semconv.HTTPResponseStatusCodeKey); !ok || status.AsInt64() != http.StatusOK {
+		t.Errorf("http.response.status_code = %d, want 200", status.AsInt64())
+	}
+	if span.Status.Code == codes.Error {
+		t.Error("successful request was marked as an error")
+	}
+}
+
+func TestTracingMarksServerErrors(t *testing.T) {
+	handler, exporter := newTracedRouter(t)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/photos/broken", nil))
+
+	if span := onlySpan(t, exporter); span.Status.Code != codes.Error {
+		t.Errorf("span status = %v, want error", span.Status.Code)
+	}
+}
+
+func TestTracingContinuesCallerTrace(t *testing.T) {
+	handler, exporter := newTracedRouter(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/photos/3f1c7a52", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	span := onlySpan(t, exporter)
+	if traceID := span.SpanContext.TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", traceID)
+	}
+	if parentID := span.Parent.SpanID().String(); parentID != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s, want the caller's", parentID)
+	}
+}
+
+func TestTracingNamesUnmatchedRequests(t *testing.T) {
+	handler, exporter := newTracedRouter(t)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/no/such/route", nil))
+
+	if span := onlySpan(t, exporter); span.Name != "GET unmatched" {
+		t.Errorf("span name = %q, want %q", span.Name, "GET unmatched")
+	}
+}
@@ -0,0 +1,44 @@
+package blocklist
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	KindSHA256     = "sha256"
+	KindPerceptual = "phash"
+)
+
+type BlockedHash struct {
+	ID        uuid.UUID
+	Kind      string
+	Value     string
+	Note      string
+	AddedBy   *uuid.UUID
+	CreatedAt time.Time
+}
+
+// Attempt is an upload that was rejected because it matched the blocklist.
+type Attempt struct {
+	ID             uuid.UUID
+	UserID         uuid.UUID
+	BlockedHashID  *uuid.UUID
+	SHA256         string
+	PerceptualHash string
+	Filename       string
+	CreatedAt      time.Time
+}
+
+type BlocklistRepository interface {
+	// Add reports false when the hash was already blocked.
+	Add(ctx context.Context, hash *BlockedHash) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context, limit int, offset int) ([]*BlockedHash, error)
+	// FindByValue returns nil without an error when the value is not blocked.
+	FindByValue(ctx context.Context, kind string, value string) (*BlockedHash, error)
+	ListByKind(ctx context.Context, kind string) ([]*BlockedHash, error)
+	RecordAttempt(ctx context.Context, attempt *Attempt) error
+	ListAttempts(ctx context.Context, limit int, offset int) ([]*Attempt, error)
+}
@@ -0,0 +1,35 @@
+package comments
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+type Comment struct {
+	ID             uuid.UUID
+	PhotoID        uuid.UUID
+	UserID         uuid.UUID
+	ParentID       *uuid.UUID
+	Body           string
+	HiddenAt       *time.Time
+	EditedAt       *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	AuthorUsername string
+}
+
+type CommentRepository interface {
+	Create(ctx context.Context, comment *Comment) (*Comment, error)
+	FindByID(ctx context.Context, commentID uuid.UUID) (*Comment, error)
+	UpdateBody(ctx context.Context, commentID uuid.UUID, body string) error
+	SetHidden(ctx context.Context, commentID uuid.UUID, hidden bool) error
+	Delete(ctx context.Context, commentID uuid.UUID) error
+	// ListTopLevel and ListReplies skip hidden comments and comments by
+	// accounts that are suspended or being deleted.
+	ListTopLevel(ctx context.Context, photoID uuid.UUID, limit int, offset int) ([]*Comment, error)
+	ListReplies(ctx context.Context, parentIDs []uuid.UUID) ([]*Comment, error)
+	// ListHidden returns the photo's hidden comments and replies, most
+	// recently hidden first.
+	ListHidden(ctx context.Context, photoID uuid.UUID, limit int, offset int) ([]*Comment, error)
+}
@@ -0,0 +1,35 @@
+package deletions
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+)
+
+type AccountDeletionJob struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Email         string
+	Username      string
+	Locale        string
+	Status        string
+	Attempts      int
+	UnpinnedCIDs  []string
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	CompletedAt   *time.Time
+}
+
+type AccountDeletionRepository interface {
+	Create(ctx context.Context, job *AccountDeletionJob) (*AccountDeletionJob, error)
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*AccountDeletionJob, error)
+	AddUnpinned(ctx context.Context, jobID uuid.UUID, ipfsCID string) error
+	MarkCompleted(ctx context.Context, jobID uuid.UUID) error
+	MarkRetry(ctx context.Context, jobID uuid.UUID, lastError string, nextAttemptAt time.Time) error
+}
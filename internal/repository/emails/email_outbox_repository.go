@@ -0,0 +1,63 @@
+package emails
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	// StatusDead marks an email that ran out of delivery attempts.
+	StatusDead = "dead"
+)
+
+// InlineImage is stored as JSON; Data is base64 encoded by encoding/json.
+type InlineImage struct {
+	ContentID   string `json:"content_id"`
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename"`
+	Data        []byte `json:"data"`
+}
+
+type OutboxEmail struct {
+	ID        uuid.UUID
+	ToEmail   string
+	ToName    string
+	FromEmail string
+	FromName  string
+	Subject   string
+	TextBody  string
+	HTMLBody  string
+	// ListUnsubscribe and OneClickUnsubscribe become the List-Unsubscribe
+	// headers of the message.
+	ListUnsubscribe     []string
+	OneClickUnsubscribe bool
+	InlineImages        []InlineImage
+	Status              string
+	Attempts            int
+	LastError           string
+	NextAttemptAt       time.Time
+	CreatedAt           time.Time
+	SentAt              *time.Time
+}
+
+type EmailOutboxRepository interface {
+	Enqueue(ctx context.Context, email *OutboxEmail) (*OutboxEmail, error)
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEmail, error)
+	MarkSent(ctx context.Context, id uuid.UUID) error
+	MarkRetry(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error
+	MarkDead(ctx context.Context, id uuid.UUID, lastError string) error
+	// Release makes a claimed email due again and gives back the attempt the
+	// claim counted, for emails that were never handed to the mailer.
+	Release(ctx context.Context, id uuid.UUID) error
+	ListDead(ctx context.Context, limit int, offset int) ([]*OutboxEmail, error)
+	// Requeue makes a dead email due again with a fresh set of attempts.
+	Requeue(ctx context.Context, id uuid.UUID) error
+	// DeleteSent removes emails delivered more than retention ago.
+	DeleteSent(ctx context.Context, retention time.Duration) (int64, error)
+	// ExpirePending dead-letters emails that are not claimed and were queued
+	// more than maxAge ago.
+	ExpirePending(ctx context.Context, maxAge time.Duration, lastError string) (int64, error)
+}
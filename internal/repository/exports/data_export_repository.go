@@ -0,0 +1,45 @@
+package exports
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// ErrExportInProgress is returned by Create when the user already has a
+// pending export.
+var ErrExportInProgress = errors.New("data export already in progress")
+
+type DataExport struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Status        string
+	Attempts      int
+	FilePath      string
+	SizeBytes     int64
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	CompletedAt   *time.Time
+	ExpiresAt     *time.Time
+}
+
+type DataExportRepository interface {
+	Create(ctx context.Context, userID uuid.UUID) (*DataExport, error)
+	FindByID(ctx context.Context, exportID uuid.UUID) (*DataExport, error)
+	FindPendingByUserID(ctx context.Context, userID uuid.UUID) (*DataExport, error)
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*DataExport, error)
+	MarkReady(ctx context.Context, exportID uuid.UUID, filePath string, sizeBytes int64, expiresAt time.Time) error
+	MarkRetry(ctx context.Context, exportID uuid.UUID, lastError string, nextAttemptAt time.Time) error
+	MarkFailed(ctx context.Context, exportID uuid.UUID, lastError string) error
+	DeleteExpired(ctx context.Context) ([]string, error)
+	FindFilePathsByUserID(ctx context.Context, userID uuid.UUID) ([]string, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
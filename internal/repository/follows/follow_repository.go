@@ -0,0 +1,15 @@
+package follows
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+type FollowRepository interface {
+	// Follow and Unfollow report whether the relationship actually changed.
+	Follow(ctx context.Context, followerID uuid.UUID, followeeID uuid.UUID) (bool, error)
+	Unfollow(ctx context.Context, followerID uuid.UUID, followeeID uuid.UUID) (bool, error)
+	ListFollowers(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error)
+	ListFollowing(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error)
+}
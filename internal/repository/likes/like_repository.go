@@ -0,0 +1,13 @@
+package likes
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type LikeRepository interface {
+	// Like and Unlike report whether the like actually changed, and keep the
+	// photo's like count in step.
+	Like(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (bool, error)
+	Unlike(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (bool, error)
+}
@@ -0,0 +1,72 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+const (
+	ActionHide            = "hide"
+	ActionUnhide          = "unhide"
+	ActionRemove          = "remove"
+	ActionRemoveAndBlock  = "remove_and_block"
+	ActionSuspendUploader = "suspend_uploader"
+	ActionDismiss         = "dismiss"
+	ActionSuspendUser     = "suspend_user"
+	ActionUnsuspendUser   = "unsuspend_user"
+)
+
+var ErrAlreadyReported = errors.New("photo already reported by this user")
+
+type Report struct {
+	ID         uuid.UUID
+	PhotoID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ResolvedBy *uuid.UUID
+	ResolvedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// QueueItem groups the open reports against one photo.
+type QueueItem struct {
+	PhotoID         uuid.UUID
+	UploaderID      uuid.UUID
+	Filename        string
+	IPFSCid         string
+	HiddenAt        *time.Time
+	ReportCount     int
+	Reasons         []string
+	FirstReportedAt time.Time
+	LastReportedAt  time.Time
+}
+
+type Action struct {
+	ID           uuid.UUID
+	ModeratorID  uuid.UUID
+	Action       string
+	PhotoID      *uuid.UUID
+	TargetUserID *uuid.UUID
+	Note         string
+	CreatedAt    time.Time
+}
+
+type ModerationRepository interface {
+	CreateReport(ctx context.Context, report *Report) (*Report, error)
+	// ListQueue returns photos with open reports, the most reported first.
+	ListQueue(ctx context.Context, limit int, offset int) ([]*QueueItem, error)
+	ListOpenReports(ctx context.Context, photoID uuid.UUID) ([]*Report, error)
+	ResolveReports(ctx context.Context, photoID uuid.UUID, moderatorID uuid.UUID, status string) (int64, error)
+	RecordAction(ctx context.Context, action *Action) error
+	ListActions(ctx context.Context, limit int, offset int) ([]*Action, error)
+}
@@ -0,0 +1,36 @@
+package notifications
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+)
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Type      string
+	Title     string
+	Body      string
+	Data      map[string]any
+	ReadAt    *time.Time
+	CreatedAt time.Time
+}
+
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *Notification) (*Notification, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int, offset int) ([]*Notification, error)
+	CountUnread(ctx context.Context, userID uuid.UUID) (int, error)
+	// MarkRead marks the given notifications of userID as read, or all of them
+	// when ids is empty, and reports how many changed.
+	MarkRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int64, error)
+	// Preferences returns the explicitly stored choices keyed by category and
+	// then by channel.
+	Preferences(ctx context.Context, userID uuid.UUID) (map[string]map[string]bool, error)
+	SetPreference(ctx context.Context, userID uuid.UUID, category string, channel string, enabled bool) error
+}
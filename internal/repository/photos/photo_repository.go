@@ -7,17 +7,40 @@ import (
 )
 
 type Photo struct {
-	ID        uuid.UUID
-	IPFSCid   string
-	Filename  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	UserID    uuid.UUID
+	ID               uuid.UUID
+	IPFSCid          string
+	Filename         string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           uuid.UUID
+	SizeBytes        int64
+	LikeCount        int
+	CommentsDisabled bool
+	HiddenAt         *time.Time
+}
+
+type Usage struct {
+	PhotoCount int
+	TotalBytes int64
 }
 
 type PhotoRepository interface {
 	Create(ctx context.Context, photo *Photo) (*Photo, error)
+	FindByID(ctx context.Context, photoID uuid.UUID) (*Photo, error)
 	FindByUserID(ctx context.Context, userID uuid.UUID) ([]*Photo, error)
+	FindFeed(ctx context.Context, followerID uuid.UUID, limit int, offset int) ([]*Photo, error)
+	FindLikedByUser(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*Photo, error)
+	FindPopular(ctx context.Context, since time.Time, limit int, offset int) ([]*Photo, error)
 	Delete(ctx context.Context, photoID uuid.UUID) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	SetCommentsDisabled(ctx context.Context, photoID uuid.UUID, disabled bool) error
+	SetHidden(ctx context.Context, photoID uuid.UUID, hidden bool) error
+	// FindAll returns every photo that has not been hidden by moderation and
+	// whose owner is visible.
 	FindAll(ctx context.Context) ([]*Photo, error)
+	UsageByUserID(ctx context.Context, userID uuid.UUID) (*Usage, error)
+	// Pinata hands out the same CID for identical content, so a pin can back
+	// photos of several users and must only be removed with the last of them.
+	IsCIDInUse(ctx context.Context, ipfsCID string) (bool, error)
+	IsCIDSharedWithOthers(ctx context.Context, ipfsCID string, userID uuid.UUID) (bool, error)
 }
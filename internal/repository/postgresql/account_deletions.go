@@ -0,0 +1,111 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/deletions"
+	"time"
+)
+
+const accountDeletionColumns = `id, user_id, email, username, locale, status, attempts, unpinned_cids, last_error, next_attempt_at,
+	created_at, completed_at`
+
+type AccountDeletionRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAccountDeletionRepo(pool *pgxpool.Pool) *AccountDeletionRepo {
+	return &AccountDeletionRepo{db: pool}
+}
+
+func scanAccountDeletion(row pgx.Row, job *deletions.AccountDeletionJob) error {
+	return row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Email,
+		&job.Username,
+		&job.Locale,
+		&job.Status,
+		&job.Attempts,
+		&job.UnpinnedCIDs,
+		&job.LastError,
+		&job.NextAttemptAt,
+		&job.CreatedAt,
+		&job.CompletedAt,
+	)
+}
+
+func (a *AccountDeletionRepo) Create(ctx context.Context, job *deletions.AccountDeletionJob) (*deletions.AccountDeletionJob, error) {
+	SQL := `INSERT INTO account_deletion_jobs (user_id, email, username, locale)
+			VALUES ($1, $2, $3, $4)
+			RETURNING ` + accountDeletionColumns
+
+	var newJob deletions.AccountDeletionJob
+	if scanErr := scanAccountDeletion(conn(ctx, a.db).QueryRow(ctx, SQL, job.UserID, job.Email, job.Username, job.Locale), &newJob); scanErr != nil {
+		return nil, fmt.Errorf("failed to create account deletion job: %w", scanErr)
+	}
+	return &newJob, nil
+}
+
+// ClaimDue pushes next_attempt_at of the returned jobs forward by lease, so a
+// job abandoned by a crashed worker becomes due again once the lease runs out.
+func (a *AccountDeletionRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*deletions.AccountDeletionJob, error) {
+	SQL := `UPDATE account_deletion_jobs SET next_attempt_at = NOW() + $2::interval, attempts = attempts + 1, updated_at = NOW()
+			WHERE id IN (
+				SELECT id FROM account_deletion_jobs
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + accountDeletionColumns
+
+	rows, queryErr := conn(ctx, a.db).Query(ctx, SQL, limit, lease)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to claim account deletion jobs: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var jobs []*deletions.AccountDeletionJob
+	for rows.Next() {
+		var job deletions.AccountDeletionJob
+		if scanErr := scanAccountDeletion(rows, &job); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return jobs, nil
+}
+
+func (a *AccountDeletionRepo) AddUnpinned(ctx context.Context, jobID uuid.UUID, ipfsCID string) error {
+	SQL := `UPDATE account_deletion_jobs SET unpinned_cids = array_append(unpinned_cids, $1), updated_at = NOW()
+			WHERE id = $2`
+	if _, execErr := conn(ctx, a.db).Exec(ctx, SQL, ipfsCID, jobID); execErr != nil {
+		return fmt.Errorf("failed to record unpinned cid: %w", execErr)
+	}
+	return nil
+}
+
+func (a *AccountDeletionRepo) MarkCompleted(ctx context.Context, jobID uuid.UUID) error {
+	SQL := `UPDATE account_deletion_jobs SET status = 'completed', last_error = '', completed_at = NOW(), updated_at = NOW()
+			WHERE id = $1`
+	if _, execErr := conn(ctx, a.db).Exec(ctx, SQL, jobID); execErr != nil {
+		return fmt.Errorf("failed to complete account deletion job: %w", execErr)
+	}
+	return nil
+}
+
+func (a *AccountDeletionRepo) MarkRetry(ctx context.Context, jobID uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	SQL := `UPDATE account_deletion_jobs SET last_error = $1, next_attempt_at = $2, updated_at = NOW() WHERE id = $3`
+	if _, execErr := conn(ctx, a.db).Exec(ctx, SQL, lastError, nextAttemptAt, jobID); execErr != nil {
+		return fmt.Errorf("failed to reschedule account deletion job: %w", execErr)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/blocklist"
+)
+
+const (
+	blockedHashColumns = `id, kind, value, note, added_by, created_at`
+	attemptColumns     = `id, user_id, blocked_hash_id, sha256, phash, filename, created_at`
+)
+
+type BlocklistRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewBlocklistRepo(pool *pgxpool.Pool) *BlocklistRepo {
+	return &BlocklistRepo{db: pool}
+}
+
+func scanBlockedHash(row pgx.Row, hash *blocklist.BlockedHash) error {
+	return row.Scan(
+		&hash.ID,
+		&hash.Kind,
+		&hash.Value,
+		&hash.Note,
+		&hash.AddedBy,
+		&hash.CreatedAt,
+	)
+}
+
+func collectBlockedHashes(rows pgx.Rows) ([]*blocklist.BlockedHash, error) {
+	defer rows.Close()
+
+	var Hashes []*blocklist.BlockedHash
+
+	for rows.Next() {
+		var hash blocklist.BlockedHash
+		if scanErr := scanBlockedHash(rows, &hash); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Hashes = append(Hashes, &hash)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Hashes, nil
+}
+
+func (b *BlocklistRepo) Add(ctx context.Context, hash *blocklist.BlockedHash) (bool, error) {
+	SQL := `INSERT INTO blocked_hashes (kind, value, note, added_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (kind, value) DO NOTHING`
+
+	cmd, execErr := conn(ctx, b.db).Exec(ctx, SQL, hash.Kind, hash.Value, hash.Note, hash.AddedBy)
+	if execErr != nil {
+		return false, fmt.Errorf("failed to add blocked hash: %w", execErr)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+func (b *BlocklistRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	SQL := `DELETE FROM blocked_hashes WHERE id = $1`
+	cmd, execErr := conn(ctx, b.db).Exec(ctx, SQL, id)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("blocked hash does not exist")
+	}
+
+	return nil
+}
+
+func (b *BlocklistRepo) List(ctx context.Context, limit int, offset int) ([]*blocklist.BlockedHash, error) {
+	SQL := `SELECT ` + blockedHashColumns + ` FROM blocked_hashes
+			ORDER BY created_at DESC, id
+			LIMIT $1 OFFSET $2`
+
+	rows, queryErr := conn(ctx, b.db).Query(ctx, SQL, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list blocked hashes: %w", queryErr)
+	}
+	return collectBlockedHashes(rows)
+}
+
+func (b *BlocklistRepo) FindByValue(ctx context.Context, kind string, value string) (*blocklist.BlockedHash, error) {
+	SQL := `SELECT ` + blockedHashColumns + ` FROM blocked_hashes WHERE kind = $1 AND value = $2`
+
+	var hash blocklist.BlockedHash
+	if scanErr := scanBlockedHash(conn(ctx, b.db).QueryRow(ctx, SQL, kind, value), &hash); scanErr != nil {
+		if errors.Is(scanErr, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up blocked hash: %w", scanErr)
+	}
+	return &hash, nil
+}
+
+func (b *BlocklistRepo) ListByKind(ctx context.Context, kind string) ([]*blocklist.BlockedHash, error) {
+	SQL := `SELECT ` + blockedHashColumns + ` FROM blocked_hashes WHERE kind = $1`
+
+	rows, queryErr := conn(ctx, b.db).Query(ctx, SQL, kind)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list blocked hashes: %w", queryErr)
+	}
+	return collectBlockedHashes(rows)
+}
+
+func (b *BlocklistRepo) RecordAttempt(ctx context.Context, attempt *blocklist.Attempt) error {
+	SQL := `INSERT INTO blocked_upload_attempts (user_id, blocked_hash_id, sha256, phash, filename)
+			VALUES ($1, $2, $3, $4, $5)`
+
+	_, execErr := conn(ctx, b.db).Exec(ctx, SQL, attempt.UserID, attempt.BlockedHashID, attempt.SHA256,
+		attempt.PerceptualHash, attempt.Filename)
+	if execErr != nil {
+		return fmt.Errorf("failed to record blocked upload: %w", execErr)
+	}
+	return nil
+}
+
+func (b *BlocklistRepo) ListAttempts(ctx context.Context, limit int, offset int) ([]*blocklist.Attempt, error) {
+	SQL := `SELECT ` + attemptColumns + ` FROM blocked_upload_attempts
+			ORDER BY created_at DESC, id
+			LIMIT $1 OFFSET $2`
+
+	rows, queryErr := conn(ctx, b.db).Query(ctx, SQL, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list blocked uploads: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Attempts []*blocklist.Attempt
+
+	for rows.Next() {
+		var attempt blocklist.Attempt
+		scanErr := rows.Scan(&attempt.ID, &attempt.UserID, &attempt.BlockedHashID, &attempt.SHA256,
+			&attempt.PerceptualHash, &attempt.Filename, &attempt.CreatedAt)
+		if scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Attempts = append(Attempts, &attempt)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Attempts, nil
+}
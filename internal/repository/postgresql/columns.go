@@ -0,0 +1,17 @@
+package postgresql
+
+import "strings"
+
+// visibleUserCondition hides accounts that are suspended or being deleted from
+// listings other users can see. It expects the users table aliased as u.
+const visibleUserCondition = `u.suspended_at IS NULL AND u.deletion_requested_at IS NULL`
+
+// prefixColumns qualifies a comma separated column list with a table alias so
+// the shared column constants can be reused in joins.
+func prefixColumns(alias string, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
+}
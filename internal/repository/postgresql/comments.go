@@ -0,0 +1,170 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/comments"
+)
+
+// commentColumns expects photo_comments aliased as c and users as u.
+const commentColumns = `c.id, c.photo_id, c.user_id, c.parent_id, c.body, c.hidden_at, c.edited_at, c.created_at,
+	c.updated_at, u.username`
+
+type CommentRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewCommentRepo(pool *pgxpool.Pool) *CommentRepo {
+	return &CommentRepo{db: pool}
+}
+
+func scanComment(row pgx.Row, comment *comments.Comment) error {
+	return row.Scan(
+		&comment.ID,
+		&comment.PhotoID,
+		&comment.UserID,
+		&comment.ParentID,
+		&comment.Body,
+		&comment.HiddenAt,
+		&comment.EditedAt,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.AuthorUsername,
+	)
+}
+
+func collectComments(rows pgx.Rows) ([]*comments.Comment, error) {
+	defer rows.Close()
+
+	var Comments []*comments.Comment
+
+	for rows.Next() {
+		var comment comments.Comment
+		if scanErr := scanComment(rows, &comment); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Comments = append(Comments, &comment)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Comments, nil
+}
+
+func (c *CommentRepo) Create(ctx context.Context, comment *comments.Comment) (*comments.Comment, error) {
+	SQL := `WITH c AS (
+				INSERT INTO photo_comments (photo_id, user_id, parent_id, body)
+				VALUES ($1, $2, $3, $4)
+				RETURNING *
+			)
+			SELECT ` + commentColumns + ` FROM c JOIN users u ON u.id = c.user_id`
+
+	var newComment comments.Comment
+	scanErr := scanComment(conn(ctx, c.db).QueryRow(ctx, SQL, comment.PhotoID, comment.UserID, comment.ParentID, comment.Body), &newComment)
+	if scanErr != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", scanErr)
+	}
+	return &newComment, nil
+}
+
+func (c *CommentRepo) FindByID(ctx context.Context, commentID uuid.UUID) (*comments.Comment, error) {
+	SQL := `SELECT ` + commentColumns + ` FROM photo_comments c JOIN users u ON u.id = c.user_id WHERE c.id = $1`
+
+	var comment comments.Comment
+	if scanErr := scanComment(conn(ctx, c.db).QueryRow(ctx, SQL, commentID), &comment); scanErr != nil {
+		return nil, fmt.Errorf("comment not found")
+	}
+	return &comment, nil
+}
+
+func (c *CommentRepo) UpdateBody(ctx context.Context, commentID uuid.UUID, body string) error {
+	SQL := `UPDATE photo_comments SET body = $1, edited_at = NOW(), updated_at = NOW() WHERE id = $2`
+	cmd, execErr := conn(ctx, c.db).Exec(ctx, SQL, body, commentID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("comment does not exist")
+	}
+
+	return nil
+}
+
+func (c *CommentRepo) SetHidden(ctx context.Context, commentID uuid.UUID, hidden bool) error {
+	SQL := `UPDATE photo_comments SET hidden_at = CASE WHEN $1 THEN COALESCE(hidden_at, NOW()) END, updated_at = NOW()
+			WHERE id = $2`
+	cmd, execErr := conn(ctx, c.db).Exec(ctx, SQL, hidden, commentID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("comment does not exist")
+	}
+
+	return nil
+}
+
+func (c *CommentRepo) Delete(ctx context.Context, commentID uuid.UUID) error {
+	SQL := `DELETE FROM photo_comments WHERE id = $1`
+	cmd, execErr := conn(ctx, c.db).Exec(ctx, SQL, commentID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("comment does not exist")
+	}
+
+	return nil
+}
+
+func (c *CommentRepo) ListTopLevel(ctx context.Context, photoID uuid.UUID, limit int, offset int) ([]*comments.Comment, error) {
+	SQL := `SELECT ` + commentColumns + ` FROM photo_comments c
+			JOIN users u ON u.id = c.user_id
+			WHERE c.photo_id = $1 AND c.parent_id IS NULL AND c.hidden_at IS NULL AND ` + visibleUserCondition + `
+			ORDER BY c.created_at, c.id
+			LIMIT $2 OFFSET $3`
+
+	rows, queryErr := conn(ctx, c.db).Query(ctx, SQL, photoID, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", queryErr)
+	}
+	return collectComments(rows)
+}
+
+func (c *CommentRepo) ListReplies(ctx context.Context, parentIDs []uuid.UUID) ([]*comments.Comment, error) {
+	if len(parentIDs) == 0 {
+		return nil, nil
+	}
+
+	SQL := `SELECT ` + commentColumns + ` FROM photo_comments c
+			JOIN users u ON u.id = c.user_id
+			WHERE c.parent_id = ANY($1) AND c.hidden_at IS NULL AND ` + visibleUserCondition + `
+			ORDER BY c.created_at, c.id`
+
+	rows, queryErr := conn(ctx, c.db).Query(ctx, SQL, parentIDs)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list replies: %w", queryErr)
+	}
+	return collectComments(rows)
+}
+
+func (c *CommentRepo) ListHidden(ctx context.Context, photoID uuid.UUID, limit int, offset int) ([]*comments.Comment, error) {
+	SQL := `SELECT ` + commentColumns + ` FROM photo_comments c
+			JOIN users u ON u.id = c.user_id
+			WHERE c.photo_id = $1 AND c.hidden_at IS NOT NULL
+			ORDER BY c.hidden_at DESC, c.id
+			LIMIT $2 OFFSET $3`
+
+	rows, queryErr := conn(ctx, c.db).Query(ctx, SQL, photoID, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list hidden comments: %w", queryErr)
+	}
+	return collectComments(rows)
+}
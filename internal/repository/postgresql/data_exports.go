@@ -0,0 +1,199 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/exports"
+	"time"
+)
+
+const dataExportColumns = `id, user_id, status, attempts, file_path, size_bytes, last_error, next_attempt_at, created_at,
+	completed_at, expires_at`
+
+type DataExportRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewDataExportRepo(pool *pgxpool.Pool) *DataExportRepo {
+	return &DataExportRepo{db: pool}
+}
+
+func scanDataExport(row pgx.Row, export *exports.DataExport) error {
+	return row.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.Attempts,
+		&export.FilePath,
+		&export.SizeBytes,
+		&export.LastError,
+		&export.NextAttemptAt,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+}
+
+func (d *DataExportRepo) Create(ctx context.Context, userID uuid.UUID) (*exports.DataExport, error) {
+	SQL := `INSERT INTO data_exports (user_id) VALUES ($1) RETURNING ` + dataExportColumns
+
+	var newExport exports.DataExport
+	if scanErr := scanDataExport(conn(ctx, d.db).QueryRow(ctx, SQL, userID), &newExport); scanErr != nil {
+		if isUniqueViolation(scanErr) {
+			return nil, exports.ErrExportInProgress
+		}
+		return nil, fmt.Errorf("failed to create data export: %w", scanErr)
+	}
+	return &newExport, nil
+}
+
+func (d *DataExportRepo) FindByID(ctx context.Context, exportID uuid.UUID) (*exports.DataExport, error) {
+	SQL := "SELECT " + dataExportColumns + " FROM data_exports WHERE id = $1"
+
+	var export exports.DataExport
+	if scanErr := scanDataExport(conn(ctx, d.db).QueryRow(ctx, SQL, exportID), &export); scanErr != nil {
+		return nil, fmt.Errorf("data export not found")
+	}
+	return &export, nil
+}
+
+func (d *DataExportRepo) FindPendingByUserID(ctx context.Context, userID uuid.UUID) (*exports.DataExport, error) {
+	SQL := "SELECT " + dataExportColumns + " FROM data_exports WHERE user_id = $1 AND status = 'pending'"
+
+	var export exports.DataExport
+	if scanErr := scanDataExport(conn(ctx, d.db).QueryRow(ctx, SQL, userID), &export); scanErr != nil {
+		return nil, fmt.Errorf("data export not found")
+	}
+	return &export, nil
+}
+
+// ClaimDue pushes next_attempt_at of the returned exports forward by lease, so
+// an export abandoned by a crashed worker becomes due again once the lease runs out.
+func (d *DataExportRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*exports.DataExport, error) {
+	SQL := `UPDATE data_exports SET next_attempt_at = NOW() + $2::interval, attempts = attempts + 1, updated_at = NOW()
+			WHERE id IN (
+				SELECT id FROM data_exports
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + dataExportColumns
+
+	rows, queryErr := conn(ctx, d.db).Query(ctx, SQL, limit, lease)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to claim data exports: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Exports []*exports.DataExport
+	for rows.Next() {
+		var export exports.DataExport
+		if scanErr := scanDataExport(rows, &export); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Exports = append(Exports, &export)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Exports, nil
+}
+
+func (d *DataExportRepo) MarkReady(ctx context.Context, exportID uuid.UUID, filePath string, sizeBytes int64, expiresAt time.Time) error {
+	SQL := `UPDATE data_exports SET status = 'ready', file_path = $1, size_bytes = $2, expires_at = $3, last_error = '',
+				completed_at = NOW(), updated_at = NOW()
+			WHERE id = $4`
+	cmd, execErr := conn(ctx, d.db).Exec(ctx, SQL, filePath, sizeBytes, expiresAt, exportID)
+	if execErr != nil {
+		return fmt.Errorf("failed to complete data export: %w", execErr)
+	}
+
+	// The row is gone when the account was deleted while the archive was
+	// being built; the caller then removes the file.
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("data export does not exist")
+	}
+	return nil
+}
+
+func (d *DataExportRepo) MarkRetry(ctx context.Context, exportID uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	SQL := `UPDATE data_exports SET last_error = $1, next_attempt_at = $2, updated_at = NOW() WHERE id = $3`
+	if _, execErr := conn(ctx, d.db).Exec(ctx, SQL, lastError, nextAttemptAt, exportID); execErr != nil {
+		return fmt.Errorf("failed to reschedule data export: %w", execErr)
+	}
+	return nil
+}
+
+func (d *DataExportRepo) MarkFailed(ctx context.Context, exportID uuid.UUID, lastError string) error {
+	SQL := `UPDATE data_exports SET status = 'failed', last_error = $1, completed_at = NOW(), updated_at = NOW()
+			WHERE id = $2`
+	if _, execErr := conn(ctx, d.db).Exec(ctx, SQL, lastError, exportID); execErr != nil {
+		return fmt.Errorf("failed to mark data export as failed: %w", execErr)
+	}
+	return nil
+}
+
+// DeleteExpired removes ready exports past their expiry and returns the
+// archive paths so the caller can remove the files.
+func (d *DataExportRepo) DeleteExpired(ctx context.Context) ([]string, error) {
+	SQL := `DELETE FROM data_exports WHERE status = 'ready' AND expires_at <= NOW() RETURNING file_path`
+
+	rows, queryErr := conn(ctx, d.db).Query(ctx, SQL)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to delete expired data exports: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var filePaths []string
+	for rows.Next() {
+		var filePath string
+		if scanErr := rows.Scan(&filePath); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return filePaths, nil
+}
+
+// FindFilePathsByUserID returns the archive paths of every export the user has
+// on disk, whether or not the export has expired.
+func (d *DataExportRepo) FindFilePathsByUserID(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	SQL := `SELECT file_path FROM data_exports WHERE user_id = $1 AND file_path <> ''`
+
+	rows, queryErr := conn(ctx, d.db).Query(ctx, SQL, userID)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list data export files: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var filePaths []string
+	for rows.Next() {
+		var filePath string
+		if scanErr := rows.Scan(&filePath); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		filePaths = append(filePaths, filePath)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return filePaths, nil
+}
+
+func (d *DataExportRepo) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	SQL := `DELETE FROM data_exports WHERE user_id = $1`
+	if _, execErr := conn(ctx, d.db).Exec(ctx, SQL, userID); execErr != nil {
+		return fmt.Errorf("failed to delete data exports: %w", execErr)
+	}
+	return nil
+}
@@ -2,12 +2,18 @@ package postgresql
 
 import (
 	"context"
-	"fmt"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
 )
 
-func NewPostgresDB(connString string) (*pgxpool.Pool, error) {
-	db, dbErr := pgxpool.New(context.Background(), connString)
+func NewPostgresDB(connString string, logger *slog.Logger) (*pgxpool.Pool, error) {
+	poolConfig, configErr := pgxpool.ParseConfig(connString)
+	if configErr != nil {
+		return nil, configErr
+	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	db, dbErr := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if dbErr != nil {
 		return nil, dbErr
 	}
@@ -15,6 +21,6 @@ func NewPostgresDB(connString string) (*pgxpool.Pool, error) {
 	if pingErr != nil {
 		return nil, pingErr
 	}
-	fmt.Println("Database is Up and Running!")
+	logger.Info("database is up and running", "host", db.Config().ConnConfig.Host, "database", db.Config().ConnConfig.Database)
 	return db, nil
 }
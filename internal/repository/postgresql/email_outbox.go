@@ -0,0 +1,195 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/emails"
+	"time"
+)
+
+const emailOutboxColumns = `id, to_email, to_name, from_email, from_name, subject, text_body, html_body,
+	list_unsubscribe, one_click_unsubscribe, inline_images, status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+type EmailOutboxRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailOutboxRepo(pool *pgxpool.Pool) *EmailOutboxRepo {
+	return &EmailOutboxRepo{db: pool}
+}
+
+func scanOutboxEmail(row pgx.Row, email *emails.OutboxEmail) error {
+	return row.Scan(
+		&email.ID,
+		&email.ToEmail,
+		&email.ToName,
+		&email.FromEmail,
+		&email.FromName,
+		&email.Subject,
+		&email.TextBody,
+		&email.HTMLBody,
+		&email.ListUnsubscribe,
+		&email.OneClickUnsubscribe,
+		&email.InlineImages,
+		&email.Status,
+		&email.Attempts,
+		&email.LastError,
+		&email.NextAttemptAt,
+		&email.CreatedAt,
+		&email.SentAt,
+	)
+}
+
+func collectOutboxEmails(rows pgx.Rows) ([]*emails.OutboxEmail, error) {
+	defer rows.Close()
+
+	var Emails []*emails.OutboxEmail
+	for rows.Next() {
+		var email emails.OutboxEmail
+		if scanErr := scanOutboxEmail(rows, &email); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Emails = append(Emails, &email)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Emails, nil
+}
+
+func (e *EmailOutboxRepo) Enqueue(ctx context.Context, email *emails.OutboxEmail) (*emails.OutboxEmail, error) {
+	SQL := `INSERT INTO email_outbox (to_email, to_name, from_email, from_name, subject, text_body, html_body,
+				list_unsubscribe, one_click_unsubscribe, inline_images)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING ` + emailOutboxColumns
+
+	listUnsubscribe := email.ListUnsubscribe
+	if listUnsubscribe == nil {
+		listUnsubscribe = []string{}
+	}
+	inlineImages := email.InlineImages
+	if inlineImages == nil {
+		inlineImages = []emails.InlineImage{}
+	}
+
+	var newEmail emails.OutboxEmail
+	scanErr := scanOutboxEmail(conn(ctx, e.db).QueryRow(ctx, SQL,
+		email.ToEmail,
+		email.ToName,
+		email.FromEmail,
+		email.FromName,
+		email.Subject,
+		email.TextBody,
+		email.HTMLBody,
+		listUnsubscribe,
+		email.OneClickUnsubscribe,
+		inlineImages,
+	), &newEmail)
+	if scanErr != nil {
+		return nil, fmt.Errorf("failed to enqueue email: %w", scanErr)
+	}
+	return &newEmail, nil
+}
+
+// ClaimDue pushes next_attempt_at of the returned emails forward by lease, so
+// an email abandoned by a crashed worker becomes due again once it runs out.
+func (e *EmailOutboxRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*emails.OutboxEmail, error) {
+	SQL := `UPDATE email_outbox SET next_attempt_at = NOW() + $2::interval, attempts = attempts + 1, updated_at = NOW()
+			WHERE id IN (
+				SELECT id FROM email_outbox
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + emailOutboxColumns
+
+	rows, queryErr := conn(ctx, e.db).Query(ctx, SQL, limit, lease)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to claim outbox emails: %w", queryErr)
+	}
+	return collectOutboxEmails(rows)
+}
+
+func (e *EmailOutboxRepo) MarkSent(ctx context.Context, id uuid.UUID) error {
+	SQL := `UPDATE email_outbox SET status = 'sent', last_error = '', sent_at = NOW(), updated_at = NOW() WHERE id = $1`
+	if _, execErr := conn(ctx, e.db).Exec(ctx, SQL, id); execErr != nil {
+		return fmt.Errorf("failed to mark email sent: %w", execErr)
+	}
+	return nil
+}
+
+func (e *EmailOutboxRepo) MarkRetry(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	SQL := `UPDATE email_outbox SET last_error = $1, next_attempt_at = $2, updated_at = NOW() WHERE id = $3`
+	if _, execErr := conn(ctx, e.db).Exec(ctx, SQL, lastError, nextAttemptAt, id); execErr != nil {
+		return fmt.Errorf("failed to reschedule email: %w", execErr)
+	}
+	return nil
+}
+
+func (e *EmailOutboxRepo) Release(ctx context.Context, id uuid.UUID) error {
+	SQL := `UPDATE email_outbox SET attempts = GREATEST(attempts - 1, 0), next_attempt_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND status = 'pending'`
+	if _, execErr := conn(ctx, e.db).Exec(ctx, SQL, id); execErr != nil {
+		return fmt.Errorf("failed to release email: %w", execErr)
+	}
+	return nil
+}
+
+func (e *EmailOutboxRepo) MarkDead(ctx context.Context, id uuid.UUID, lastError string) error {
+	SQL := `UPDATE email_outbox SET status = 'dead', last_error = $1, updated_at = NOW() WHERE id = $2`
+	if _, execErr := conn(ctx, e.db).Exec(ctx, SQL, lastError, id); execErr != nil {
+		return fmt.Errorf("failed to dead-letter email: %w", execErr)
+	}
+	return nil
+}
+
+func (e *EmailOutboxRepo) ListDead(ctx context.Context, limit int, offset int) ([]*emails.OutboxEmail, error) {
+	SQL := `SELECT ` + emailOutboxColumns + ` FROM email_outbox
+			WHERE status = 'dead'
+			ORDER BY updated_at DESC
+			LIMIT $1 OFFSET $2`
+
+	rows, queryErr := conn(ctx, e.db).Query(ctx, SQL, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list dead emails: %w", queryErr)
+	}
+	return collectOutboxEmails(rows)
+}
+
+func (e *EmailOutboxRepo) Requeue(ctx context.Context, id uuid.UUID) error {
+	SQL := `UPDATE email_outbox SET status = 'pending', attempts = 0, next_attempt_at = NOW(), queued_at = NOW(),
+				updated_at = NOW()
+			WHERE id = $1 AND status = 'dead'`
+	tag, execErr := conn(ctx, e.db).Exec(ctx, SQL, id)
+	if execErr != nil {
+		return fmt.Errorf("failed to requeue email: %w", execErr)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("dead email does not exist")
+	}
+	return nil
+}
+
+func (e *EmailOutboxRepo) DeleteSent(ctx context.Context, retention time.Duration) (int64, error) {
+	SQL := `DELETE FROM email_outbox WHERE status = 'sent' AND sent_at < NOW() - $1::interval`
+	tag, execErr := conn(ctx, e.db).Exec(ctx, SQL, retention)
+	if execErr != nil {
+		return 0, fmt.Errorf("failed to delete sent emails: %w", execErr)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (e *EmailOutboxRepo) ExpirePending(ctx context.Context, maxAge time.Duration, lastError string) (int64, error) {
+	SQL := `UPDATE email_outbox SET status = 'dead', last_error = $2, updated_at = NOW()
+			WHERE status = 'pending' AND queued_at < NOW() - $1::interval AND next_attempt_at <= NOW()`
+	tag, execErr := conn(ctx, e.db).Exec(ctx, SQL, maxAge, lastError)
+	if execErr != nil {
+		return 0, fmt.Errorf("failed to expire pending emails: %w", execErr)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+type FollowRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewFollowRepo(pool *pgxpool.Pool) *FollowRepo {
+	return &FollowRepo{db: pool}
+}
+
+func (f *FollowRepo) Follow(ctx context.Context, followerID uuid.UUID, followeeID uuid.UUID) (bool, error) {
+	SQL := `INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)
+			ON CONFLICT (follower_id, followee_id) DO NOTHING`
+	cmd, execErr := conn(ctx, f.db).Exec(ctx, SQL, followerID, followeeID)
+	if execErr != nil {
+		return false, fmt.Errorf("failed to follow user: %w", execErr)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+func (f *FollowRepo) Unfollow(ctx context.Context, followerID uuid.UUID, followeeID uuid.UUID) (bool, error) {
+	SQL := `DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2`
+	cmd, execErr := conn(ctx, f.db).Exec(ctx, SQL, followerID, followeeID)
+	if execErr != nil {
+		return false, fmt.Errorf("failed to unfollow user: %w", execErr)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+func (f *FollowRepo) ListFollowers(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error) {
+	SQL := `SELECT ` + prefixColumns("u", userColumns) + ` FROM follows fo
+			JOIN users u ON u.id = fo.follower_id
+			WHERE fo.followee_id = $1 AND ` + visibleUserCondition + `
+			ORDER BY fo.created_at DESC
+			LIMIT $2 OFFSET $3`
+	return f.listUsers(ctx, SQL, userID, limit, offset)
+}
+
+func (f *FollowRepo) ListFollowing(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error) {
+	SQL := `SELECT ` + prefixColumns("u", userColumns) + ` FROM follows fo
+			JOIN users u ON u.id = fo.followee_id
+			WHERE fo.follower_id = $1 AND ` + visibleUserCondition + `
+			ORDER BY fo.created_at DESC
+			LIMIT $2 OFFSET $3`
+	return f.listUsers(ctx, SQL, userID, limit, offset)
+}
+
+func (f *FollowRepo) listUsers(ctx context.Context, SQL string, userID uuid.UUID, limit int, offset int) ([]*users.User, error) {
+	rows, queryErr := conn(ctx, f.db).Query(ctx, SQL, userID, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list follows: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Users []*users.User
+
+	for rows.Next() {
+		var user users.User
+		if scanErr := scanUser(rows, &user); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Users = append(Users, &user)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Users, nil
+}
@@ -0,0 +1,36 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LikeRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLikeRepo(pool *pgxpool.Pool) *LikeRepo {
+	return &LikeRepo{db: pool}
+}
+
+// Like and Unlike leave photos.like_count to the photo_likes trigger.
+func (l *LikeRepo) Like(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (bool, error) {
+	SQL := `INSERT INTO photo_likes (user_id, photo_id) VALUES ($1, $2)
+			ON CONFLICT ON CONSTRAINT photo_likes_user_photo_key DO NOTHING`
+	cmd, execErr := conn(ctx, l.db).Exec(ctx, SQL, userID, photoID)
+	if execErr != nil {
+		return false, fmt.Errorf("failed to update like: %w", execErr)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+func (l *LikeRepo) Unlike(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (bool, error) {
+	SQL := `DELETE FROM photo_likes WHERE user_id = $1 AND photo_id = $2`
+	cmd, execErr := conn(ctx, l.db).Exec(ctx, SQL, userID, photoID)
+	if execErr != nil {
+		return false, fmt.Errorf("failed to update like: %w", execErr)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
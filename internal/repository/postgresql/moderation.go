@@ -0,0 +1,165 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/moderation"
+)
+
+const (
+	reportColumns = `id, photo_id, reporter_id, reason, details, status, resolved_by, resolved_at, created_at`
+	actionColumns = `id, moderator_id, action, photo_id, target_user_id, note, created_at`
+)
+
+type ModerationRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewModerationRepo(pool *pgxpool.Pool) *ModerationRepo {
+	return &ModerationRepo{db: pool}
+}
+
+func scanReport(row pgx.Row, report *moderation.Report) error {
+	return row.Scan(
+		&report.ID,
+		&report.PhotoID,
+		&report.ReporterID,
+		&report.Reason,
+		&report.Details,
+		&report.Status,
+		&report.ResolvedBy,
+		&report.ResolvedAt,
+		&report.CreatedAt,
+	)
+}
+
+func (m *ModerationRepo) CreateReport(ctx context.Context, report *moderation.Report) (*moderation.Report, error) {
+	SQL := `INSERT INTO photo_reports (photo_id, reporter_id, reason, details)
+			VALUES ($1, $2, $3, $4)
+			RETURNING ` + reportColumns
+
+	var newReport moderation.Report
+	scanErr := scanReport(conn(ctx, m.db).QueryRow(ctx, SQL, report.PhotoID, report.ReporterID, report.Reason, report.Details), &newReport)
+	if scanErr != nil {
+		if isUniqueViolation(scanErr) {
+			return nil, moderation.ErrAlreadyReported
+		}
+		return nil, fmt.Errorf("failed to create report: %w", scanErr)
+	}
+	return &newReport, nil
+}
+
+func (m *ModerationRepo) ListQueue(ctx context.Context, limit int, offset int) ([]*moderation.QueueItem, error) {
+	SQL := `SELECT p.id, p.user_id, p.filename, p.ipfs_cid, p.hidden_at, COUNT(*),
+				ARRAY_AGG(DISTINCT r.reason ORDER BY r.reason), MIN(r.created_at), MAX(r.created_at)
+			FROM photo_reports r
+			JOIN photos p ON p.id = r.photo_id
+			WHERE r.status = 'open'
+			GROUP BY p.id
+			ORDER BY COUNT(*) DESC, MIN(r.created_at), p.id
+			LIMIT $1 OFFSET $2`
+
+	rows, queryErr := conn(ctx, m.db).Query(ctx, SQL, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list moderation queue: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Items []*moderation.QueueItem
+
+	for rows.Next() {
+		var item moderation.QueueItem
+		scanErr := rows.Scan(&item.PhotoID, &item.UploaderID, &item.Filename, &item.IPFSCid, &item.HiddenAt,
+			&item.ReportCount, &item.Reasons, &item.FirstReportedAt, &item.LastReportedAt)
+		if scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Items = append(Items, &item)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Items, nil
+}
+
+func (m *ModerationRepo) ListOpenReports(ctx context.Context, photoID uuid.UUID) ([]*moderation.Report, error) {
+	SQL := `SELECT ` + reportColumns + ` FROM photo_reports
+			WHERE photo_id = $1 AND status = 'open'
+			ORDER BY created_at, id`
+
+	rows, queryErr := conn(ctx, m.db).Query(ctx, SQL, photoID)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Reports []*moderation.Report
+
+	for rows.Next() {
+		var report moderation.Report
+		if scanErr := scanReport(rows, &report); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Reports = append(Reports, &report)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Reports, nil
+}
+
+func (m *ModerationRepo) ResolveReports(ctx context.Context, photoID uuid.UUID, moderatorID uuid.UUID, status string) (int64, error) {
+	SQL := `UPDATE photo_reports SET status = $1, resolved_by = $2, resolved_at = NOW()
+			WHERE photo_id = $3 AND status = 'open'`
+
+	cmd, execErr := conn(ctx, m.db).Exec(ctx, SQL, status, moderatorID, photoID)
+	if execErr != nil {
+		return 0, fmt.Errorf("failed to resolve reports: %w", execErr)
+	}
+	return cmd.RowsAffected(), nil
+}
+
+func (m *ModerationRepo) RecordAction(ctx context.Context, action *moderation.Action) error {
+	SQL := `INSERT INTO moderation_actions (moderator_id, action, photo_id, target_user_id, note)
+			VALUES ($1, $2, $3, $4, $5)`
+
+	_, execErr := conn(ctx, m.db).Exec(ctx, SQL, action.ModeratorID, action.Action, action.PhotoID, action.TargetUserID, action.Note)
+	if execErr != nil {
+		return fmt.Errorf("failed to record moderation action: %w", execErr)
+	}
+	return nil
+}
+
+func (m *ModerationRepo) ListActions(ctx context.Context, limit int, offset int) ([]*moderation.Action, error) {
+	SQL := `SELECT ` + actionColumns + ` FROM moderation_actions
+			ORDER BY created_at DESC, id
+			LIMIT $1 OFFSET $2`
+
+	rows, queryErr := conn(ctx, m.db).Query(ctx, SQL, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list moderation actions: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Actions []*moderation.Action
+
+	for rows.Next() {
+		var action moderation.Action
+		scanErr := rows.Scan(&action.ID, &action.ModeratorID, &action.Action, &action.PhotoID, &action.TargetUserID,
+			&action.Note, &action.CreatedAt)
+		if scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Actions = append(Actions, &action)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Actions, nil
+}
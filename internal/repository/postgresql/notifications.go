@@ -0,0 +1,143 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/meliocool/arkive/internal/repository/notifications"
+)
+
+const notificationColumns = `id, user_id, type, title, body, data, read_at, created_at`
+
+type NotificationRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewNotificationRepo(pool *pgxpool.Pool) *NotificationRepo {
+	return &NotificationRepo{db: pool}
+}
+
+func scanNotification(row pgx.Row, notification *notifications.Notification) error {
+	return row.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Type,
+		&notification.Title,
+		&notification.Body,
+		&notification.Data,
+		&notification.ReadAt,
+		&notification.CreatedAt,
+	)
+}
+
+func (n *NotificationRepo) Create(ctx context.Context, notification *notifications.Notification) (*notifications.Notification, error) {
+	data := notification.Data
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	SQL := `INSERT INTO notifications (user_id, type, title, body, data)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING ` + notificationColumns
+
+	var newNotification notifications.Notification
+	scanErr := scanNotification(conn(ctx, n.db).QueryRow(ctx, SQL, notification.UserID, notification.Type, notification.Title,
+		notification.Body, data), &newNotification)
+	if scanErr != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", scanErr)
+	}
+	return &newNotification, nil
+}
+
+func (n *NotificationRepo) ListByUserID(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int, offset int) ([]*notifications.Notification, error) {
+	SQL := `SELECT ` + notificationColumns + ` FROM notifications
+			WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+			ORDER BY created_at DESC, id
+			LIMIT $3 OFFSET $4`
+
+	rows, queryErr := conn(ctx, n.db).Query(ctx, SQL, userID, unreadOnly, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Notifications []*notifications.Notification
+
+	for rows.Next() {
+		var notification notifications.Notification
+		if scanErr := scanNotification(rows, &notification); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Notifications = append(Notifications, &notification)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Notifications, nil
+}
+
+func (n *NotificationRepo) CountUnread(ctx context.Context, userID uuid.UUID) (int, error) {
+	SQL := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+
+	var count int
+	if scanErr := conn(ctx, n.db).QueryRow(ctx, SQL, userID).Scan(&count); scanErr != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", scanErr)
+	}
+	return count, nil
+}
+
+func (n *NotificationRepo) MarkRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int64, error) {
+	SQL := `UPDATE notifications SET read_at = NOW()
+			WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::uuid[]) = 0 OR id = ANY($2))`
+
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+	cmd, execErr := conn(ctx, n.db).Exec(ctx, SQL, userID, ids)
+	if execErr != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", execErr)
+	}
+	return cmd.RowsAffected(), nil
+}
+
+func (n *NotificationRepo) Preferences(ctx context.Context, userID uuid.UUID) (map[string]map[string]bool, error) {
+	SQL := `SELECT category, channel, enabled FROM notification_channel_preferences WHERE user_id = $1`
+
+	rows, queryErr := conn(ctx, n.db).Query(ctx, SQL, userID)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to load notification preferences: %w", queryErr)
+	}
+	defer rows.Close()
+
+	preferences := map[string]map[string]bool{}
+	for rows.Next() {
+		var category, channel string
+		var enabled bool
+		if scanErr := rows.Scan(&category, &channel, &enabled); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		if preferences[category] == nil {
+			preferences[category] = map[string]bool{}
+		}
+		preferences[category][channel] = enabled
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return preferences, nil
+}
+
+func (n *NotificationRepo) SetPreference(ctx context.Context, userID uuid.UUID, category string, channel string, enabled bool) error {
+	SQL := `INSERT INTO notification_channel_preferences (user_id, category, channel, enabled)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, category, channel) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = NOW()`
+
+	if _, execErr := conn(ctx, n.db).Exec(ctx, SQL, userID, category, channel, enabled); execErr != nil {
+		return fmt.Errorf("failed to save notification preference: %w", execErr)
+	}
+	return nil
+}
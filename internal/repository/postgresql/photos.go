@@ -4,10 +4,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/meliocool/arkive/internal/repository/photos"
+	"time"
 )
 
+const photoColumns = `id, ipfs_cid, filename, created_at, updated_at, user_id, size_bytes, like_count, comments_disabled,
+	hidden_at`
+
+// visiblePhotoCondition drops photos hidden by moderation from listings other
+// users see. It expects the photos table aliased as p.
+const visiblePhotoCondition = `p.hidden_at IS NULL`
+
 type PhotoRepo struct {
 	db *pgxpool.Pool
 }
@@ -16,20 +25,47 @@ func NewPhotoRepo(pool *pgxpool.Pool) *PhotoRepo {
 	return &PhotoRepo{db: pool}
 }
 
+func scanPhoto(row pgx.Row, photo *photos.Photo) error {
+	return row.Scan(
+		&photo.ID,
+		&photo.IPFSCid,
+		&photo.Filename,
+		&photo.CreatedAt,
+		&photo.UpdatedAt,
+		&photo.UserID,
+		&photo.SizeBytes,
+		&photo.LikeCount,
+		&photo.CommentsDisabled,
+		&photo.HiddenAt,
+	)
+}
+
+func collectPhotos(rows pgx.Rows) ([]*photos.Photo, error) {
+	defer rows.Close()
+
+	var Photos []*photos.Photo
+
+	for rows.Next() {
+		var photo photos.Photo
+		if scanErr := scanPhoto(rows, &photo); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Photos = append(Photos, &photo)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Photos, nil
+}
+
 func (p *PhotoRepo) Create(ctx context.Context, photo *photos.Photo) (*photos.Photo, error) {
-	SQL := `INSERT INTO photos (ipfs_cid, filename, user_id)
-			VALUES ($1, $2, $3) RETURNING *`
+	SQL := `INSERT INTO photos (ipfs_cid, filename, user_id, size_bytes)
+			VALUES ($1, $2, $3, $4) RETURNING ` + photoColumns
 
 	var newPhoto photos.Photo
 
-	err := p.db.QueryRow(ctx, SQL, photo.IPFSCid, photo.Filename, photo.UserID).Scan(
-		&newPhoto.ID,
-		&newPhoto.IPFSCid,
-		&newPhoto.Filename,
-		&newPhoto.CreatedAt,
-		&newPhoto.UpdatedAt,
-		&newPhoto.UserID,
-	)
+	err := scanPhoto(conn(ctx, p.db).QueryRow(ctx, SQL, photo.IPFSCid, photo.Filename, photo.UserID, photo.SizeBytes), &newPhoto)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create photo in database: %w", err)
@@ -37,35 +73,121 @@ func (p *PhotoRepo) Create(ctx context.Context, photo *photos.Photo) (*photos.Ph
 	return &newPhoto, nil
 }
 
+func (p *PhotoRepo) FindByID(ctx context.Context, photoID uuid.UUID) (*photos.Photo, error) {
+	SQL := `SELECT ` + photoColumns + ` FROM photos WHERE id = $1`
+
+	var photo photos.Photo
+
+	scanErr := scanPhoto(conn(ctx, p.db).QueryRow(ctx, SQL, photoID), &photo)
+	if scanErr != nil {
+		return nil, fmt.Errorf("photo not found")
+	}
+	return &photo, nil
+}
+
 func (p *PhotoRepo) FindByUserID(ctx context.Context, userID uuid.UUID) ([]*photos.Photo, error) {
-	SQL := `SELECT * FROM photos WHERE user_id = $1`
+	SQL := `SELECT ` + photoColumns + ` FROM photos WHERE user_id = $1`
 
-	rows, queryErr := p.db.Query(ctx, SQL, userID)
+	rows, queryErr := conn(ctx, p.db).Query(ctx, SQL, userID)
 	if queryErr != nil {
 		return nil, fmt.Errorf("failed to find user data: %w", queryErr)
 	}
-	defer rows.Close()
+	return collectPhotos(rows)
+}
 
-	var Photos []*photos.Photo
+// FindFeed returns the newest photos of the accounts followerID follows.
+func (p *PhotoRepo) FindFeed(ctx context.Context, followerID uuid.UUID, limit int, offset int) ([]*photos.Photo, error) {
+	SQL := `SELECT ` + prefixColumns("p", photoColumns) + ` FROM photos p
+			JOIN follows fo ON fo.followee_id = p.user_id
+			JOIN users u ON u.id = p.user_id
+			WHERE fo.follower_id = $1 AND ` + visibleUserCondition + ` AND ` + visiblePhotoCondition + `
+			ORDER BY p.created_at DESC, p.id
+			LIMIT $2 OFFSET $3`
 
-	for rows.Next() {
-		var photo photos.Photo
-		scanErr := rows.Scan(&photo.ID, &photo.IPFSCid, &photo.Filename, &photo.CreatedAt, &photo.UpdatedAt, &photo.UserID)
-		if scanErr != nil {
-			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
-		}
-		Photos = append(Photos, &photo)
+	rows, queryErr := conn(ctx, p.db).Query(ctx, SQL, followerID, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to load feed: %w", queryErr)
 	}
+	return collectPhotos(rows)
+}
 
-	if rowErr := rows.Err(); rowErr != nil {
-		return nil, rowErr
+// FindLikedByUser returns the photos userID liked, most recently liked first.
+func (p *PhotoRepo) FindLikedByUser(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*photos.Photo, error) {
+	SQL := `SELECT ` + prefixColumns("p", photoColumns) + ` FROM photos p
+			JOIN photo_likes l ON l.photo_id = p.id
+			JOIN users u ON u.id = p.user_id
+			WHERE l.user_id = $1 AND ` + visibleUserCondition + ` AND ` + visiblePhotoCondition + `
+			ORDER BY l.created_at DESC, p.id
+			LIMIT $2 OFFSET $3`
+
+	rows, queryErr := conn(ctx, p.db).Query(ctx, SQL, userID, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to find liked photos: %w", queryErr)
 	}
-	return Photos, nil
+	return collectPhotos(rows)
+}
+
+// FindPopular ranks photos by the likes they received since the given time,
+// breaking ties with the newest photo first.
+func (p *PhotoRepo) FindPopular(ctx context.Context, since time.Time, limit int, offset int) ([]*photos.Photo, error) {
+	SQL := `SELECT ` + prefixColumns("p", photoColumns) + ` FROM photos p
+			JOIN users u ON u.id = p.user_id
+			LEFT JOIN (
+				SELECT photo_id, COUNT(*) AS recent_likes FROM photo_likes
+				WHERE created_at >= $1
+				GROUP BY photo_id
+			) r ON r.photo_id = p.id
+			WHERE ` + visibleUserCondition + ` AND ` + visiblePhotoCondition + `
+			ORDER BY COALESCE(r.recent_likes, 0) DESC, p.created_at DESC, p.id
+			LIMIT $2 OFFSET $3`
+
+	rows, queryErr := conn(ctx, p.db).Query(ctx, SQL, since, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to find popular photos: %w", queryErr)
+	}
+	return collectPhotos(rows)
 }
 
 func (p *PhotoRepo) Delete(ctx context.Context, photoID uuid.UUID) error {
 	SQL := `DELETE FROM photos WHERE id = $1`
-	cmd, execErr := p.db.Exec(ctx, SQL, photoID)
+	cmd, execErr := conn(ctx, p.db).Exec(ctx, SQL, photoID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("photo does not exist")
+	}
+
+	return nil
+}
+
+func (p *PhotoRepo) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	SQL := `DELETE FROM photos WHERE user_id = $1`
+	if _, execErr := conn(ctx, p.db).Exec(ctx, SQL, userID); execErr != nil {
+		return fmt.Errorf("failed to delete photos: %w", execErr)
+	}
+	return nil
+}
+
+func (p *PhotoRepo) SetCommentsDisabled(ctx context.Context, photoID uuid.UUID, disabled bool) error {
+	SQL := `UPDATE photos SET comments_disabled = $1, updated_at = NOW() WHERE id = $2`
+	cmd, execErr := conn(ctx, p.db).Exec(ctx, SQL, disabled, photoID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("photo does not exist")
+	}
+
+	return nil
+}
+
+func (p *PhotoRepo) SetHidden(ctx context.Context, photoID uuid.UUID, hidden bool) error {
+	SQL := `UPDATE photos SET hidden_at = CASE WHEN $1 THEN COALESCE(hidden_at, NOW()) END, updated_at = NOW()
+			WHERE id = $2`
+	cmd, execErr := conn(ctx, p.db).Exec(ctx, SQL, hidden, photoID)
 	if execErr != nil {
 		return execErr
 	}
@@ -78,27 +200,43 @@ func (p *PhotoRepo) Delete(ctx context.Context, photoID uuid.UUID) error {
 }
 
 func (p *PhotoRepo) FindAll(ctx context.Context) ([]*photos.Photo, error) {
-	SQL := `SELECT * FROM photos`
+	SQL := `SELECT ` + prefixColumns("p", photoColumns) + ` FROM photos p
+			JOIN users u ON u.id = p.user_id
+			WHERE ` + visibleUserCondition + ` AND ` + visiblePhotoCondition
 
-	rows, queryErr := p.db.Query(ctx, SQL)
+	rows, queryErr := conn(ctx, p.db).Query(ctx, SQL)
 	if queryErr != nil {
 		return nil, fmt.Errorf("failed to find all photos: %w", queryErr)
 	}
-	defer rows.Close()
+	return collectPhotos(rows)
+}
 
-	var Photos []*photos.Photo
+func (p *PhotoRepo) UsageByUserID(ctx context.Context, userID uuid.UUID) (*photos.Usage, error) {
+	SQL := `SELECT COUNT(*), COALESCE(SUM(size_bytes), 0) FROM photos WHERE user_id = $1`
 
-	for rows.Next() {
-		var photo photos.Photo
-		scanErr := rows.Scan(&photo.ID, &photo.IPFSCid, &photo.Filename, &photo.CreatedAt, &photo.UpdatedAt, &photo.UserID)
-		if scanErr != nil {
-			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
-		}
-		Photos = append(Photos, &photo)
+	var usage photos.Usage
+	if scanErr := conn(ctx, p.db).QueryRow(ctx, SQL, userID).Scan(&usage.PhotoCount, &usage.TotalBytes); scanErr != nil {
+		return nil, fmt.Errorf("failed to compute storage usage: %w", scanErr)
 	}
+	return &usage, nil
+}
 
-	if rowErr := rows.Err(); rowErr != nil {
-		return nil, rowErr
+func (p *PhotoRepo) IsCIDInUse(ctx context.Context, ipfsCID string) (bool, error) {
+	SQL := `SELECT EXISTS (SELECT 1 FROM photos WHERE ipfs_cid = $1)`
+
+	var inUse bool
+	if scanErr := conn(ctx, p.db).QueryRow(ctx, SQL, ipfsCID).Scan(&inUse); scanErr != nil {
+		return false, fmt.Errorf("failed to check ipfs cid references: %w", scanErr)
 	}
-	return Photos, nil
+	return inUse, nil
+}
+
+func (p *PhotoRepo) IsCIDSharedWithOthers(ctx context.Context, ipfsCID string, userID uuid.UUID) (bool, error) {
+	SQL := `SELECT EXISTS (SELECT 1 FROM photos WHERE ipfs_cid = $1 AND user_id <> $2)`
+
+	var shared bool
+	if scanErr := conn(ctx, p.db).QueryRow(ctx, SQL, ipfsCID, userID).Scan(&shared); scanErr != nil {
+		return false, fmt.Errorf("failed to check ipfs cid references: %w", scanErr)
+	}
+	return shared, nil
 }
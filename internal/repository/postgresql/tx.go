@@ -0,0 +1,81 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type txKey struct{}
+
+type afterCommitKey struct{}
+
+// afterCommitHooks collects the functions to run once the outermost
+// transaction commits; nested transactions share it.
+type afterCommitHooks struct {
+	fns []func()
+}
+
+// querier is the subset of pgxpool.Pool and pgx.Tx the repositories use, so
+// a method runs the same way inside or outside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+func conn(ctx context.Context, pool *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+type Transactor struct {
+	db *pgxpool.Pool
+}
+
+func NewTransactor(pool *pgxpool.Pool) *Transactor {
+	return &Transactor{db: pool}
+}
+
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, txErr := conn(ctx, t.db).Begin(ctx)
+	if txErr != nil {
+		return fmt.Errorf("failed to begin transaction: %w", txErr)
+	}
+	defer tx.Rollback(ctx)
+
+	hooks, nested := ctx.Value(afterCommitKey{}).(*afterCommitHooks)
+	if !nested {
+		hooks = &afterCommitHooks{}
+		ctx = context.WithValue(ctx, afterCommitKey{}, hooks)
+	}
+
+	if fnErr := fn(context.WithValue(ctx, txKey{}, tx)); fnErr != nil {
+		return fnErr
+	}
+
+	if commitErr := tx.Commit(ctx); commitErr != nil {
+		return fmt.Errorf("failed to commit transaction: %w", commitErr)
+	}
+
+	if !nested {
+		for _, hook := range hooks.fns {
+			hook()
+		}
+	}
+	return nil
+}
+
+func (t *Transactor) AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(afterCommitKey{}).(*afterCommitHooks)
+	if !ok {
+		fn()
+		return
+	}
+	hooks.fns = append(hooks.fns, fn)
+}
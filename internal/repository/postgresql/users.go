@@ -4,27 +4,65 @@ import (
 	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/meliocool/arkive/internal/repository/users"
+	"log/slog"
+	"time"
 )
 
+const userColumns = `id, username, email, password_hash, is_verified, verification_code, created_at, updated_at, profile_image_cid,
+	totp_secret, totp_enabled, role, suspended_at, failed_login_attempts, locked_until,
+	token_version, deletion_requested_at, display_name, bio, website, pending_email, email_change_code_hash,
+	email_change_expires_at, storage_quota_bytes, locale`
+
 type UserRepo struct {
-	db *pgxpool.Pool
+	db     *pgxpool.Pool
+	logger *slog.Logger
+}
+
+func NewUserRepo(pool *pgxpool.Pool, logger *slog.Logger) *UserRepo {
+	return &UserRepo{db: pool, logger: logger}
 }
 
-func NewUserRepo(pool *pgxpool.Pool) *UserRepo {
-	return &UserRepo{db: pool}
+func scanUser(row pgx.Row, user *users.User) error {
+	return row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.IsVerified,
+		&user.VerificationCode,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.ProfileImageCID,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.Role,
+		&user.SuspendedAt,
+		&user.FailedLogins,
+		&user.LockedUntil,
+		&user.TokenVersion,
+		&user.DeletionRequestedAt,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Website,
+		&user.PendingEmail,
+		&user.EmailChangeCodeHash,
+		&user.EmailChangeExpires,
+		&user.StorageQuotaBytes,
+		&user.Locale,
+	)
 }
 
 func (u UserRepo) CreateUser(ctx context.Context, user *users.User) (*users.User, error) {
-	SQL := `INSERT INTO users (username, email, password_hash, is_verified, verification_code, profile_image_cid)
-			VALUES ($1, $2, $3, $4, $5, $6)
-			RETURNING id, username, email, password_hash, is_verified, verification_code, created_at, updated_at, profile_image_cid
-			`
+	SQL := `INSERT INTO users (username, email, password_hash, is_verified, verification_code, profile_image_cid, locale)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING ` + userColumns
 
 	var newUser users.User
 
-	err := u.db.QueryRow(
+	err := scanUser(conn(ctx, u.db).QueryRow(
 		ctx,
 		SQL,
 		user.Username,
@@ -33,17 +71,8 @@ func (u UserRepo) CreateUser(ctx context.Context, user *users.User) (*users.User
 		user.IsVerified,
 		user.VerificationCode,
 		user.ProfileImageCID,
-	).Scan(
-		&newUser.ID,
-		&newUser.Username,
-		&newUser.Email,
-		&newUser.PasswordHash,
-		&newUser.IsVerified,
-		&newUser.VerificationCode,
-		&newUser.CreatedAt,
-		&newUser.UpdatedAt,
-		&newUser.ProfileImageCID,
-	)
+		user.Locale,
+	), &newUser)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user in database: %w", err)
@@ -57,25 +86,11 @@ func (u UserRepo) FindByEmail(ctx context.Context, email string) (*users.User, e
 		return nil, fmt.Errorf("invalid email")
 	}
 
-	SQL := "SELECT * FROM users WHERE email = $1"
+	SQL := "SELECT " + userColumns + " FROM users WHERE email = $1"
 
 	var userFound users.User
 
-	err := u.db.QueryRow(
-		ctx,
-		SQL,
-		email,
-	).Scan(
-		&userFound.ID,
-		&userFound.Username,
-		&userFound.Email,
-		&userFound.PasswordHash,
-		&userFound.IsVerified,
-		&userFound.VerificationCode,
-		&userFound.CreatedAt,
-		&userFound.UpdatedAt,
-		&userFound.ProfileImageCID,
-	)
+	err := scanUser(conn(ctx, u.db).QueryRow(ctx, SQL, email), &userFound)
 
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
@@ -89,25 +104,45 @@ func (u UserRepo) FindByID(ctx context.Context, userId uuid.UUID) (*users.User,
 		return nil, fmt.Errorf("invalid email")
 	}
 
-	SQL := "SELECT * FROM users WHERE id = $1"
+	SQL := "SELECT " + userColumns + " FROM users WHERE id = $1"
 
 	var userFound users.User
 
-	err := u.db.QueryRow(
-		ctx,
-		SQL,
-		userId,
-	).Scan(
-		&userFound.ID,
-		&userFound.Username,
-		&userFound.Email,
-		&userFound.PasswordHash,
-		&userFound.IsVerified,
-		&userFound.VerificationCode,
-		&userFound.CreatedAt,
-		&userFound.UpdatedAt,
-		&userFound.ProfileImageCID,
-	)
+	err := scanUser(conn(ctx, u.db).QueryRow(ctx, SQL, userId), &userFound)
+
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return &userFound, nil
+}
+
+func (u UserRepo) FindByUsername(ctx context.Context, username string) (*users.User, error) {
+	if username == "" {
+		return nil, fmt.Errorf("invalid username")
+	}
+
+	SQL := "SELECT " + userColumns + " FROM users WHERE LOWER(username) = LOWER($1)"
+
+	var userFound users.User
+
+	err := scanUser(conn(ctx, u.db).QueryRow(ctx, SQL, username), &userFound)
+
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return &userFound, nil
+}
+
+func (u UserRepo) FindByIdentity(ctx context.Context, provider string, subject string) (*users.User, error) {
+	SQL := `SELECT ` + prefixColumns("u", userColumns) + ` FROM users u
+			JOIN user_identities i ON i.user_id = u.id
+			WHERE i.provider = $1 AND i.subject = $2`
+
+	var userFound users.User
+
+	err := scanUser(conn(ctx, u.db).QueryRow(ctx, SQL, provider, subject), &userFound)
 
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
@@ -116,6 +151,16 @@ func (u UserRepo) FindByID(ctx context.Context, userId uuid.UUID) (*users.User,
 	return &userFound, nil
 }
 
+func (u UserRepo) LinkIdentity(ctx context.Context, userID uuid.UUID, provider string, subject string, email string) error {
+	SQL := `INSERT INTO user_identities (user_id, provider, subject, email)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (provider, subject) DO NOTHING`
+	if _, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID, provider, subject, email); execErr != nil {
+		return fmt.Errorf("failed to link identity: %w", execErr)
+	}
+	return nil
+}
+
 func (u *UserRepo) UpdateIsVerified(ctx context.Context, id uuid.UUID, isVerified bool) error {
 	if isVerified == true {
 		return fmt.Errorf("account already verified")
@@ -127,20 +172,274 @@ func (u *UserRepo) UpdateIsVerified(ctx context.Context, id uuid.UUID, isVerifie
 
 	SQL := "UPDATE users SET is_verified = TRUE WHERE id = $1"
 
-	exec, dbErr := u.db.Exec(ctx, SQL, id)
+	exec, dbErr := conn(ctx, u.db).Exec(ctx, SQL, id)
 	if dbErr != nil {
 		return dbErr
 	}
 
 	if exec.RowsAffected() > 0 {
-		fmt.Println("Row Updated!")
+		u.logger.DebugContext(ctx, "user verified", "user_id", id)
 	}
 	return nil
 }
 
 func (u *UserRepo) UpdateProfileImage(ctx context.Context, userID uuid.UUID, ipfsCID string) error {
 	SQL := `UPDATE users SET profile_image_cid = $1 WHERE id = $2`
-	cmd, execErr := u.db.Exec(ctx, SQL, ipfsCID, userID)
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, ipfsCID, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) UpdateLocale(ctx context.Context, userID uuid.UUID, locale string) error {
+	SQL := `UPDATE users SET locale = $1, updated_at = NOW() WHERE id = $2`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, locale, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) UpdateProfile(ctx context.Context, userID uuid.UUID, displayName string, bio string, website string) error {
+	SQL := `UPDATE users SET display_name = $1, bio = $2, website = $3, updated_at = NOW() WHERE id = $4`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, displayName, bio, website, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) UpdateUsername(ctx context.Context, userID uuid.UUID, username string) error {
+	SQL := `UPDATE users SET username = $1, updated_at = NOW() WHERE id = $2`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, username, userID)
+	if execErr != nil {
+		if isUniqueViolation(execErr) {
+			return users.ErrUsernameTaken
+		}
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) SetPendingEmail(ctx context.Context, userID uuid.UUID, email string, codeHash string, expiresAt time.Time) error {
+	SQL := `UPDATE users SET pending_email = $1, email_change_code_hash = $2, email_change_expires_at = $3,
+				email_change_attempts = 0, updated_at = NOW()
+			WHERE id = $4`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, email, codeHash, expiresAt, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange swaps the pending address in. The new address has just
+// been proven by the emailed code, so the account counts as verified.
+func (u *UserRepo) ConfirmEmailChange(ctx context.Context, userID uuid.UUID) error {
+	SQL := `UPDATE users SET email = pending_email, is_verified = TRUE, pending_email = '', email_change_code_hash = '',
+				email_change_expires_at = NULL, email_change_attempts = 0, updated_at = NOW()
+			WHERE id = $1 AND pending_email <> ''`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID)
+	if execErr != nil {
+		if isUniqueViolation(execErr) {
+			return users.ErrEmailTaken
+		}
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("no email change pending")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) IncrementEmailChangeAttempts(ctx context.Context, userID uuid.UUID) (int, error) {
+	SQL := `UPDATE users SET email_change_attempts = email_change_attempts + 1 WHERE id = $1 AND pending_email <> ''
+			RETURNING email_change_attempts`
+
+	var attempts int
+	if scanErr := conn(ctx, u.db).QueryRow(ctx, SQL, userID).Scan(&attempts); scanErr != nil {
+		return 0, fmt.Errorf("failed to record email change attempt: %w", scanErr)
+	}
+	return attempts, nil
+}
+
+func (u *UserRepo) CancelEmailChange(ctx context.Context, userID uuid.UUID) error {
+	SQL := `UPDATE users SET pending_email = '', email_change_code_hash = '', email_change_expires_at = NULL,
+				email_change_attempts = 0, updated_at = NOW()
+			WHERE id = $1`
+	if _, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID); execErr != nil {
+		return fmt.Errorf("failed to cancel email change: %w", execErr)
+	}
+	return nil
+}
+
+func (u UserRepo) List(ctx context.Context, limit int, offset int) ([]*users.User, error) {
+	SQL := "SELECT " + userColumns + " FROM users ORDER BY created_at DESC LIMIT $1 OFFSET $2"
+
+	rows, queryErr := conn(ctx, u.db).Query(ctx, SQL, limit, offset)
+	if queryErr != nil {
+		return nil, fmt.Errorf("failed to list users: %w", queryErr)
+	}
+	defer rows.Close()
+
+	var Users []*users.User
+
+	for rows.Next() {
+		var user users.User
+		if scanErr := scanUser(rows, &user); scanErr != nil {
+			return nil, fmt.Errorf("failed to retrieve rows: %w", scanErr)
+		}
+		Users = append(Users, &user)
+	}
+
+	if rowErr := rows.Err(); rowErr != nil {
+		return nil, rowErr
+	}
+	return Users, nil
+}
+
+func (u *UserRepo) UpdateRole(ctx context.Context, userID uuid.UUID, role string) error {
+	SQL := `UPDATE users SET role = $1, token_version = token_version + 1, updated_at = NOW() WHERE id = $2`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, role, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) UpdateStorageQuota(ctx context.Context, userID uuid.UUID, quotaBytes *int64) error {
+	SQL := `UPDATE users SET storage_quota_bytes = $1, updated_at = NOW() WHERE id = $2`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, quotaBytes, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+// LockForUpdate row-locks the user until the surrounding transaction ends, so
+// concurrent requests for the same user are serialized.
+func (u *UserRepo) LockForUpdate(ctx context.Context, userID uuid.UUID) error {
+	SQL := `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+	var lockedID uuid.UUID
+	if scanErr := conn(ctx, u.db).QueryRow(ctx, SQL, userID).Scan(&lockedID); scanErr != nil {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+func (u *UserRepo) UpdateSuspended(ctx context.Context, userID uuid.UUID, suspended bool) error {
+	SQL := `UPDATE users SET suspended_at = CASE WHEN $1 THEN NOW() END, token_version = token_version + 1, updated_at = NOW()
+			WHERE id = $2`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, suspended, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) IncrementFailedLogins(ctx context.Context, userID uuid.UUID) (int, error) {
+	SQL := `UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = $1
+			RETURNING failed_login_attempts`
+
+	var failures int
+	if scanErr := conn(ctx, u.db).QueryRow(ctx, SQL, userID).Scan(&failures); scanErr != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", scanErr)
+	}
+	return failures, nil
+}
+
+func (u *UserRepo) LockUntil(ctx context.Context, userID uuid.UUID, lockedUntil time.Time) error {
+	SQL := `UPDATE users SET locked_until = $1 WHERE id = $2`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, lockedUntil, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) ResetFailedLogins(ctx context.Context, userID uuid.UUID) error {
+	SQL := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1`
+	if _, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID); execErr != nil {
+		return execErr
+	}
+	return nil
+}
+
+func (u *UserRepo) MarkDeletionRequested(ctx context.Context, userID uuid.UUID) error {
+	SQL := `UPDATE users SET deletion_requested_at = NOW(), token_version = token_version + 1, updated_at = NOW()
+			WHERE id = $1 AND deletion_requested_at IS NULL`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID)
+	if execErr != nil {
+		return execErr
+	}
+
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("user does not exist or deletion already requested")
+	}
+
+	return nil
+}
+
+func (u *UserRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	SQL := `DELETE FROM users WHERE id = $1`
+	if _, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID); execErr != nil {
+		return fmt.Errorf("failed to delete user: %w", execErr)
+	}
+	return nil
+}
+
+func (u *UserRepo) UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error {
+	SQL := `UPDATE users SET totp_secret = $1, totp_enabled = $2,
+				totp_last_step = CASE WHEN $2 THEN totp_last_step ELSE 0 END, updated_at = NOW()
+			WHERE id = $3`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, secret, enabled, userID)
 	if execErr != nil {
 		return execErr
 	}
@@ -151,3 +450,43 @@ func (u *UserRepo) UpdateProfileImage(ctx context.Context, userID uuid.UUID, ipf
 
 	return nil
 }
+
+func (u *UserRepo) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	SQL := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, step, userID)
+	if execErr != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", execErr)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+func (u *UserRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, txErr := conn(ctx, u.db).Begin(ctx)
+	if txErr != nil {
+		return fmt.Errorf("failed to begin transaction: %w", txErr)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, deleteErr := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); deleteErr != nil {
+		return fmt.Errorf("failed to clear recovery codes: %w", deleteErr)
+	}
+
+	for _, codeHash := range codeHashes {
+		SQL := `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, insertErr := tx.Exec(ctx, SQL, userID, codeHash); insertErr != nil {
+			return fmt.Errorf("failed to store recovery code: %w", insertErr)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (u *UserRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	SQL := `UPDATE user_recovery_codes SET used_at = NOW()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	cmd, execErr := conn(ctx, u.db).Exec(ctx, SQL, userID, codeHash)
+	if execErr != nil {
+		return false, execErr
+	}
+	return cmd.RowsAffected() > 0, nil
+}
@@ -0,0 +1,12 @@
+package transactor
+
+import "context"
+
+// Transactor runs fn inside a database transaction. Repository calls made
+// with the context passed to fn take part in that transaction.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// AfterCommit runs fn once the transaction in ctx has committed, or right
+	// away when ctx carries no transaction. fn is dropped on rollback.
+	AfterCommit(ctx context.Context, fn func())
+}
@@ -2,26 +2,98 @@ package users
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"time"
 )
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var (
+	ErrUsernameTaken = errors.New("username already taken")
+	ErrEmailTaken    = errors.New("email already taken")
+)
+
+var roleRanks = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole reports whether role grants at least the privileges of required.
+func HasRole(role string, required string) bool {
+	return roleRanks[role] >= roleRanks[required] && roleRanks[required] > 0
+}
+
 type User struct {
-	ID               uuid.UUID `json:"id,omitempty" db:"id"`
-	Username         string    `json:"username,omitempty" db:"username"`
-	Email            string    `json:"email,omitempty" db:"email"`
-	PasswordHash     string    `json:"password_hash,omitempty" db:"password_hash"`
-	IsVerified       bool      `json:"is_verified,omitempty" db:"is_verified"`
-	VerificationCode string    `json:"verification_code,omitempty" db:"verification_code"`
-	CreatedAt        time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
-	ProfileImageCID  string    `json:"profile_image_cid,omitempty" db:"profile_image_cid"`
+	ID                  uuid.UUID  `json:"id,omitempty" db:"id"`
+	Username            string     `json:"username,omitempty" db:"username"`
+	Email               string     `json:"email,omitempty" db:"email"`
+	PasswordHash        string     `json:"-" db:"password_hash"`
+	IsVerified          bool       `json:"is_verified,omitempty" db:"is_verified"`
+	VerificationCode    string     `json:"-" db:"verification_code"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+	ProfileImageCID     string     `json:"profile_image_cid,omitempty" db:"profile_image_cid"`
+	TOTPSecret          string     `json:"-" db:"totp_secret"`
+	TOTPEnabled         bool       `json:"-" db:"totp_enabled"`
+	Role                string     `json:"role,omitempty" db:"role"`
+	SuspendedAt         *time.Time `json:"suspended_at,omitempty" db:"suspended_at"`
+	FailedLogins        int        `json:"-" db:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"-" db:"locked_until"`
+	TokenVersion        int        `json:"-" db:"token_version"`
+	DeletionRequestedAt *time.Time `json:"-" db:"deletion_requested_at"`
+	DisplayName         string     `json:"display_name,omitempty" db:"display_name"`
+	Bio                 string     `json:"bio,omitempty" db:"bio"`
+	Website             string     `json:"website,omitempty" db:"website"`
+	PendingEmail        string     `json:"-" db:"pending_email"`
+	EmailChangeCodeHash string     `json:"-" db:"email_change_code_hash"`
+	EmailChangeExpires  *time.Time `json:"-" db:"email_change_expires_at"`
+	StorageQuotaBytes   *int64     `json:"-" db:"storage_quota_bytes"`
+	Locale              string     `json:"locale,omitempty" db:"locale"`
 }
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *User) (*User, error)
 	FindByEmail(ctx context.Context, email string) (*User, error)
 	FindByID(ctx context.Context, userID uuid.UUID) (*User, error)
+	FindByUsername(ctx context.Context, username string) (*User, error)
+	FindByIdentity(ctx context.Context, provider string, subject string) (*User, error)
+	LinkIdentity(ctx context.Context, userID uuid.UUID, provider string, subject string, email string) error
 	UpdateIsVerified(ctx context.Context, id uuid.UUID, isVerified bool) error
 	UpdateProfileImage(ctx context.Context, userID uuid.UUID, ipfsCID string) error
+	UpdateProfile(ctx context.Context, userID uuid.UUID, displayName string, bio string, website string) error
+	UpdateUsername(ctx context.Context, userID uuid.UUID, username string) error
+	UpdateLocale(ctx context.Context, userID uuid.UUID, locale string) error
+	SetPendingEmail(ctx context.Context, userID uuid.UUID, email string, codeHash string, expiresAt time.Time) error
+	ConfirmEmailChange(ctx context.Context, userID uuid.UUID) error
+	// IncrementEmailChangeAttempts counts a confirmation attempt against the
+	// pending email change and returns the attempts made so far.
+	IncrementEmailChangeAttempts(ctx context.Context, userID uuid.UUID) (int, error)
+	CancelEmailChange(ctx context.Context, userID uuid.UUID) error
+	List(ctx context.Context, limit int, offset int) ([]*User, error)
+	UpdateRole(ctx context.Context, userID uuid.UUID, role string) error
+	UpdateStorageQuota(ctx context.Context, userID uuid.UUID, quotaBytes *int64) error
+	LockForUpdate(ctx context.Context, userID uuid.UUID) error
+	UpdateSuspended(ctx context.Context, userID uuid.UUID, suspended bool) error
+	IncrementFailedLogins(ctx context.Context, userID uuid.UUID) (int, error)
+	LockUntil(ctx context.Context, userID uuid.UUID, lockedUntil time.Time) error
+	ResetFailedLogins(ctx context.Context, userID uuid.UUID) error
+	MarkDeletionRequested(ctx context.Context, userID uuid.UUID) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+	UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error
+	// UseTOTPStep records step as the last accepted TOTP step and reports
+	// false when that step or a later one was already accepted.
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
 }
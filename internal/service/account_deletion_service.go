@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/deletions"
+	"github.com/meliocool/arkive/internal/repository/exports"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/transactor"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	accountDeletionPollInterval = time.Second * 30
+	accountDeletionBatchSize    = 10
+	accountDeletionLease        = time.Minute * 5
+	accountDeletionBaseDelay    = time.Minute
+	accountDeletionMaxDelay     = time.Hour * 6
+)
+
+type AccountDeletionService struct {
+	UserRepository     users.UserRepository
+	PhotoRepository    photos.PhotoRepository
+	DeletionRepository deletions.AccountDeletionRepository
+	ExportRepository   exports.DataExportRepository
+	Transactor         transactor.Transactor
+	TwoFactorService   *TwoFactorService
+	IpfsService        *IpfsService
+	EmailService       *EmailService
+	Logger             *slog.Logger
+}
+
+func NewAccountDeletionService(userRepository users.UserRepository, photoRepository photos.PhotoRepository, deletionRepository deletions.AccountDeletionRepository, exportRepository exports.DataExportRepository, transactor transactor.Transactor, twoFactorService *TwoFactorService, ipfsService *IpfsService, emailService *EmailService, logger *slog.Logger) *AccountDeletionService {
+	return &AccountDeletionService{
+		UserRepository:     userRepository,
+		PhotoRepository:    photoRepository,
+		DeletionRepository: deletionRepository,
+		ExportRepository:   exportRepository,
+		Transactor:         transactor,
+		TwoFactorService:   twoFactorService,
+		IpfsService:        ipfsService,
+		EmailService:       emailService,
+		Logger:             logger,
+	}
+}
+
+// RequestDeletion re-authenticates the user, revokes every token they hold and
+// queues the erasure job. The account cannot be used from this point on.
+func (ds *AccountDeletionService) RequestDeletion(ctx context.Context, userID uuid.UUID, password, code string, authenticatedAt time.Time) error {
+	user, findErr := ds.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+	if user.DeletionRequestedAt != nil {
+		return helper.ErrConflict
+	}
+
+	if reauthErr := reauthenticate(user, password, authenticatedAt); reauthErr != nil {
+		return reauthErr
+	}
+
+	if user.TOTPEnabled {
+		if verifyErr := ds.TwoFactorService.Verify(ctx, user, code); verifyErr != nil {
+			return verifyErr
+		}
+	}
+
+	return ds.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if markErr := ds.UserRepository.MarkDeletionRequested(ctx, user.ID); markErr != nil {
+			return markErr
+		}
+		_, createErr := ds.DeletionRepository.Create(ctx, &deletions.AccountDeletionJob{
+			UserID:   user.ID,
+			Email:    user.Email,
+			Username: user.Username,
+			Locale:   user.Locale,
+		})
+		return createErr
+	})
+}
+
+// Run processes queued deletions until ctx is cancelled. A job that fails
+// part-way is retried later and picks up from the last unpinned CID.
+func (ds *AccountDeletionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(accountDeletionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ds.processDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ds *AccountDeletionService) processDue(ctx context.Context) {
+	jobs, claimErr := ds.DeletionRepository.ClaimDue(ctx, accountDeletionBatchSize, accountDeletionLease)
+	if claimErr != nil {
+		if ctx.Err() == nil {
+			ds.Logger.ErrorContext(ctx, "failed to claim account deletion jobs", "error", claimErr)
+		}
+		return
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		// A job that has started is allowed to finish during shutdown; the
+		// lease bounds how long that can take.
+		jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), accountDeletionLease)
+		if processErr := ds.process(jobCtx, job); processErr != nil {
+			ds.Logger.ErrorContext(jobCtx, "account deletion failed", "user_id", job.UserID, "attempt", job.Attempts, "error", processErr)
+			nextAttempt := time.Now().Add(backoffDelay(job.Attempts-1, accountDeletionBaseDelay, accountDeletionMaxDelay))
+			if retryErr := ds.DeletionRepository.MarkRetry(jobCtx, job.ID, processErr.Error(), nextAttempt); retryErr != nil {
+				ds.Logger.ErrorContext(jobCtx, "failed to reschedule account deletion", "user_id", job.UserID, "error", retryErr)
+			}
+		}
+		cancel()
+	}
+}
+
+func (ds *AccountDeletionService) process(ctx context.Context, job *deletions.AccountDeletionJob) error {
+	photoList, findErr := ds.PhotoRepository.FindByUserID(ctx, job.UserID)
+	if findErr != nil {
+		return findErr
+	}
+
+	unpinned := make(map[string]bool, len(job.UnpinnedCIDs))
+	for _, ipfsCID := range job.UnpinnedCIDs {
+		unpinned[ipfsCID] = true
+	}
+
+	for _, photo := range photoList {
+		if unpinned[photo.IPFSCid] {
+			continue
+		}
+		if unpinErr := ds.unpinUnshared(ctx, job, photo.IPFSCid); unpinErr != nil {
+			return unpinErr
+		}
+		unpinned[photo.IPFSCid] = true
+	}
+
+	// Export archives hold the whole account, and the rows pointing at them
+	// would be cascaded away with the user, so the files go first.
+	filePaths, listErr := ds.ExportRepository.FindFilePathsByUserID(ctx, job.UserID)
+	if listErr != nil {
+		return listErr
+	}
+	for _, filePath := range filePaths {
+		if removeErr := os.Remove(filePath); removeErr != nil && !os.IsNotExist(removeErr) {
+			return fmt.Errorf("remove data export %s: %w", filePath, removeErr)
+		}
+	}
+
+	txErr := ds.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if deleteErr := ds.ExportRepository.DeleteByUserID(ctx, job.UserID); deleteErr != nil {
+			return deleteErr
+		}
+		if deleteErr := ds.PhotoRepository.DeleteByUserID(ctx, job.UserID); deleteErr != nil {
+			return deleteErr
+		}
+		if deleteErr := ds.UserRepository.Delete(ctx, job.UserID); deleteErr != nil {
+			return deleteErr
+		}
+		return ds.DeletionRepository.MarkCompleted(ctx, job.ID)
+	})
+	if txErr != nil {
+		return txErr
+	}
+
+	if emailErr := ds.EmailService.SendAccountDeletedEmailCtx(ctx, job.Email, job.Username, job.Locale); emailErr != nil {
+		ds.Logger.ErrorContext(ctx, "account deleted email failed", "user_id", job.UserID, "error", emailErr)
+	}
+	return nil
+}
+
+// unpinUnshared unpins ipfsCID unless a photo of another user still points at
+// it; either way the CID is recorded as handled. No transaction is held
+// across the call to Pinata.
+func (ds *AccountDeletionService) unpinUnshared(ctx context.Context, job *deletions.AccountDeletionJob, ipfsCID string) error {
+	shared, sharedErr := ds.PhotoRepository.IsCIDSharedWithOthers(ctx, ipfsCID, job.UserID)
+	if sharedErr != nil {
+		return sharedErr
+	}
+	if !shared {
+		if unpinErr := ds.IpfsService.UnpinFile(ctx, ipfsCID); unpinErr != nil && !errors.Is(unpinErr, ErrNotPinned) {
+			return fmt.Errorf("unpin ipfs cid %s: %w", ipfsCID, unpinErr)
+		}
+	}
+	return ds.DeletionRepository.AddUnpinned(ctx, job.ID, ipfsCID)
+}
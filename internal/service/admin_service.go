@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/moderation"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+type AdminService struct {
+	UserRepository       users.UserRepository
+	PhotoRepository      photos.PhotoRepository
+	ModerationRepository moderation.ModerationRepository
+	PhotoService         *PhotoService
+}
+
+func NewAdminService(userRepository users.UserRepository, photoRepository photos.PhotoRepository, moderationRepository moderation.ModerationRepository, photoService *PhotoService) *AdminService {
+	return &AdminService{
+		UserRepository:       userRepository,
+		PhotoRepository:      photoRepository,
+		ModerationRepository: moderationRepository,
+		PhotoService:         photoService,
+	}
+}
+
+func (as *AdminService) ListUsers(ctx context.Context, limit int, offset int) ([]*users.User, error) {
+	userList, listErr := as.UserRepository.List(ctx, limit, offset)
+	if listErr != nil {
+		return nil, listErr
+	}
+	return userList, nil
+}
+
+func (as *AdminService) SetSuspended(ctx context.Context, adminID uuid.UUID, userID uuid.UUID, suspended bool) error {
+	if adminID == userID {
+		return fmt.Errorf("%w: cannot suspend your own account", helper.ErrBadRequest)
+	}
+	if _, findErr := as.UserRepository.FindByID(ctx, userID); findErr != nil {
+		return helper.ErrNotFound
+	}
+	if updateErr := as.UserRepository.UpdateSuspended(ctx, userID, suspended); updateErr != nil {
+		return fmt.Errorf("failed to update suspension: %w", updateErr)
+	}
+
+	action := moderation.ActionSuspendUser
+	if !suspended {
+		action = moderation.ActionUnsuspendUser
+	}
+	return as.ModerationRepository.RecordAction(ctx, &moderation.Action{
+		ModeratorID:  adminID,
+		Action:       action,
+		TargetUserID: &userID,
+	})
+}
+
+func (as *AdminService) SetRole(ctx context.Context, adminID uuid.UUID, userID uuid.UUID, role string) error {
+	if !users.IsValidRole(role) {
+		return fmt.Errorf("%w: unknown role %q", helper.ErrBadRequest, role)
+	}
+	if adminID == userID {
+		return fmt.Errorf("%w: cannot change your own role", helper.ErrBadRequest)
+	}
+	if _, findErr := as.UserRepository.FindByID(ctx, userID); findErr != nil {
+		return helper.ErrNotFound
+	}
+	if updateErr := as.UserRepository.UpdateRole(ctx, userID, role); updateErr != nil {
+		return fmt.Errorf("failed to update role: %w", updateErr)
+	}
+	return nil
+}
+
+// SetStorageQuota overrides the user's quota; nil returns them to the default.
+func (as *AdminService) SetStorageQuota(ctx context.Context, userID uuid.UUID, quotaBytes *int64) error {
+	if quotaBytes != nil && *quotaBytes < 0 {
+		return fmt.Errorf("%w: quota must not be negative", helper.ErrBadRequest)
+	}
+	if _, findErr := as.UserRepository.FindByID(ctx, userID); findErr != nil {
+		return helper.ErrNotFound
+	}
+	if updateErr := as.UserRepository.UpdateStorageQuota(ctx, userID, quotaBytes); updateErr != nil {
+		return fmt.Errorf("failed to update storage quota: %w", updateErr)
+	}
+	return nil
+}
+
+func (as *AdminService) ForceDeletePhoto(ctx context.Context, adminID uuid.UUID, photoID uuid.UUID) error {
+	photo, findErr := as.PhotoRepository.FindByID(ctx, photoID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+	if removeErr := as.PhotoService.RemovePhoto(ctx, photo, PhotoRemovedByModeration); removeErr != nil {
+		return removeErr
+	}
+	return as.ModerationRepository.RecordAction(ctx, &moderation.Action{
+		ModeratorID:  adminID,
+		Action:       moderation.ActionRemove,
+		PhotoID:      &photo.ID,
+		TargetUserID: &photo.UserID,
+	})
+}
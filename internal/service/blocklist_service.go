@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/blocklist"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/transactor"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// perceptualMatchDistance is the largest number of differing bits at which
+	// two difference hashes are treated as the same image.
+	perceptualMatchDistance = 6
+	// maxHashedPixels skips the perceptual hash for images too large to decode
+	// comfortably, about 48 MB once decoded; the exact sha256 check still
+	// applies.
+	maxHashedPixels = 12_000_000
+	// perceptualCacheTTL bounds how long changes made by another instance take
+	// to reach this one; changes made here invalidate the cache right away.
+	perceptualCacheTTL = time.Minute
+)
+
+// imageDecodeSlots caps how many uploads are decoded for hashing at once, so
+// concurrent uploads cannot pile up decoded images in memory.
+var imageDecodeSlots = make(chan struct{}, 2)
+
+type BlocklistService struct {
+	BlocklistRepository blocklist.BlocklistRepository
+	Transactor          transactor.Transactor
+	IpfsService         *IpfsService
+	Logger              *slog.Logger
+
+	perceptualMu       sync.Mutex
+	perceptual         []*blocklist.BlockedHash
+	perceptualLoadedAt time.Time
+}
+
+// ContentHashes identifies an uploaded file. Perceptual is empty when the file
+// could not be decoded as an image.
+type ContentHashes struct {
+	SHA256     string
+	Perceptual string
+}
+
+func NewBlocklistService(blocklistRepository blocklist.BlocklistRepository, transactor transactor.Transactor, ipfsService *IpfsService, logger *slog.Logger) *BlocklistService {
+	return &BlocklistService{BlocklistRepository: blocklistRepository, Transactor: transactor, IpfsService: ipfsService, Logger: logger}
+}
+
+// HashContent hashes file and rewinds it so it can be uploaded afterwards.
+func HashContent(file io.ReadSeeker) (*ContentHashes, error) {
+	digest := sha256.New()
+	if _, copyErr := io.Copy(digest, file); copyErr != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", copyErr)
+	}
+	hashes := &ContentHashes{SHA256: hex.EncodeToString(digest.Sum(nil))}
+
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", seekErr)
+	}
+	if config, _, configErr := image.DecodeConfig(file); configErr == nil && config.Width*config.Height <= maxHashedPixels {
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+			return nil, fmt.Errorf("failed to rewind file: %w", seekErr)
+		}
+		imageDecodeSlots <- struct{}{}
+		if img, _, decodeErr := image.Decode(file); decodeErr == nil {
+			hashes.Perceptual = fmt.Sprintf("%016x", helper.DifferenceHash(img))
+		}
+		<-imageDecodeSlots
+	}
+
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", seekErr)
+	}
+	return hashes, nil
+}
+
+// Match returns the blocklist entry the hashes hit, or nil when the content is
+// allowed.
+func (bs *BlocklistService) Match(ctx context.Context, hashes *ContentHashes) (*blocklist.BlockedHash, error) {
+	exact, findErr := bs.BlocklistRepository.FindByValue(ctx, blocklist.KindSHA256, hashes.SHA256)
+	if findErr != nil || exact != nil {
+		return exact, findErr
+	}
+	if hashes.Perceptual == "" {
+		return nil, nil
+	}
+
+	perceptual, parseErr := strconv.ParseUint(hashes.Perceptual, 16, 64)
+	if parseErr != nil {
+		return nil, fmt.Errorf("invalid perceptual hash %q: %w", hashes.Perceptual, parseErr)
+	}
+	blocked, listErr := bs.perceptualHashes(ctx)
+	if listErr != nil {
+		return nil, listErr
+	}
+	for _, entry := range blocked {
+		value, valueErr := strconv.ParseUint(entry.Value, 16, 64)
+		if valueErr != nil {
+			continue
+		}
+		if bits.OnesCount64(value^perceptual) <= perceptualMatchDistance {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// CheckUpload rejects file when it matches the blocklist and keeps a record of
+// the attempt for moderators. file is rewound before returning.
+func (bs *BlocklistService) CheckUpload(ctx context.Context, userID uuid.UUID, filename string, file io.ReadSeeker) error {
+	hashes, hashErr := HashContent(file)
+	if hashErr != nil {
+		return hashErr
+	}
+	match, matchErr := bs.Match(ctx, hashes)
+	if matchErr != nil {
+		return matchErr
+	}
+	if match == nil {
+		return nil
+	}
+
+	bs.Logger.WarnContext(ctx, "blocked upload", "filename", filename, "user_id", userID, "kind", match.Kind, "hash", match.Value)
+	recordErr := bs.BlocklistRepository.RecordAttempt(ctx, &blocklist.Attempt{
+		UserID:         userID,
+		BlockedHashID:  &match.ID,
+		SHA256:         hashes.SHA256,
+		PerceptualHash: hashes.Perceptual,
+		Filename:       filename,
+	})
+	if recordErr != nil {
+		bs.Logger.ErrorContext(ctx, "failed to record blocked upload", "user_id", userID, "error", recordErr)
+	}
+	return fmt.Errorf("%w: this file matches content that is not allowed", helper.ErrBlockedContent)
+}
+
+// perceptualHashes returns the blocked perceptual hashes, which every image
+// upload is compared against, from a cache refreshed every perceptualCacheTTL.
+func (bs *BlocklistService) perceptualHashes(ctx context.Context) ([]*blocklist.BlockedHash, error) {
+	bs.perceptualMu.Lock()
+	defer bs.perceptualMu.Unlock()
+
+	if bs.perceptual != nil && time.Since(bs.perceptualLoadedAt) < perceptualCacheTTL {
+		return bs.perceptual, nil
+	}
+	blocked, listErr := bs.BlocklistRepository.ListByKind(ctx, blocklist.KindPerceptual)
+	if listErr != nil {
+		return nil, listErr
+	}
+	if blocked == nil {
+		blocked = []*blocklist.BlockedHash{}
+	}
+	bs.perceptual = blocked
+	bs.perceptualLoadedAt = time.Now()
+	return blocked, nil
+}
+
+func (bs *BlocklistService) invalidatePerceptual() {
+	bs.perceptualMu.Lock()
+	bs.perceptual = nil
+	bs.perceptualMu.Unlock()
+}
+
+func (bs *BlocklistService) Add(ctx context.Context, addedBy uuid.UUID, kind string, value string, note string) (bool, error) {
+	kind, value, normalizeErr := normalizeBlockedHash(kind, value)
+	if normalizeErr != nil {
+		return false, normalizeErr
+	}
+	defer bs.invalidatePerceptual()
+	return bs.BlocklistRepository.Add(ctx, &blocklist.BlockedHash{
+		Kind:    kind,
+		Value:   value,
+		Note:    strings.TrimSpace(note),
+		AddedBy: &addedBy,
+	})
+}
+
+// Import reads one hash per line, written as "sha256:<hex>" or "phash:<hex>"
+// optionally followed by a note. A bare hex value is taken as sha256 when it
+// has 64 digits and as a perceptual hash when it has 16. Blank lines and lines
+// starting with # are skipped. Nothing is imported when any line fails.
+func (bs *BlocklistService) Import(ctx context.Context, addedBy *uuid.UUID, source io.Reader) (int, int, error) {
+	defer bs.invalidatePerceptual()
+
+	added, skipped := 0, 0
+	txErr := bs.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var importErr error
+		added, skipped, importErr = bs.importLines(ctx, addedBy, source)
+		return importErr
+	})
+	if txErr != nil {
+		return 0, 0, txErr
+	}
+	return added, skipped, nil
+}
+
+func (bs *BlocklistService) importLines(ctx context.Context, addedBy *uuid.UUID, source io.Reader) (int, int, error) {
+	added, skipped := 0, 0
+	scanner := bufio.NewScanner(source)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, note, _ := strings.Cut(line, " ")
+		kind, value, found := strings.Cut(entry, ":")
+		if !found {
+			kind, value = "", entry
+		}
+		kind, value, normalizeErr := normalizeBlockedHash(kind, value)
+		if normalizeErr != nil {
+			return added, skipped, fmt.Errorf("line %d: %w", lineNumber, normalizeErr)
+		}
+
+		inserted, addErr := bs.BlocklistRepository.Add(ctx, &blocklist.BlockedHash{
+			Kind:    kind,
+			Value:   value,
+			Note:    strings.TrimSpace(note),
+			AddedBy: addedBy,
+		})
+		if addErr != nil {
+			return added, skipped, addErr
+		}
+		if inserted {
+			added++
+		} else {
+			skipped++
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return added, skipped, fmt.Errorf("%w: failed to read blocklist: %v", helper.ErrBadRequest, scanErr)
+	}
+	return added, skipped, nil
+}
+
+// BlockPhoto adds the exact and perceptual hashes of a stored photo, fetched
+// back from IPFS, so copies of it cannot be uploaded again.
+func (bs *BlocklistService) BlockPhoto(ctx context.Context, moderatorID uuid.UUID, photo *photos.Photo, note string) error {
+	content, fetchErr := bs.IpfsService.FetchFile(ctx, photo.IPFSCid)
+	if fetchErr != nil {
+		return fetchErr
+	}
+	defer content.Close()
+
+	data, readErr := io.ReadAll(content)
+	if readErr != nil {
+		return fmt.Errorf("failed to read photo %s: %w", photo.ID, readErr)
+	}
+	hashes, hashErr := HashContent(bytes.NewReader(data))
+	if hashErr != nil {
+		return hashErr
+	}
+
+	if note == "" {
+		note = "blocked from photo " + photo.ID.String()
+	}
+	if _, addErr := bs.Add(ctx, moderatorID, blocklist.KindSHA256, hashes.SHA256, note); addErr != nil {
+		return addErr
+	}
+	if hashes.Perceptual != "" {
+		if _, addErr := bs.Add(ctx, moderatorID, blocklist.KindPerceptual, hashes.Perceptual, note); addErr != nil {
+			return addErr
+		}
+	}
+	return nil
+}
+
+func (bs *BlocklistService) Remove(ctx context.Context, id uuid.UUID) error {
+	defer bs.invalidatePerceptual()
+	if deleteErr := bs.BlocklistRepository.Delete(ctx, id); deleteErr != nil {
+		return fmt.Errorf("%w: %v", helper.ErrNotFound, deleteErr)
+	}
+	return nil
+}
+
+func (bs *BlocklistService) List(ctx context.Context, limit int, offset int) ([]*blocklist.BlockedHash, error) {
+	return bs.BlocklistRepository.List(ctx, limit, offset)
+}
+
+func (bs *BlocklistService) Attempts(ctx context.Context, limit int, offset int) ([]*blocklist.Attempt, error) {
+	return bs.BlocklistRepository.ListAttempts(ctx, limit, offset)
+}
+
+func normalizeBlockedHash(kind string, value string) (string, string, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	value = strings.ToLower(strings.TrimSpace(value))
+	if kind == "" {
+		switch len(value) {
+		case 64:
+			kind = blocklist.KindSHA256
+		case 16:
+			kind = blocklist.KindPerceptual
+		}
+	}
+
+	expectedLength := 0
+	switch kind {
+	case blocklist.KindSHA256:
+		expectedLength = 64
+	case blocklist.KindPerceptual:
+		expectedLength = 16
+	default:
+		return "", "", fmt.Errorf("%w: unknown hash kind %q", helper.ErrBadRequest, kind)
+	}
+	if _, decodeErr := hex.DecodeString(value); decodeErr != nil || len(value) != expectedLength {
+		return "", "", fmt.Errorf("%w: %s hashes are %d hex digits", helper.ErrBadRequest, kind, expectedLength)
+	}
+	return kind, value, nil
+}
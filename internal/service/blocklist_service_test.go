@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/blocklist"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// memoryBlocklistRepo keeps blocked hashes and attempts in memory; any other
+// call panics on the nil embedded interface.
+type memoryBlocklistRepo struct {
+	blocklist.BlocklistRepository
+	hashes   []*blocklist.BlockedHash
+	attempts []*blocklist.Attempt
+	listed   int
+}
+
+func (r *memoryBlocklistRepo) Add(ctx context.Context, hash *blocklist.BlockedHash) (bool, error) {
+	for _, existing := range r.hashes {
+		if existing.Kind == hash.Kind && existing.Value == hash.Value {
+			return false, nil
+		}
+	}
+	stored := *hash
+	stored.ID = uuid.New()
+	r.hashes = append(r.hashes, &stored)
+	return true, nil
+}
+
+func (r *memoryBlocklistRepo) FindByValue(ctx context.Context, kind string, value string) (*blocklist.BlockedHash, error) {
+	for _, hash := range r.hashes {
+		if hash.Kind == kind && hash.Value == value {
+			return hash, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryBlocklistRepo) ListByKind(ctx context.Context, kind string) ([]*blocklist.BlockedHash, error) {
+	r.listed++
+	var matching []*blocklist.BlockedHash
+	for _, hash := range r.hashes {
+		if hash.Kind == kind {
+			matching = append(matching, hash)
+		}
+	}
+	return matching, nil
+}
+
+func (r *memoryBlocklistRepo) RecordAttempt(ctx context.Context, attempt *blocklist.Attempt) error {
+	r.attempts = append(r.attempts, attempt)
+	return nil
+}
+
+func newTestBlocklist() (*BlocklistService, *memoryBlocklistRepo) {
+	repo := &memoryBlocklistRepo{}
+	return NewBlocklistService(repo, &deferredTransactor{}, nil, slog.New(slog.NewTextHandler(io.Discard, nil))), repo
+}
+
+func TestNormalizeBlockedHash(t *testing.T) {
+	sha := strings.Repeat("ab", 32)
+	cases := []struct {
+		kind, value         string
+		wantKind, wantValue string
+		wantErr             bool
+	}{
+		{"sha256", sha, blocklist.KindSHA256, sha, false},
+		{" SHA256 ", strings.ToUpper(sha) + " ", blocklist.KindSHA256, sha, false},
+		{"", sha, blocklist.KindSHA256, sha, false},
+		{"", "00FF00FF00FF00FF", blocklist.KindPerceptual, "00ff00ff00ff00ff", false},
+		{"phash", "00ff00ff00ff00ff", blocklist.KindPerceptual, "00ff00ff00ff00ff", false},
+		{"phash", sha, "", "", true},
+		{"sha256", "00ff00ff00ff00ff", "", "", true},
+		{"sha256", strings.Repeat("zz", 32), "", "", true},
+		{"", "abc", "", "", true},
+		{"md5", "d41d8cd98f00b204e9800998ecf8427e", "", "", true},
+	}
+	for _, c := range cases {
+		kind, value, normalizeErr := normalizeBlockedHash(c.kind, c.value)
+		if c.wantErr {
+			if !errors.Is(normalizeErr, helper.ErrBadRequest) {
+				t.Errorf("normalizeBlockedHash(%q, %q) = %v, want ErrBadRequest", c.kind, c.value, normalizeErr)
+			}
+			continue
+		}
+		if normalizeErr != nil || kind != c.wantKind || value != c.wantValue {
+			t.Errorf("normalizeBlockedHash(%q, %q) = %q, %q, %v; want %q, %q", c.kind, c.value, kind, value, normalizeErr, c.wantKind, c.wantValue)
+		}
+	}
+}
+
+func TestBlocklistMatchesExactHash(t *testing.T) {
+	blocklistService, _ := newTestBlocklist()
+	sha := strings.Repeat("ab", 32)
+	if _, addErr := blocklistService.Add(context.Background(), uuid.New(), "", sha, "known bad"); addErr != nil {
+		t.Fatalf("Add: %v", addErr)
+	}
+
+	match, matchErr := blocklistService.Match(context.Background(), &ContentHashes{SHA256: sha})
+	if matchErr != nil || match == nil || match.Kind != blocklist.KindSHA256 {
+		t.Fatalf("Match = %+v, %v; want the sha256 entry", match, matchErr)
+	}
+
+	match, matchErr = blocklistService.Match(context.Background(), &ContentHashes{SHA256: strings.Repeat("cd", 32)})
+	if matchErr != nil || match != nil {
+		t.Errorf("Match of an unrelated file = %+v, %v; want nil", match, matchErr)
+	}
+}
+
+func TestBlocklistMatchesNearbyPerceptualHash(t *testing.T) {
+	blocklistService, _ := newTestBlocklist()
+	if _, addErr := blocklistService.Add(context.Background(), uuid.New(), blocklist.KindPerceptual, "00000000000000ff", ""); addErr != nil {
+		t.Fatalf("Add: %v", addErr)
+	}
+	sha := strings.Repeat("cd", 32)
+
+	// 0x3f differs from 0xff in two bits, 0xffffff00000000ff in 24.
+	near := &ContentHashes{SHA256: sha, Perceptual: fmt.Sprintf("%016x", uint64(0x3f))}
+	if match, matchErr := blocklistService.Match(context.Background(), near); matchErr != nil || match == nil {
+		t.Errorf("Match of a near copy = %+v, %v; want the perceptual entry", match, matchErr)
+	}
+	far := &ContentHashes{SHA256: sha, Perceptual: "ffffff00000000ff"}
+	if match, matchErr := blocklistService.Match(context.Background(), far); matchErr != nil || match != nil {
+		t.Errorf("Match of a different image = %+v, %v; want nil", match, matchErr)
+	}
+	if _, matchErr := blocklistService.Match(context.Background(), &ContentHashes{SHA256: sha, Perceptual: "not hex"}); matchErr == nil {
+		t.Error("Match accepted a malformed perceptual hash")
+	}
+}
+
+func TestBlocklistRefreshesPerceptualCacheOnChange(t *testing.T) {
+	blocklistService, repo := newTestBlocklist()
+	hashes := &ContentHashes{SHA256: strings.Repeat("cd", 32), Perceptual: "00000000000000ff"}
+
+	if match, _ := blocklistService.Match(context.Background(), hashes); match != nil {
+		t.Fatal("matched against an empty blocklist")
+	}
+	if match, _ := blocklistService.Match(context.Background(), hashes); match != nil || repo.listed != 1 {
+		t.Fatalf("perceptual hashes were listed %d times, want the cached list", repo.listed)
+	}
+
+	if _, addErr := blocklistService.Add(context.Background(), uuid.New(), blocklist.KindPerceptual, "00000000000000ff", ""); addErr != nil {
+		t.Fatalf("Add: %v", addErr)
+	}
+	if match, _ := blocklistService.Match(context.Background(), hashes); match == nil {
+		t.Error("a hash added on this instance was not matched right away")
+	}
+}
+
+func TestBlocklistCheckUploadRecordsAttempt(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x * 4)})
+		}
+	}
+	var encoded bytes.Buffer
+	if encodeErr := png.Encode(&encoded, img); encodeErr != nil {
+		t.Fatal(encodeErr)
+	}
+	hashes, hashErr := HashContent(bytes.NewReader(encoded.Bytes()))
+	if hashErr != nil || hashes.Perceptual == "" {
+		t.Fatalf("HashContent = %+v, %v; want a perceptual hash", hashes, hashErr)
+	}
+
+	blocklistService, repo := newTestBlocklist()
+	if _, addErr := blocklistService.Add(context.Background(), uuid.New(), blocklist.KindPerceptual, hashes.Perceptual, ""); addErr != nil {
+		t.Fatalf("Add: %v", addErr)
+	}
+
+	userID := uuid.New()
+	file := bytes.NewReader(encoded.Bytes())
+	checkErr := blocklistService.CheckUpload(context.Background(), userID, "copy.png", file)
+	if !errors.Is(checkErr, helper.ErrBlockedContent) {
+		t.Fatalf("CheckUpload = %v, want ErrBlockedContent", checkErr)
+	}
+	if offset, _ := file.Seek(0, io.SeekCurrent); offset != 0 {
+		t.Errorf("file was left at offset %d, want it rewound", offset)
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].UserID != userID || repo.attempts[0].Filename != "copy.png" {
+		t.Errorf("recorded attempts %+v, want one for the upload", repo.attempts)
+	}
+}
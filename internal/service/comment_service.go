@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/comments"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxCommentLength = 2000
+
+type CommentService struct {
+	CommentRepository comments.CommentRepository
+	PhotoRepository   photos.PhotoRepository
+	UserRepository    users.UserRepository
+}
+
+// CommentThread is a top-level comment together with its replies.
+type CommentThread struct {
+	Comment *comments.Comment
+	Replies []*comments.Comment
+}
+
+func NewCommentService(commentRepository comments.CommentRepository, photoRepository photos.PhotoRepository, userRepository users.UserRepository) *CommentService {
+	return &CommentService{CommentRepository: commentRepository, PhotoRepository: photoRepository, UserRepository: userRepository}
+}
+
+func (cs *CommentService) ListComments(ctx context.Context, photoID uuid.UUID, limit int, offset int) ([]*CommentThread, error) {
+	if _, findErr := findVisiblePhoto(ctx, cs.PhotoRepository, cs.UserRepository, photoID); findErr != nil {
+		return nil, findErr
+	}
+
+	topLevel, listErr := cs.CommentRepository.ListTopLevel(ctx, photoID, limit, offset)
+	if listErr != nil {
+		return nil, listErr
+	}
+
+	threads := make([]*CommentThread, 0, len(topLevel))
+	byID := make(map[uuid.UUID]*CommentThread, len(topLevel))
+	parentIDs := make([]uuid.UUID, 0, len(topLevel))
+	for _, comment := range topLevel {
+		thread := &CommentThread{Comment: comment}
+		threads = append(threads, thread)
+		byID[comment.ID] = thread
+		parentIDs = append(parentIDs, comment.ID)
+	}
+
+	replies, repliesErr := cs.CommentRepository.ListReplies(ctx, parentIDs)
+	if repliesErr != nil {
+		return nil, repliesErr
+	}
+	for _, reply := range replies {
+		if thread, ok := byID[*reply.ParentID]; ok {
+			thread.Replies = append(thread.Replies, reply)
+		}
+	}
+	return threads, nil
+}
+
+// AddComment posts a comment, or a reply when parentID is set. Replies always
+// attach to a top-level comment of the same photo.
+func (cs *CommentService) AddComment(ctx context.Context, userID uuid.UUID, photoID uuid.UUID, parentID *uuid.UUID, body string) (*comments.Comment, error) {
+	body, bodyErr := normalizeCommentBody(body)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+
+	photo, findErr := findVisiblePhoto(ctx, cs.PhotoRepository, cs.UserRepository, photoID)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if photo.CommentsDisabled {
+		return nil, fmt.Errorf("%w: comments are disabled for this photo", helper.ErrForbidden)
+	}
+
+	if parentID != nil {
+		parent, parentErr := cs.CommentRepository.FindByID(ctx, *parentID)
+		if parentErr != nil || parent.PhotoID != photoID || parent.HiddenAt != nil {
+			return nil, fmt.Errorf("%w: parent comment not found", helper.ErrBadRequest)
+		}
+		if parent.ParentID != nil {
+			parentID = parent.ParentID
+		}
+	}
+
+	return cs.CommentRepository.Create(ctx, &comments.Comment{
+		PhotoID:  photoID,
+		UserID:   userID,
+		ParentID: parentID,
+		Body:     body,
+	})
+}
+
+// EditComment is only open to the comment's author.
+func (cs *CommentService) EditComment(ctx context.Context, userID uuid.UUID, commentID uuid.UUID, body string) (*comments.Comment, error) {
+	body, bodyErr := normalizeCommentBody(body)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+
+	comment, findErr := cs.CommentRepository.FindByID(ctx, commentID)
+	if findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+	if comment.UserID != userID {
+		return nil, helper.ErrForbidden
+	}
+
+	if updateErr := cs.CommentRepository.UpdateBody(ctx, commentID, body); updateErr != nil {
+		return nil, fmt.Errorf("failed to edit comment: %w", updateErr)
+	}
+	return cs.CommentRepository.FindByID(ctx, commentID)
+}
+
+// DeleteComment is open to the comment's author and the owner of the photo.
+// Deleting a top-level comment removes its replies as well.
+func (cs *CommentService) DeleteComment(ctx context.Context, userID uuid.UUID, commentID uuid.UUID) error {
+	comment, findErr := cs.CommentRepository.FindByID(ctx, commentID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+	if comment.UserID != userID {
+		if ownerErr := cs.requirePhotoOwner(ctx, userID, comment.PhotoID); ownerErr != nil {
+			return ownerErr
+		}
+	}
+
+	if deleteErr := cs.CommentRepository.Delete(ctx, commentID); deleteErr != nil {
+		return fmt.Errorf("failed to delete comment: %w", deleteErr)
+	}
+	return nil
+}
+
+// SetCommentHidden lets the photo owner hide a comment from everyone else
+// without deleting it.
+func (cs *CommentService) SetCommentHidden(ctx context.Context, userID uuid.UUID, commentID uuid.UUID, hidden bool) error {
+	comment, findErr := cs.CommentRepository.FindByID(ctx, commentID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+	if ownerErr := cs.requirePhotoOwner(ctx, userID, comment.PhotoID); ownerErr != nil {
+		return ownerErr
+	}
+
+	if updateErr := cs.CommentRepository.SetHidden(ctx, commentID, hidden); updateErr != nil {
+		return fmt.Errorf("failed to update comment: %w", updateErr)
+	}
+	return nil
+}
+
+// ListHiddenComments lets the photo owner review the comments they hid, so
+// they can unhide them again.
+func (cs *CommentService) ListHiddenComments(ctx context.Context, userID uuid.UUID, photoID uuid.UUID, limit int, offset int) ([]*comments.Comment, error) {
+	if ownerErr := cs.requirePhotoOwner(ctx, userID, photoID); ownerErr != nil {
+		return nil, ownerErr
+	}
+	return cs.CommentRepository.ListHidden(ctx, photoID, limit, offset)
+}
+
+func (cs *CommentService) SetCommentsEnabled(ctx context.Context, userID uuid.UUID, photoID uuid.UUID, enabled bool) error {
+	if ownerErr := cs.requirePhotoOwner(ctx, userID, photoID); ownerErr != nil {
+		return ownerErr
+	}
+	if updateErr := cs.PhotoRepository.SetCommentsDisabled(ctx, photoID, !enabled); updateErr != nil {
+		return fmt.Errorf("failed to update photo: %w", updateErr)
+	}
+	return nil
+}
+
+func (cs *CommentService) requirePhotoOwner(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) error {
+	photo, findErr := cs.PhotoRepository.FindByID(ctx, photoID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+	if photo.UserID != userID {
+		return helper.ErrForbidden
+	}
+	return nil
+}
+
+func normalizeCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("%w: comment must not be empty", helper.ErrBadRequest)
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fmt.Errorf("%w: comment must be at most %d characters", helper.ErrBadRequest, maxCommentLength)
+	}
+	return body, nil
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/exports"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	dataExportPollInterval = time.Second * 30
+	dataExportBatchSize    = 5
+	dataExportLease        = time.Minute * 30
+	dataExportBaseDelay    = time.Minute
+	dataExportMaxDelay     = time.Hour
+	dataExportMaxAttempts  = 6
+
+	// dataExportLinkTTL is how long the emailed download link, and the archive
+	// behind it, stay available.
+	dataExportLinkTTL = time.Hour * 48
+)
+
+type DataExportService struct {
+	ExportRepository exports.DataExportRepository
+	UserRepository   users.UserRepository
+	PhotoRepository  photos.PhotoRepository
+	IpfsService      *IpfsService
+	EmailService     *EmailService
+	JwtSecret        string
+	BaseURL          string
+	Dir              string
+	Logger           *slog.Logger
+}
+
+type dataExportManifest struct {
+	ExportedAt time.Time                 `json:"exported_at"`
+	User       users.User                `json:"user"`
+	Photos     []dataExportManifestPhoto `json:"photos"`
+}
+
+type dataExportManifestPhoto struct {
+	ID        uuid.UUID `json:"id"`
+	IPFSCid   string    `json:"ipfs_cid"`
+	Filename  string    `json:"filename"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	File      string    `json:"file"`
+}
+
+func NewDataExportService(exportRepository exports.DataExportRepository, userRepository users.UserRepository, photoRepository photos.PhotoRepository, ipfsService *IpfsService, emailService *EmailService, jwtSecret, baseURL, dir string, logger *slog.Logger) *DataExportService {
+	return &DataExportService{
+		ExportRepository: exportRepository,
+		UserRepository:   userRepository,
+		PhotoRepository:  photoRepository,
+		IpfsService:      ipfsService,
+		EmailService:     emailService,
+		JwtSecret:        jwtSecret,
+		BaseURL:          baseURL,
+		Dir:              dir,
+		Logger:           logger,
+	}
+}
+
+// RequestExport queues an export of the user's profile and photos. Only one
+// export per user can be in progress at a time.
+func (es *DataExportService) RequestExport(ctx context.Context, userID uuid.UUID) (*exports.DataExport, error) {
+	if _, findErr := es.ExportRepository.FindPendingByUserID(ctx, userID); findErr == nil {
+		return nil, fmt.Errorf("%w: an export is already in progress", helper.ErrConflict)
+	}
+	// A concurrent request can still get past the check; the unique index
+	// on pending exports settles it.
+	export, createErr := es.ExportRepository.Create(ctx, userID)
+	if createErr != nil {
+		if errors.Is(createErr, exports.ErrExportInProgress) {
+			return nil, fmt.Errorf("%w: an export is already in progress", helper.ErrConflict)
+		}
+		return nil, createErr
+	}
+	return export, nil
+}
+
+// OpenExport checks the signed download token and opens the archive. The
+// caller must close the returned file.
+func (es *DataExportService) OpenExport(ctx context.Context, exportID uuid.UUID, token string) (*exports.DataExport, *os.File, error) {
+	claims, parseErr := helper.ParseToken(es.JwtSecret, token)
+	if parseErr != nil || claims.Purpose != helper.TokenPurposeExport || claims.Subject != exportID.String() {
+		return nil, nil, helper.ErrUnauthorized
+	}
+
+	export, findErr := es.ExportRepository.FindByID(ctx, exportID)
+	if findErr != nil {
+		return nil, nil, helper.ErrNotFound
+	}
+	if export.Status != exports.StatusReady || export.ExpiresAt == nil || export.ExpiresAt.Before(time.Now()) {
+		return nil, nil, helper.ErrNotFound
+	}
+
+	file, openErr := os.Open(export.FilePath)
+	if openErr != nil {
+		return nil, nil, fmt.Errorf("failed to open export archive: %w", openErr)
+	}
+	return export, file, nil
+}
+
+// Run builds queued exports and removes expired archives until ctx is cancelled.
+func (es *DataExportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(dataExportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		es.processDue(ctx)
+		es.removeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (es *DataExportService) processDue(ctx context.Context) {
+	exportList, claimErr := es.ExportRepository.ClaimDue(ctx, dataExportBatchSize, dataExportLease)
+	if claimErr != nil {
+		if ctx.Err() == nil {
+			es.Logger.ErrorContext(ctx, "failed to claim data exports", "error", claimErr)
+		}
+		return
+	}
+
+	for _, export := range exportList {
+		if ctx.Err() != nil {
+			return
+		}
+		// An export that has started is allowed to finish during shutdown;
+		// the lease bounds how long that can take.
+		exportCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dataExportLease)
+		if processErr := es.process(exportCtx, export); processErr != nil {
+			es.Logger.ErrorContext(exportCtx, "data export failed", "export_id", export.ID, "attempt", export.Attempts, "error", processErr)
+			es.retryOrFail(export, processErr)
+		}
+		cancel()
+	}
+}
+
+func (es *DataExportService) retryOrFail(export *exports.DataExport, processErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if export.Attempts >= dataExportMaxAttempts {
+		if failErr := es.ExportRepository.MarkFailed(ctx, export.ID, processErr.Error()); failErr != nil {
+			es.Logger.ErrorContext(ctx, "failed to mark data export failed", "export_id", export.ID, "error", failErr)
+		}
+		return
+	}
+
+	nextAttempt := time.Now().Add(backoffDelay(export.Attempts-1, dataExportBaseDelay, dataExportMaxDelay))
+	if retryErr := es.ExportRepository.MarkRetry(ctx, export.ID, processErr.Error(), nextAttempt); retryErr != nil {
+		es.Logger.ErrorContext(ctx, "failed to reschedule data export", "export_id", export.ID, "error", retryErr)
+	}
+}
+
+func (es *DataExportService) process(ctx context.Context, export *exports.DataExport) error {
+	user, findErr := es.UserRepository.FindByID(ctx, export.UserID)
+	if findErr != nil {
+		return findErr
+	}
+
+	archivePath, sizeBytes, buildErr := es.buildArchive(ctx, export, user)
+	if buildErr != nil {
+		return buildErr
+	}
+
+	expiresAt := time.Now().Add(dataExportLinkTTL)
+	if markErr := es.ExportRepository.MarkReady(ctx, export.ID, archivePath, sizeBytes, expiresAt); markErr != nil {
+		os.Remove(archivePath)
+		return markErr
+	}
+
+	token, tokenErr := helper.SignToken(es.JwtSecret, helper.Claims{
+		Purpose: helper.TokenPurposeExport,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: export.ID.String(),
+		},
+	}, dataExportLinkTTL)
+	if tokenErr != nil {
+		es.Logger.ErrorContext(ctx, "failed to sign data export download token", "export_id", export.ID, "error", tokenErr)
+		return nil
+	}
+
+	downloadURL := fmt.Sprintf("%s/exports/%s?token=%s", es.BaseURL, export.ID, url.QueryEscape(token))
+	if emailErr := es.EmailService.SendDataExportReadyEmailCtx(ctx, user.Email, user.Username, user.Locale, downloadURL, expiresAt); emailErr != nil {
+		es.Logger.ErrorContext(ctx, "data export ready email failed", "export_id", export.ID, "error", emailErr)
+	}
+	return nil
+}
+
+// buildArchive writes the ZIP next to its final location and only renames it
+// into place once it is complete, so a half-written archive is never served.
+func (es *DataExportService) buildArchive(ctx context.Context, export *exports.DataExport, user *users.User) (string, int64, error) {
+	photoList, findErr := es.PhotoRepository.FindByUserID(ctx, user.ID)
+	if findErr != nil {
+		return "", 0, findErr
+	}
+
+	if mkdirErr := os.MkdirAll(es.Dir, 0o700); mkdirErr != nil {
+		return "", 0, fmt.Errorf("failed to create export directory: %w", mkdirErr)
+	}
+
+	partial, createErr := os.CreateTemp(es.Dir, export.ID.String()+"-*.part")
+	if createErr != nil {
+		return "", 0, fmt.Errorf("failed to create export archive: %w", createErr)
+	}
+	defer os.Remove(partial.Name())
+	defer partial.Close()
+
+	archive := zip.NewWriter(partial)
+
+	// Credentials never leave the database, not even towards their owner.
+	profile := *user
+	profile.PasswordHash = ""
+	profile.VerificationCode = ""
+
+	manifest := dataExportManifest{
+		ExportedAt: time.Now().UTC(),
+		User:       profile,
+		Photos:     make([]dataExportManifestPhoto, 0, len(photoList)),
+	}
+
+	for _, photo := range photoList {
+		entryName := "photos/" + photo.ID.String() + "-" + path.Base(strings.ReplaceAll(photo.Filename, "\\", "/"))
+		if addErr := es.addPhoto(ctx, archive, entryName, photo); addErr != nil {
+			return "", 0, addErr
+		}
+		manifest.Photos = append(manifest.Photos, dataExportManifestPhoto{
+			ID:        photo.ID,
+			IPFSCid:   photo.IPFSCid,
+			Filename:  photo.Filename,
+			SizeBytes: photo.SizeBytes,
+			CreatedAt: photo.CreatedAt,
+			UpdatedAt: photo.UpdatedAt,
+			File:      entryName,
+		})
+	}
+
+	manifestWriter, manifestErr := archive.Create("manifest.json")
+	if manifestErr != nil {
+		return "", 0, manifestErr
+	}
+	encoder := json.NewEncoder(manifestWriter)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(manifest); encodeErr != nil {
+		return "", 0, fmt.Errorf("failed to write export manifest: %w", encodeErr)
+	}
+
+	if closeErr := archive.Close(); closeErr != nil {
+		return "", 0, fmt.Errorf("failed to finish export archive: %w", closeErr)
+	}
+	info, statErr := partial.Stat()
+	if statErr != nil {
+		return "", 0, statErr
+	}
+	if closeErr := partial.Close(); closeErr != nil {
+		return "", 0, fmt.Errorf("failed to finish export archive: %w", closeErr)
+	}
+
+	archivePath := filepath.Join(es.Dir, export.ID.String()+".zip")
+	if renameErr := os.Rename(partial.Name(), archivePath); renameErr != nil {
+		return "", 0, fmt.Errorf("failed to store export archive: %w", renameErr)
+	}
+	return archivePath, info.Size(), nil
+}
+
+func (es *DataExportService) addPhoto(ctx context.Context, archive *zip.Writer, entryName string, photo *photos.Photo) error {
+	content, fetchErr := es.IpfsService.FetchFile(ctx, photo.IPFSCid)
+	if fetchErr != nil {
+		return fmt.Errorf("fetch ipfs cid %s: %w", photo.IPFSCid, fetchErr)
+	}
+	defer content.Close()
+
+	// Images are already compressed, so they are stored as-is.
+	entry, entryErr := archive.CreateHeader(&zip.FileHeader{
+		Name:     entryName,
+		Method:   zip.Store,
+		Modified: photo.CreatedAt,
+	})
+	if entryErr != nil {
+		return entryErr
+	}
+	if _, copyErr := io.Copy(entry, content); copyErr != nil {
+		return fmt.Errorf("fetch ipfs cid %s: %w", photo.IPFSCid, copyErr)
+	}
+	return nil
+}
+
+func (es *DataExportService) removeExpired(ctx context.Context) {
+	filePaths, deleteErr := es.ExportRepository.DeleteExpired(ctx)
+	if deleteErr != nil {
+		if ctx.Err() == nil {
+			es.Logger.ErrorContext(ctx, "failed to delete expired data exports", "error", deleteErr)
+		}
+		return
+	}
+	for _, filePath := range filePaths {
+		if removeErr := os.Remove(filePath); removeErr != nil && !os.IsNotExist(removeErr) {
+			es.Logger.ErrorContext(ctx, "failed to remove expired data export file", "path", filePath, "error", removeErr)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/exports"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exportRepo serves stored exports and can fail Create the way Postgres does;
+// any other call panics on the nil embedded interface.
+type exportRepo struct {
+	exports.DataExportRepository
+	exports   map[uuid.UUID]*exports.DataExport
+	createErr error
+}
+
+func (r *exportRepo) Create(ctx context.Context, userID uuid.UUID) (*exports.DataExport, error) {
+	if r.createErr != nil {
+		return nil, r.createErr
+	}
+	export := &exports.DataExport{ID: uuid.New(), UserID: userID, Status: exports.StatusPending}
+	r.exports[export.ID] = export
+	return export, nil
+}
+
+func (r *exportRepo) FindByID(ctx context.Context, exportID uuid.UUID) (*exports.DataExport, error) {
+	if export, ok := r.exports[exportID]; ok {
+		return export, nil
+	}
+	return nil, fmt.Errorf("export not found")
+}
+
+func (r *exportRepo) FindPendingByUserID(ctx context.Context, userID uuid.UUID) (*exports.DataExport, error) {
+	for _, export := range r.exports {
+		if export.UserID == userID && export.Status == exports.StatusPending {
+			return export, nil
+		}
+	}
+	return nil, fmt.Errorf("no pending export")
+}
+
+func newTestDataExports(t *testing.T) (*DataExportService, *exportRepo) {
+	t.Helper()
+	repo := &exportRepo{exports: map[uuid.UUID]*exports.DataExport{}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewDataExportService(repo, nil, nil, nil, nil, "test-secret", "https://arkive.test", t.TempDir(), logger), repo
+}
+
+func TestRequestExportReportsExportInProgressAsConflict(t *testing.T) {
+	exportService, repo := newTestDataExports(t)
+	userID := uuid.New()
+
+	if _, requestErr := exportService.RequestExport(context.Background(), userID); requestErr != nil {
+		t.Fatalf("RequestExport: %v", requestErr)
+	}
+	if _, requestErr := exportService.RequestExport(context.Background(), userID); !errors.Is(requestErr, helper.ErrConflict) {
+		t.Errorf("second RequestExport = %v, want ErrConflict", requestErr)
+	}
+
+	// A concurrent request that got past the pending check loses on the
+	// unique index instead.
+	repo.createErr = fmt.Errorf("failed to create data export: %w", exports.ErrExportInProgress)
+	if _, requestErr := exportService.RequestExport(context.Background(), uuid.New()); !errors.Is(requestErr, helper.ErrConflict) {
+		t.Errorf("RequestExport losing the race = %v, want ErrConflict", requestErr)
+	}
+
+	repo.createErr = errors.New("connection reset")
+	if _, requestErr := exportService.RequestExport(context.Background(), uuid.New()); requestErr == nil || errors.Is(requestErr, helper.ErrConflict) {
+		t.Errorf("RequestExport with a database failure = %v, want the failure itself", requestErr)
+	}
+}
+
+func TestOpenExportChecksTokenAndStatus(t *testing.T) {
+	exportService, repo := newTestDataExports(t)
+	path := filepath.Join(exportService.Dir, "export.zip")
+	if writeErr := os.WriteFile(path, []byte("zip"), 0o600); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	expiresAt, expiredAt := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	ready := &exports.DataExport{ID: uuid.New(), Status: exports.StatusReady, FilePath: path, ExpiresAt: &expiresAt}
+	expired := &exports.DataExport{ID: uuid.New(), Status: exports.StatusReady, FilePath: path, ExpiresAt: &expiredAt}
+	pending := &exports.DataExport{ID: uuid.New(), Status: exports.StatusPending}
+	for _, export := range []*exports.DataExport{ready, expired, pending} {
+		repo.exports[export.ID] = export
+	}
+	sign := func(purpose string, exportID uuid.UUID) string {
+		token, signErr := helper.SignToken("test-secret", helper.Claims{
+			Purpose:          purpose,
+			RegisteredClaims: jwt.RegisteredClaims{Subject: exportID.String()},
+		}, time.Hour)
+		if signErr != nil {
+			t.Fatal(signErr)
+		}
+		return token
+	}
+
+	export, file, openErr := exportService.OpenExport(context.Background(), ready.ID, sign(helper.TokenPurposeExport, ready.ID))
+	if openErr != nil {
+		t.Fatalf("OpenExport: %v", openErr)
+	}
+	file.Close()
+	if export.ID != ready.ID {
+		t.Errorf("opened export %s, want %s", export.ID, ready.ID)
+	}
+
+	if _, _, openErr = exportService.OpenExport(context.Background(), ready.ID, sign(helper.TokenPurposeUnsubscribe, ready.ID)); !errors.Is(openErr, helper.ErrUnauthorized) {
+		t.Errorf("token with another purpose: OpenExport = %v, want ErrUnauthorized", openErr)
+	}
+	if _, _, openErr = exportService.OpenExport(context.Background(), ready.ID, sign(helper.TokenPurposeExport, expired.ID)); !errors.Is(openErr, helper.ErrUnauthorized) {
+		t.Errorf("token for another export: OpenExport = %v, want ErrUnauthorized", openErr)
+	}
+	for name, export := range map[string]*exports.DataExport{"expired": expired, "pending": pending} {
+		if _, _, openErr = exportService.OpenExport(context.Background(), export.ID, sign(helper.TokenPurposeExport, export.ID)); !errors.Is(openErr, helper.ErrNotFound) {
+			t.Errorf("%s export: OpenExport = %v, want ErrNotFound", name, openErr)
+		}
+	}
+}
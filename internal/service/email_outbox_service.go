@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/mail"
+	"github.com/meliocool/arkive/internal/metrics"
+	"github.com/meliocool/arkive/internal/repository/emails"
+	"github.com/meliocool/arkive/internal/repository/transactor"
+	"log/slog"
+	"time"
+)
+
+const (
+	emailOutboxPollInterval = time.Second * 10
+	emailOutboxBatchSize    = 20
+	emailOutboxLease        = time.Minute * 2
+	emailOutboxBaseDelay    = time.Second * 30
+	emailOutboxMaxDelay     = time.Hour * 2
+	// emailOutboxMaxAttempts spreads delivery over roughly a day before the
+	// email is dead-lettered.
+	emailOutboxMaxAttempts = 16
+	// emailOutboxMaxAge dead-letters an email that could not be delivered in
+	// time regardless of its attempts, e.g. after repeated restarts.
+	emailOutboxMaxAge = time.Hour * 48
+	// emailOutboxSentRetention is how long delivered emails, whose bodies hold
+	// codes and signed links, are kept around for troubleshooting.
+	emailOutboxSentRetention = time.Hour * 24
+	emailOutboxSweepInterval = time.Minute * 10
+)
+
+// EmailOutboxService stores outgoing emails and delivers them in the
+// background, so a send is only as fallible as the database write.
+type EmailOutboxService struct {
+	OutboxRepository emails.EmailOutboxRepository
+	Transactor       transactor.Transactor
+	Mailer           mail.Mailer
+	Metrics          *metrics.Metrics
+	Logger           *slog.Logger
+	wake             chan struct{}
+}
+
+func NewEmailOutboxService(outboxRepository emails.EmailOutboxRepository, transactor transactor.Transactor, mailer mail.Mailer, appMetrics *metrics.Metrics, logger *slog.Logger) *EmailOutboxService {
+	return &EmailOutboxService{
+		OutboxRepository: outboxRepository,
+		Transactor:       transactor,
+		Mailer:           mailer,
+		Metrics:          appMetrics,
+		Logger:           logger,
+		wake:             make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores message for delivery. Inside a transaction the email is only
+// delivered once the transaction commits, and the worker is only woken then so
+// it does not look for the row before it is visible.
+func (eo *EmailOutboxService) Enqueue(ctx context.Context, message *mail.Message) error {
+	_, enqueueErr := eo.OutboxRepository.Enqueue(ctx, &emails.OutboxEmail{
+		ToEmail:   message.To.Email,
+		ToName:    message.To.Name,
+		FromEmail: message.From.Email,
+		FromName:  message.From.Name,
+		Subject:   message.Subject,
+		TextBody:  message.Text,
+		HTMLBody:  message.HTML,
+
+		ListUnsubscribe:     message.ListUnsubscribe,
+		OneClickUnsubscribe: message.OneClickUnsubscribe,
+		InlineImages:        toOutboxImages(message.Inline),
+	})
+	if enqueueErr != nil {
+		return enqueueErr
+	}
+	eo.Metrics.ObserveEmail(metrics.EmailQueued)
+	eo.Transactor.AfterCommit(ctx, eo.signal)
+	return nil
+}
+
+func (eo *EmailOutboxService) signal() {
+	select {
+	case eo.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (eo *EmailOutboxService) DeadLetters(ctx context.Context, limit int, offset int) ([]*emails.OutboxEmail, error) {
+	return eo.OutboxRepository.ListDead(ctx, limit, offset)
+}
+
+func (eo *EmailOutboxService) Retry(ctx context.Context, id uuid.UUID) error {
+	if requeueErr := eo.OutboxRepository.Requeue(ctx, id); requeueErr != nil {
+		return fmt.Errorf("%w: %v", helper.ErrNotFound, requeueErr)
+	}
+	eo.signal()
+	return nil
+}
+
+// Run delivers due emails until ctx is cancelled. Failed deliveries are retried
+// with exponential backoff and dead-lettered after emailOutboxMaxAttempts or
+// emailOutboxMaxAge, whichever comes first. Sent emails are deleted after
+// emailOutboxSentRetention.
+func (eo *EmailOutboxService) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailOutboxPollInterval)
+	defer ticker.Stop()
+	sweepTicker := time.NewTicker(emailOutboxSweepInterval)
+	defer sweepTicker.Stop()
+
+	eo.sweep(ctx)
+	for {
+		eo.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-eo.wake:
+		case <-sweepTicker.C:
+			eo.sweep(ctx)
+		}
+	}
+}
+
+func (eo *EmailOutboxService) sweep(ctx context.Context) {
+	expired, expireErr := eo.OutboxRepository.ExpirePending(ctx, emailOutboxMaxAge, fmt.Sprintf("not delivered within %s", emailOutboxMaxAge))
+	if expireErr != nil {
+		if ctx.Err() == nil {
+			eo.Logger.ErrorContext(ctx, "failed to expire outbox emails", "error", expireErr)
+		}
+		return
+	}
+	if expired > 0 {
+		eo.Logger.ErrorContext(ctx, "emails dead-lettered after max age", "count", expired)
+		for range expired {
+			eo.Metrics.ObserveEmail(metrics.EmailDead)
+		}
+	}
+
+	if _, deleteErr := eo.OutboxRepository.DeleteSent(ctx, emailOutboxSentRetention); deleteErr != nil && ctx.Err() == nil {
+		eo.Logger.ErrorContext(ctx, "failed to delete sent outbox emails", "error", deleteErr)
+	}
+}
+
+func (eo *EmailOutboxService) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, claimErr := eo.OutboxRepository.ClaimDue(ctx, emailOutboxBatchSize, emailOutboxLease)
+		if claimErr != nil {
+			if ctx.Err() == nil {
+				eo.Logger.ErrorContext(ctx, "failed to claim outbox emails", "error", claimErr)
+			}
+			return
+		}
+
+		for i, email := range batch {
+			if ctx.Err() != nil {
+				// Release what was claimed but not attempted so the next run
+				// does not have to wait out the lease.
+				for _, unsent := range batch[i:] {
+					eo.release(unsent)
+				}
+				return
+			}
+			eo.deliver(ctx, email)
+		}
+
+		if len(batch) < emailOutboxBatchSize {
+			return
+		}
+	}
+}
+
+func (eo *EmailOutboxService) deliver(ctx context.Context, email *emails.OutboxEmail) {
+	// A delivery that has started is allowed to finish during shutdown.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), emailOutboxLease/2)
+	defer cancel()
+
+	sendErr := eo.Mailer.Send(sendCtx, &mail.Message{
+		From:    mail.Address{Name: email.FromName, Email: email.FromEmail},
+		To:      mail.Address{Name: email.ToName, Email: email.ToEmail},
+		Subject: email.Subject,
+		Text:    email.TextBody,
+		HTML:    email.HTMLBody,
+
+		ListUnsubscribe:     email.ListUnsubscribe,
+		OneClickUnsubscribe: email.OneClickUnsubscribe,
+		Inline:              fromOutboxImages(email.InlineImages),
+	})
+	if sendErr == nil {
+		eo.Metrics.ObserveEmail(metrics.EmailSent)
+		if markErr := eo.OutboxRepository.MarkSent(sendCtx, email.ID); markErr != nil {
+			eo.Logger.ErrorContext(sendCtx, "failed to mark email sent", "email_id", email.ID, "error", markErr)
+		}
+		return
+	}
+
+	if email.Attempts >= emailOutboxMaxAttempts {
+		eo.Metrics.ObserveEmail(metrics.EmailDead)
+		eo.Logger.ErrorContext(sendCtx, "email dead-lettered", "email_id", email.ID, "to", email.ToEmail, "attempts", email.Attempts, "error", sendErr)
+		if deadErr := eo.OutboxRepository.MarkDead(sendCtx, email.ID, sendErr.Error()); deadErr != nil {
+			eo.Logger.ErrorContext(sendCtx, "failed to dead-letter email", "email_id", email.ID, "error", deadErr)
+		}
+		return
+	}
+
+	eo.Metrics.ObserveEmail(metrics.EmailRetry)
+	eo.Logger.WarnContext(sendCtx, "email delivery failed", "email_id", email.ID, "to", email.ToEmail, "attempt", email.Attempts, "error", sendErr)
+	nextAttempt := time.Now().Add(backoffDelay(email.Attempts-1, emailOutboxBaseDelay, emailOutboxMaxDelay))
+	if retryErr := eo.OutboxRepository.MarkRetry(sendCtx, email.ID, sendErr.Error(), nextAttempt); retryErr != nil {
+		eo.Logger.ErrorContext(sendCtx, "failed to reschedule email", "email_id", email.ID, "error", retryErr)
+	}
+}
+
+func (eo *EmailOutboxService) release(email *emails.OutboxEmail) {
+	releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if releaseErr := eo.OutboxRepository.Release(releaseCtx, email.ID); releaseErr != nil {
+		eo.Logger.ErrorContext(releaseCtx, "failed to release email", "email_id", email.ID, "error", releaseErr)
+	}
+}
+
+func toOutboxImages(images []mail.InlineImage) []emails.InlineImage {
+	converted := make([]emails.InlineImage, 0, len(images))
+	for _, image := range images {
+		converted = append(converted, emails.InlineImage(image))
+	}
+	return converted
+}
+
+func fromOutboxImages(images []emails.InlineImage) []mail.InlineImage {
+	converted := make([]mail.InlineImage, 0, len(images))
+	for _, image := range images {
+		converted = append(converted, mail.InlineImage(image))
+	}
+	return converted
+}
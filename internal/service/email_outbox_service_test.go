@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/mail"
+	"github.com/meliocool/arkive/internal/repository/emails"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryOutboxRepo is an in-memory EmailOutboxRepository that claims and
+// reschedules emails the way the Postgres one does.
+type memoryOutboxRepo struct {
+	mu     sync.Mutex
+	emails []*emails.OutboxEmail
+}
+
+func (r *memoryOutboxRepo) Enqueue(ctx context.Context, email *emails.OutboxEmail) (*emails.OutboxEmail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *email
+	stored.ID = uuid.New()
+	stored.Status = emails.StatusPending
+	stored.NextAttemptAt = time.Now()
+	stored.CreatedAt = time.Now()
+	r.emails = append(r.emails, &stored)
+	return &stored, nil
+}
+
+func (r *memoryOutboxRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*emails.OutboxEmail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var claimed []*emails.OutboxEmail
+	for _, email := range r.emails {
+		if len(claimed) == limit {
+			break
+		}
+		if email.Status != emails.StatusPending || email.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+		email.Attempts++
+		email.NextAttemptAt = time.Now().Add(lease)
+		copied := *email
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (r *memoryOutboxRepo) update(id uuid.UUID, fn func(email *emails.OutboxEmail)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, email := range r.emails {
+		if email.ID == id {
+			fn(email)
+			return nil
+		}
+	}
+	return fmt.Errorf("email does not exist")
+}
+
+func (r *memoryOutboxRepo) MarkSent(ctx context.Context, id uuid.UUID) error {
+	return r.update(id, func(email *emails.OutboxEmail) {
+		sentAt := time.Now()
+		email.Status, email.SentAt = emails.StatusSent, &sentAt
+	})
+}
+
+func (r *memoryOutboxRepo) MarkRetry(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	return r.update(id, func(email *emails.OutboxEmail) {
+		email.LastError, email.NextAttemptAt = lastError, nextAttemptAt
+	})
+}
+
+func (r *memoryOutboxRepo) MarkDead(ctx context.Context, id uuid.UUID, lastError string) error {
+	return r.update(id, func(email *emails.OutboxEmail) {
+		email.Status, email.LastError = emails.StatusDead, lastError
+	})
+}
+
+func (r *memoryOutboxRepo) Release(ctx context.Context, id uuid.UUID) error {
+	return r.update(id, func(email *emails.OutboxEmail) {
+		email.Attempts = max(email.Attempts-1, 0)
+		email.NextAttemptAt = time.Now()
+	})
+}
+
+func (r *memoryOutboxRepo) ListDead(ctx context.Context, limit int, offset int) ([]*emails.OutboxEmail, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var dead []*emails.OutboxEmail
+	for _, email := range r.emails {
+		if email.Status == emails.StatusDead {
+			dead = append(dead, email)
+		}
+	}
+	return dead, nil
+}
+
+func (r *memoryOutboxRepo) Requeue(ctx context.Context, id uuid.UUID) error {
+	return r.update(id, func(email *emails.OutboxEmail) {
+		email.Status, email.Attempts, email.NextAttemptAt = emails.StatusPending, 0, time.Now()
+	})
+}
+
+func (r *memoryOutboxRepo) DeleteSent(ctx context.Context, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (r *memoryOutboxRepo) ExpirePending(ctx context.Context, maxAge time.Duration, lastError string) (int64, error) {
+	return 0, nil
+}
+
+func (r *memoryOutboxRepo) get(t *testing.T, id uuid.UUID) emails.OutboxEmail {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, email := range r.emails {
+		if email.ID == id {
+			return *email
+		}
+	}
+	t.Fatalf("email %s not found", id)
+	return emails.OutboxEmail{}
+}
+
+// deferredTransactor runs fn directly and holds AfterCommit hooks until the
+// outermost WithinTransaction returns without error.
+type deferredTransactor struct {
+	depth int
+	hooks []func()
+}
+
+func (d *deferredTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	d.depth++
+	fnErr := fn(ctx)
+	d.depth--
+	if d.depth > 0 {
+		return fnErr
+	}
+	hooks := d.hooks
+	d.hooks = nil
+	if fnErr != nil {
+		return fnErr
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+func (d *deferredTransactor) AfterCommit(ctx context.Context, fn func()) {
+	if d.depth == 0 {
+		fn()
+		return
+	}
+	d.hooks = append(d.hooks, fn)
+}
+
+type failingMailer struct {
+	err error
+}
+
+func (f failingMailer) Send(ctx context.Context, message *mail.Message) error {
+	return f.err
+}
+
+func newTestOutbox(mailer mail.Mailer) (*EmailOutboxService, *memoryOutboxRepo, *deferredTransactor) {
+	repo := &memoryOutboxRepo{}
+	tx := &deferredTransactor{}
+	return NewEmailOutboxService(repo, tx, mailer, nil, slog.New(slog.NewTextHandler(io.Discard, nil))), repo, tx
+}
+
+func testOutboxMessage() *mail.Message {
+	return &mail.Message{
+		From:                mail.Address{Name: "Arkive", Email: "no-reply@arkive.test"},
+		To:                  mail.Address{Name: "Ana", Email: "ana@example.com"},
+		Subject:             "Verify your account",
+		Text:                "Your code is 123456.",
+		HTML:                "<p>Your code is 123456.</p>",
+		ListUnsubscribe:     []string{"https://arkive.test/unsubscribe?token=abc"},
+		OneClickUnsubscribe: true,
+		Inline:              []mail.InlineImage{{ContentID: "logo", ContentType: "image/png", Filename: "logo.png", Data: []byte{1, 2, 3}}},
+	}
+}
+
+func TestEmailOutboxDeliversQueuedEmail(t *testing.T) {
+	outbox := mail.NewMemoryOutbox()
+	outboxService, repo, _ := newTestOutbox(outbox)
+
+	if enqueueErr := outboxService.Enqueue(context.Background(), testOutboxMessage()); enqueueErr != nil {
+		t.Fatalf("Enqueue: %v", enqueueErr)
+	}
+	if len(outbox.Messages()) != 0 {
+		t.Fatal("email was sent before the worker ran")
+	}
+
+	outboxService.deliverDue(context.Background())
+
+	sent := outbox.Messages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	want := testOutboxMessage()
+	if sent[0].To != want.To || sent[0].From != want.From || sent[0].Subject != want.Subject ||
+		sent[0].Text != want.Text || sent[0].HTML != want.HTML || !sent[0].OneClickUnsubscribe ||
+		len(sent[0].ListUnsubscribe) != 1 || len(sent[0].Inline) != 1 || sent[0].Inline[0].ContentID != "logo" {
+		t.Errorf("sent message %+v does not match the queued one", sent[0])
+	}
+	if stored := repo.get(t, repo.emails[0].ID); stored.Status != emails.StatusSent {
+		t.Errorf("status = %q, want %q", stored.Status, emails.StatusSent)
+	}
+
+	outboxService.deliverDue(context.Background())
+	if len(outbox.Messages()) != 1 {
+		t.Error("a sent email was delivered again")
+	}
+}
+
+func TestEmailOutboxWakesWorkerOnlyAfterCommit(t *testing.T) {
+	outboxService, _, tx := newTestOutbox(mail.NewMemoryOutbox())
+
+	rollbackErr := errors.New("rollback")
+	txErr := tx.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		if enqueueErr := outboxService.Enqueue(ctx, testOutboxMessage()); enqueueErr != nil {
+			return enqueueErr
+		}
+		return rollbackErr
+	})
+	if !errors.Is(txErr, rollbackErr) {
+		t.Fatalf("WithinTransaction = %v, want %v", txErr, rollbackErr)
+	}
+	if len(outboxService.wake) != 0 {
+		t.Fatal("worker was woken for a rolled back transaction")
+	}
+
+	txErr = tx.WithinTransaction(context.Background(), func(ctx context.Context) error {
+		if enqueueErr := outboxService.Enqueue(ctx, testOutboxMessage()); enqueueErr != nil {
+			return enqueueErr
+		}
+		if len(outboxService.wake) != 0 {
+			t.Error("worker was woken before the transaction committed")
+		}
+		return nil
+	})
+	if txErr != nil {
+		t.Fatalf("WithinTransaction: %v", txErr)
+	}
+	if len(outboxService.wake) != 1 {
+		t.Error("worker was not woken after the transaction committed")
+	}
+}
+
+func TestEmailOutboxRetriesThenDeadLetters(t *testing.T) {
+	outboxService, repo, _ := newTestOutbox(failingMailer{err: errors.New("connection refused")})
+
+	if enqueueErr := outboxService.Enqueue(context.Background(), testOutboxMessage()); enqueueErr != nil {
+		t.Fatalf("Enqueue: %v", enqueueErr)
+	}
+	id := repo.emails[0].ID
+
+	outboxService.deliverDue(context.Background())
+	retried := repo.get(t, id)
+	if retried.Status != emails.StatusPending || retried.Attempts != 1 || retried.LastError != "connection refused" {
+		t.Fatalf("after one failure got status %q, attempts %d, error %q", retried.Status, retried.Attempts, retried.LastError)
+	}
+	if delay := time.Until(retried.NextAttemptAt); delay < emailOutboxBaseDelay/2 || delay > emailOutboxBaseDelay*2 {
+		t.Errorf("next attempt in %s, want about %s", delay, emailOutboxBaseDelay)
+	}
+
+	for attempt := 2; attempt <= emailOutboxMaxAttempts; attempt++ {
+		_ = repo.update(id, func(email *emails.OutboxEmail) { email.NextAttemptAt = time.Now() })
+		outboxService.deliverDue(context.Background())
+	}
+	dead := repo.get(t, id)
+	if dead.Status != emails.StatusDead || dead.Attempts != emailOutboxMaxAttempts {
+		t.Fatalf("got status %q after %d attempts, want %q after %d", dead.Status, dead.Attempts, emails.StatusDead, emailOutboxMaxAttempts)
+	}
+
+	if retryErr := outboxService.Retry(context.Background(), id); retryErr != nil {
+		t.Fatalf("Retry: %v", retryErr)
+	}
+	if requeued := repo.get(t, id); requeued.Status != emails.StatusPending || requeued.Attempts != 0 {
+		t.Errorf("requeued email has status %q and %d attempts", requeued.Status, requeued.Attempts)
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/meliocool/arkive/internal/helper"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	TemplateVerification    = "verification_email"
+	TemplatePasswordReset   = "password_reset_email"
+	TemplateAccountLocked   = "account_locked_email"
+	TemplateAccountDeleted  = "account_deleted_email"
+	TemplateDataExportReady = "data_export_ready_email"
+	TemplateEmailChange     = "email_change_email"
+	TemplateNotification    = "notification_email"
+)
+
+const (
+	defaultTemplateLocale     = ""
+	subjectTemplateDefinition = "subject"
+)
+
+// emailTemplateSamples lists every template the registry requires, with the
+// data used to preview it.
+var emailTemplateSamples = map[string]any{
+	TemplateVerification: VerificationEmailData{
+		Username: "jane", Email: "jane@example.com", VerificationCode: "123456", RegistrationDate: sampleTime(),
+	},
+	TemplatePasswordReset: PasswordResetEmailData{
+		Username: "jane", Email: "jane@example.com", ResetURL: "https://arkive.example.com/reset?token=example", ExpiresAt: sampleTime().Add(time.Hour),
+	},
+	TemplateAccountLocked: AccountLockedEmailData{
+		Username: "jane", Email: "jane@example.com", LockedUntil: sampleTime().Add(15 * time.Minute),
+	},
+	TemplateAccountDeleted: AccountDeletedEmailData{
+		Username: "jane", Email: "jane@example.com",
+	},
+	TemplateDataExportReady: DataExportReadyEmailData{
+		Username: "jane", Email: "jane@example.com", DownloadURL: "https://arkive.example.com/exports/example", ExpiresAt: sampleTime().Add(48 * time.Hour),
+	},
+	TemplateEmailChange: EmailChangeEmailData{
+		Username: "jane", Email: "jane.new@example.com", Code: "654321",
+	},
+	TemplateNotification: NotificationEmailData{
+		Username: "jane", Email: "jane@example.com", Title: "New sign-in to your account", Body: "Your account was signed in to from 203.0.113.7.",
+		UnsubscribeURL: "https://arkive.example.com/unsubscribe/example",
+	},
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8}){0,2}$`)
+
+var emailTemplateFuncs = map[string]any{
+	"rfc1123": func(t time.Time) string { return t.Format(time.RFC1123) },
+}
+
+func sampleTime() time.Time {
+	return time.Date(2025, time.January, 15, 9, 30, 0, 0, time.UTC)
+}
+
+// RenderedEmail is a template executed for one recipient.
+type RenderedEmail struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+	// Locale is the variant that was used; empty for the default.
+	Locale string `json:"locale"`
+}
+
+type EmailTemplateInfo struct {
+	Name    string   `json:"name"`
+	Locales []string `json:"locales"`
+}
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// TemplateRegistry holds every email template, parsed once at startup.
+type TemplateRegistry struct {
+	templates map[string]map[string]*emailTemplate
+}
+
+// NewTemplateRegistry parses the templates in fsys and fails when a required
+// template has no default variant or a variant lacks its HTML or text half.
+func NewTemplateRegistry(fsys fs.FS) (*TemplateRegistry, error) {
+	registry := &TemplateRegistry{templates: map[string]map[string]*emailTemplate{}}
+
+	entries, readErr := fs.ReadDir(fsys, ".")
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read email templates: %w", readErr)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileName := entry.Name()
+		extension := path.Ext(fileName)
+		if extension != ".html" && extension != ".txt" {
+			continue
+		}
+		name, locale, _ := strings.Cut(strings.TrimSuffix(fileName, extension), ".")
+		locale = normalizeLocale(locale)
+
+		content, fileErr := fs.ReadFile(fsys, fileName)
+		if fileErr != nil {
+			return nil, fmt.Errorf("failed to read email template %s: %w", fileName, fileErr)
+		}
+		variant := registry.variant(name, locale)
+		switch extension {
+		case ".html":
+			tmpl, parseErr := htmltemplate.New(fileName).Funcs(emailTemplateFuncs).Parse(string(content))
+			if parseErr != nil {
+				return nil, fmt.Errorf("failed to parse email template %s: %w", fileName, parseErr)
+			}
+			variant.html = tmpl
+		case ".txt":
+			tmpl, parseErr := texttemplate.New(fileName).Funcs(emailTemplateFuncs).Parse(string(content))
+			if parseErr != nil {
+				return nil, fmt.Errorf("failed to parse email template %s: %w", fileName, parseErr)
+			}
+			if tmpl.Lookup(subjectTemplateDefinition) == nil {
+				return nil, fmt.Errorf("email template %s does not define a subject", fileName)
+			}
+			variant.text = tmpl
+		}
+	}
+
+	for name, variants := range registry.templates {
+		for locale, variant := range variants {
+			if variant.html == nil || variant.text == nil {
+				return nil, fmt.Errorf("email template %s (locale %q) needs both an .html and a .txt file", name, locale)
+			}
+		}
+	}
+	for name := range emailTemplateSamples {
+		if registry.templates[name][defaultTemplateLocale] == nil {
+			return nil, fmt.Errorf("missing email template %s", name)
+		}
+	}
+	return registry, nil
+}
+
+func (tr *TemplateRegistry) variant(name string, locale string) *emailTemplate {
+	if tr.templates[name] == nil {
+		tr.templates[name] = map[string]*emailTemplate{}
+	}
+	if tr.templates[name][locale] == nil {
+		tr.templates[name][locale] = &emailTemplate{}
+	}
+	return tr.templates[name][locale]
+}
+
+// Render executes template name for locale, falling back from a regional
+// variant ("pt-br") to its language ("pt") and then to the default.
+func (tr *TemplateRegistry) Render(name string, locale string, data any) (*RenderedEmail, error) {
+	variants := tr.templates[name]
+	if variants == nil {
+		return nil, fmt.Errorf("%w: unknown email template %q", helper.ErrNotFound, name)
+	}
+
+	for _, candidate := range localeCandidates(locale) {
+		variant := variants[candidate]
+		if variant == nil {
+			continue
+		}
+
+		var subject, text, html bytes.Buffer
+		if execErr := variant.text.ExecuteTemplate(&subject, subjectTemplateDefinition, data); execErr != nil {
+			return nil, fmt.Errorf("failed to render %s subject: %w", name, execErr)
+		}
+		if execErr := variant.text.Execute(&text, data); execErr != nil {
+			return nil, fmt.Errorf("failed to render %s text: %w", name, execErr)
+		}
+		if execErr := variant.html.Execute(&html, data); execErr != nil {
+			return nil, fmt.Errorf("failed to render %s html: %w", name, execErr)
+		}
+		return &RenderedEmail{
+			Subject: strings.Join(strings.Fields(subject.String()), " "),
+			Text:    strings.TrimSpace(text.String()) + "\n",
+			HTML:    html.String(),
+			Locale:  candidate,
+		}, nil
+	}
+	return nil, fmt.Errorf("missing default variant of email template %q", name)
+}
+
+// Preview renders template name with sample data.
+func (tr *TemplateRegistry) Preview(name string, locale string) (*RenderedEmail, error) {
+	data, ok := emailTemplateSamples[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: no preview data for email template %q", helper.ErrNotFound, name)
+	}
+	return tr.Render(name, locale, data)
+}
+
+func (tr *TemplateRegistry) List() []EmailTemplateInfo {
+	infos := make([]EmailTemplateInfo, 0, len(tr.templates))
+	for name, variants := range tr.templates {
+		locales := make([]string, 0, len(variants))
+		for locale := range variants {
+			if locale != defaultTemplateLocale {
+				locales = append(locales, locale)
+			}
+		}
+		sort.Strings(locales)
+		infos = append(infos, EmailTemplateInfo{Name: name, Locales: locales})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// ValidateLocale normalizes a BCP 47 style tag such as "pt_BR" to "pt-br". Any
+// well-formed tag is accepted; locales without templates fall back to the
+// default ones.
+func ValidateLocale(locale string) (string, error) {
+	locale = normalizeLocale(locale)
+	if locale != "" && !localePattern.MatchString(locale) {
+		return "", fmt.Errorf("%w: invalid locale %q", helper.ErrBadRequest, locale)
+	}
+	return locale, nil
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func localeCandidates(locale string) []string {
+	locale = normalizeLocale(locale)
+	var candidates []string
+	for locale != "" {
+		candidates = append(candidates, locale)
+		cut := strings.LastIndex(locale, "-")
+		if cut < 0 {
+			break
+		}
+		locale = locale[:cut]
+	}
+	return append(candidates, defaultTemplateLocale)
+}
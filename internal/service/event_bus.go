@@ -0,0 +1,215 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/metrics"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"sync"
+	"time"
+)
+
+const (
+	EventPhotoCreated        = "photo.created"
+	EventPhotoDeleted        = "photo.deleted"
+	EventProfileUpdated      = "profile.updated"
+	EventNotificationCreated = "notification.created"
+
+	// eventHistorySize is how many recent events are kept per user so a
+	// reconnecting client can resume from its Last-Event-ID.
+	eventHistorySize = 100
+	// eventReplayWindow is how long events stay resumable once a user has no
+	// open streams; older history is swept every eventSweepInterval.
+	eventReplayWindow  = 5 * time.Minute
+	eventSweepInterval = time.Minute
+	// eventSubscriberBuffer bounds how far a slow subscriber may fall behind
+	// before further events to it are dropped; it can catch up by reconnecting.
+	eventSubscriberBuffer = 32
+)
+
+// Event is a change pushed to a user's open event streams. IDs increase
+// monotonically for the lifetime of the process.
+type Event struct {
+	ID        uint64
+	Type      string
+	UserID    uuid.UUID
+	Data      any
+	CreatedAt time.Time
+}
+
+type PhotoEventData struct {
+	ID        uuid.UUID `json:"id"`
+	Filename  string    `json:"filename"`
+	IPFSCid   string    `json:"ipfs_cid,omitempty"`
+	SizeBytes int64     `json:"size_bytes,omitempty"`
+}
+
+type ProfileEventData struct {
+	ID              uuid.UUID `json:"id"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	DisplayName     string    `json:"display_name"`
+	Bio             string    `json:"bio"`
+	Website         string    `json:"website"`
+	ProfileImageCID string    `json:"profile_image_cid,omitempty"`
+}
+
+// EventBus fans events out to every open stream of the user they belong to.
+// It is in-memory, so streams only see events published by this instance and
+// resuming works as long as the process has not restarted.
+type EventBus struct {
+	Metrics *metrics.Metrics
+
+	mu          sync.Mutex
+	lastID      uint64
+	closed      bool
+	done        chan struct{}
+	history     map[uuid.UUID][]Event
+	subscribers map[uuid.UUID]map[chan Event]struct{}
+}
+
+func NewEventBus(appMetrics *metrics.Metrics) *EventBus {
+	eb := &EventBus{
+		Metrics:     appMetrics,
+		done:        make(chan struct{}),
+		history:     map[uuid.UUID][]Event{},
+		subscribers: map[uuid.UUID]map[chan Event]struct{}{},
+	}
+	go eb.sweepLoop()
+	return eb
+}
+
+func (eb *EventBus) Publish(userID uuid.UUID, eventType string, data any) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.closed {
+		return
+	}
+
+	eb.lastID++
+	event := Event{ID: eb.lastID, Type: eventType, UserID: userID, Data: data, CreatedAt: time.Now()}
+
+	history := append(eb.history[userID], event)
+	if len(history) > eventHistorySize {
+		history = history[len(history)-eventHistorySize:]
+	}
+	eb.history[userID] = history
+
+	for subscriber := range eb.subscribers[userID] {
+		select {
+		case subscriber <- event:
+		default:
+			eb.Metrics.ObserveDroppedEvent()
+		}
+	}
+}
+
+// Subscribe opens a stream of the user's events and returns the events after
+// lastEventID that are still buffered, so nothing published in between is
+// missed. The channel is closed by unsubscribe or when the bus shuts down.
+func (eb *EventBus) Subscribe(userID uuid.UUID, lastEventID uint64) (<-chan Event, []Event, func()) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	subscriber := make(chan Event, eventSubscriberBuffer)
+	if eb.closed {
+		close(subscriber)
+		return subscriber, nil, func() {}
+	}
+
+	var missed []Event
+	if lastEventID > 0 {
+		for _, event := range eb.history[userID] {
+			if event.ID > lastEventID {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	if eb.subscribers[userID] == nil {
+		eb.subscribers[userID] = map[chan Event]struct{}{}
+	}
+	eb.subscribers[userID][subscriber] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			eb.mu.Lock()
+			defer eb.mu.Unlock()
+			if _, ok := eb.subscribers[userID][subscriber]; !ok {
+				return
+			}
+			delete(eb.subscribers[userID], subscriber)
+			if len(eb.subscribers[userID]) == 0 {
+				delete(eb.subscribers, userID)
+			}
+			close(subscriber)
+		})
+	}
+	return subscriber, missed, unsubscribe
+}
+
+// Close ends every open stream; it is called on shutdown so long-lived
+// requests do not hold the server open.
+func (eb *EventBus) Close() {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.closed {
+		return
+	}
+	eb.closed = true
+	close(eb.done)
+	for userID, subscribers := range eb.subscribers {
+		for subscriber := range subscribers {
+			close(subscriber)
+		}
+		delete(eb.subscribers, userID)
+	}
+}
+
+func (eb *EventBus) sweepLoop() {
+	ticker := time.NewTicker(eventSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-eb.done:
+			return
+		case now := <-ticker.C:
+			eb.sweep(now)
+		}
+	}
+}
+
+// sweep forgets the history of users without open streams once it has aged
+// past the replay window, so users who never reconnect do not keep their
+// last eventHistorySize events in memory for the life of the process.
+func (eb *EventBus) sweep(now time.Time) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	cutoff := now.Add(-eventReplayWindow)
+	for userID, history := range eb.history {
+		if len(eb.subscribers[userID]) > 0 {
+			continue
+		}
+		expired := 0
+		for expired < len(history) && history[expired].CreatedAt.Before(cutoff) {
+			expired++
+		}
+		if expired == len(history) {
+			delete(eb.history, userID)
+		} else if expired > 0 {
+			eb.history[userID] = append([]Event(nil), history[expired:]...)
+		}
+	}
+}
+
+func profileEventData(user *users.User) ProfileEventData {
+	return ProfileEventData{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		Website:         user.Website,
+		ProfileImageCID: user.ProfileImageCID,
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/follows"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+type FollowService struct {
+	FollowRepository follows.FollowRepository
+	UserRepository   users.UserRepository
+	PhotoRepository  photos.PhotoRepository
+}
+
+func NewFollowService(followRepository follows.FollowRepository, userRepository users.UserRepository, photoRepository photos.PhotoRepository) *FollowService {
+	return &FollowService{
+		FollowRepository: followRepository,
+		UserRepository:   userRepository,
+		PhotoRepository:  photoRepository,
+	}
+}
+
+func (fs *FollowService) Follow(ctx context.Context, followerID uuid.UUID, followeeID uuid.UUID) error {
+	if followerID == followeeID {
+		return fmt.Errorf("%w: you cannot follow yourself", helper.ErrBadRequest)
+	}
+	if _, findErr := fs.findVisibleUser(ctx, followeeID); findErr != nil {
+		return findErr
+	}
+	if _, followErr := fs.FollowRepository.Follow(ctx, followerID, followeeID); followErr != nil {
+		return followErr
+	}
+	return nil
+}
+
+// Unfollow succeeds even if the follow did not exist, so retries are harmless.
+func (fs *FollowService) Unfollow(ctx context.Context, followerID uuid.UUID, followeeID uuid.UUID) error {
+	if _, unfollowErr := fs.FollowRepository.Unfollow(ctx, followerID, followeeID); unfollowErr != nil {
+		return unfollowErr
+	}
+	return nil
+}
+
+func (fs *FollowService) Followers(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error) {
+	if _, findErr := fs.findVisibleUser(ctx, userID); findErr != nil {
+		return nil, findErr
+	}
+	return fs.FollowRepository.ListFollowers(ctx, userID, limit, offset)
+}
+
+func (fs *FollowService) Following(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*users.User, error) {
+	if _, findErr := fs.findVisibleUser(ctx, userID); findErr != nil {
+		return nil, findErr
+	}
+	return fs.FollowRepository.ListFollowing(ctx, userID, limit, offset)
+}
+
+func (fs *FollowService) Feed(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*photos.Photo, error) {
+	return fs.PhotoRepository.FindFeed(ctx, userID, limit, offset)
+}
+
+func (fs *FollowService) findVisibleUser(ctx context.Context, userID uuid.UUID) (*users.User, error) {
+	user, findErr := fs.UserRepository.FindByID(ctx, userID)
+	if findErr != nil || !user.IsVerified || user.SuspendedAt != nil || user.DeletionRequestedAt != nil {
+		return nil, helper.ErrNotFound
+	}
+	return user, nil
+}
@@ -4,75 +4,113 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/meliocool/arkive/internal/metrics"
+	"github.com/meliocool/arkive/internal/tracing"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strings"
+	"time"
 )
 
+var ErrNotPinned = errors.New("cid is not pinned")
+
+const defaultIpfsGatewayURL = "https://gateway.pinata.cloud/ipfs/"
+
 type IpfsService struct {
-	APIKey    string
-	APISecret string
+	APIKey     string
+	APISecret  string
+	GatewayURL string
+	Client     *http.Client
+	Metrics    *metrics.Metrics
 }
 
 type UploadFileResponse struct {
 	IpfsHash    string `json:"IpfsHash"`
-	PinSize     int    `json:"PinSize"`
+	PinSize     int64  `json:"PinSize"`
 	Timestamp   string `json:"Timestamp"`
 	IsDuplicate bool   `json:"isDuplicate"`
 }
 
 func NewIpfsService(APIKey string, APISecret string) *IpfsService {
-	return &IpfsService{APIKey: APIKey, APISecret: APISecret}
+	return &IpfsService{
+		APIKey:     APIKey,
+		APISecret:  APISecret,
+		GatewayURL: defaultIpfsGatewayURL,
+		Client:     &http.Client{Transport: tracing.NewTransport(http.DefaultTransport)},
+	}
+}
+
+// UploadFile pins the file and returns its CID together with the pinned size
+// reported by Pinata.
+func (is *IpfsService) UploadFile(ctx context.Context, fileName string, file io.Reader) (*UploadFileResponse, error) {
+	start := time.Now()
+	response, uploadErr := is.uploadFile(ctx, fileName, file)
+	is.Metrics.ObserveIPFS(metrics.IPFSPin, time.Since(start), uploadErr)
+	return response, uploadErr
 }
 
-func (is *IpfsService) UploadFile(ctx context.Context, fileName string, file io.Reader) (string, error) {
+func (is *IpfsService) uploadFile(ctx context.Context, fileName string, file io.Reader) (*UploadFileResponse, error) {
 	buffer := bytes.Buffer{}
 	writer := multipart.NewWriter(&buffer)
 	formFile, formErr := writer.CreateFormFile("file", fileName)
 	if formErr != nil {
-		return "", formErr
+		return nil, formErr
 	}
 	_, copyErr := io.Copy(formFile, file)
 	if copyErr != nil {
-		return "", copyErr
+		return nil, copyErr
 	}
 	closeErr := writer.Close()
 	if closeErr != nil {
-		return "", closeErr
+		return nil, closeErr
 	}
 
 	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.pinata.cloud/pinning/pinFileToIPFS", &buffer)
 	if reqErr != nil {
-		return "", reqErr
+		return nil, reqErr
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("pinata_api_key", is.APIKey)
 	req.Header.Set("pinata_secret_api_key", is.APISecret)
 
-	client := http.Client{}
-	response, clientErr := client.Do(req)
+	response, clientErr := is.Client.Do(req)
 	if clientErr != nil {
-		return "", clientErr
+		return nil, clientErr
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(response.Body)
-		return "", fmt.Errorf("pinata upload failed: status=%d body=%s", response.StatusCode, string(body))
+		return nil, fmt.Errorf("pinata upload failed: status=%d body=%s", response.StatusCode, string(body))
 	}
 
 	var respStruct UploadFileResponse
 	if decodeErr := json.NewDecoder(response.Body).Decode(&respStruct); decodeErr != nil {
-		return "", fmt.Errorf("failed to decode API response: %w", decodeErr)
+		return nil, fmt.Errorf("failed to decode API response: %w", decodeErr)
 	}
 
-	return respStruct.IpfsHash, nil
+	return &respStruct, nil
 }
 
+// UnpinFile removes the pin for ipfsCID. A CID that is not pinned is reported
+// as ErrNotPinned and is not counted as a failed request.
 func (is *IpfsService) UnpinFile(ctx context.Context, ipfsCID string) error {
+	start := time.Now()
+	unpinErr := is.unpinFile(ctx, ipfsCID)
+	if errors.Is(unpinErr, ErrNotPinned) {
+		is.Metrics.ObserveIPFS(metrics.IPFSUnpin, time.Since(start), nil)
+	} else {
+		is.Metrics.ObserveIPFS(metrics.IPFSUnpin, time.Since(start), unpinErr)
+	}
+	return unpinErr
+}
+
+func (is *IpfsService) unpinFile(ctx context.Context, ipfsCID string) error {
 	url := "https://api.pinata.cloud/pinning/unpin/" + ipfsCID
 	req, reqErr := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if reqErr != nil {
@@ -82,8 +120,7 @@ func (is *IpfsService) UnpinFile(ctx context.Context, ipfsCID string) error {
 	req.Header.Set("pinata_api_key", is.APIKey)
 	req.Header.Set("pinata_secret_api_key", is.APISecret)
 
-	client := &http.Client{}
-	res, resErr := client.Do(req)
+	res, resErr := is.Client.Do(req)
 	if resErr != nil {
 		return fmt.Errorf("failed to create a unpin request: %w", resErr)
 	}
@@ -92,7 +129,39 @@ func (is *IpfsService) UnpinFile(ctx context.Context, ipfsCID string) error {
 
 	if res.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(res.Body)
+		if res.StatusCode == http.StatusNotFound || strings.Contains(string(bodyBytes), "CURRENT_USER_HAS_NOT_PINNED_CID") {
+			return fmt.Errorf("%w: %s", ErrNotPinned, ipfsCID)
+		}
 		return fmt.Errorf("failed to unpin: %s", string(bodyBytes))
 	}
 	return nil
 }
+
+// FetchFile streams the content behind ipfsCID from the gateway. The caller
+// must close the returned reader.
+func (is *IpfsService) FetchFile(ctx context.Context, ipfsCID string) (io.ReadCloser, error) {
+	start := time.Now()
+	body, fetchErr := is.fetchFile(ctx, ipfsCID)
+	is.Metrics.ObserveIPFS(metrics.IPFSFetch, time.Since(start), fetchErr)
+	return body, fetchErr
+}
+
+func (is *IpfsService) fetchFile(ctx context.Context, ipfsCID string) (io.ReadCloser, error) {
+	url := strings.TrimSuffix(is.GatewayURL, "/") + "/" + ipfsCID
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if reqErr != nil {
+		return nil, fmt.Errorf("ipfs fetch failed: %w", reqErr)
+	}
+
+	res, resErr := is.Client.Do(req)
+	if resErr != nil {
+		return nil, fmt.Errorf("failed to fetch from ipfs gateway: %w", resErr)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("ipfs fetch failed: status=%d body=%s", res.StatusCode, string(bodyBytes))
+	}
+	return res.Body, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/repository/likes"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+type LikeService struct {
+	LikeRepository  likes.LikeRepository
+	PhotoRepository photos.PhotoRepository
+	UserRepository  users.UserRepository
+}
+
+func NewLikeService(likeRepository likes.LikeRepository, photoRepository photos.PhotoRepository, userRepository users.UserRepository) *LikeService {
+	return &LikeService{LikeRepository: likeRepository, PhotoRepository: photoRepository, UserRepository: userRepository}
+}
+
+// Like and Unlike are idempotent and return the photo with its updated count.
+func (ls *LikeService) Like(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (*photos.Photo, error) {
+	if _, findErr := findVisiblePhoto(ctx, ls.PhotoRepository, ls.UserRepository, photoID); findErr != nil {
+		return nil, findErr
+	}
+	if _, likeErr := ls.LikeRepository.Like(ctx, userID, photoID); likeErr != nil {
+		return nil, likeErr
+	}
+	return ls.PhotoRepository.FindByID(ctx, photoID)
+}
+
+func (ls *LikeService) Unlike(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (*photos.Photo, error) {
+	if _, findErr := findVisiblePhoto(ctx, ls.PhotoRepository, ls.UserRepository, photoID); findErr != nil {
+		return nil, findErr
+	}
+	if _, unlikeErr := ls.LikeRepository.Unlike(ctx, userID, photoID); unlikeErr != nil {
+		return nil, unlikeErr
+	}
+	return ls.PhotoRepository.FindByID(ctx, photoID)
+}
+
+func (ls *LikeService) Favorites(ctx context.Context, userID uuid.UUID, limit int, offset int) ([]*photos.Photo, error) {
+	return ls.PhotoRepository.FindLikedByUser(ctx, userID, limit, offset)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/likes"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"testing"
+	"time"
+)
+
+// galleryPhotoRepo and galleryUserRepo serve photos and their owners by ID;
+// any other call panics on the nil embedded interfaces.
+type galleryPhotoRepo struct {
+	photos.PhotoRepository
+	photos map[uuid.UUID]*photos.Photo
+}
+
+func (r *galleryPhotoRepo) FindByID(ctx context.Context, photoID uuid.UUID) (*photos.Photo, error) {
+	if photo, ok := r.photos[photoID]; ok {
+		copied := *photo
+		return &copied, nil
+	}
+	return nil, fmt.Errorf("photo not found")
+}
+
+type galleryUserRepo struct {
+	users.UserRepository
+	users map[uuid.UUID]*users.User
+}
+
+func (r *galleryUserRepo) FindByID(ctx context.Context, userID uuid.UUID) (*users.User, error) {
+	if user, ok := r.users[userID]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// gallery holds one photo per visibility case, keyed by the case name.
+type gallery struct {
+	photoRepo *galleryPhotoRepo
+	userRepo  *galleryUserRepo
+	photoIDs  map[string]uuid.UUID
+}
+
+func newGallery() *gallery {
+	g := &gallery{
+		photoRepo: &galleryPhotoRepo{photos: map[uuid.UUID]*photos.Photo{}},
+		userRepo:  &galleryUserRepo{users: map[uuid.UUID]*users.User{}},
+		photoIDs:  map[string]uuid.UUID{},
+	}
+	now := time.Now()
+	g.add("visible", &users.User{IsVerified: true}, nil)
+	g.add("hidden", &users.User{IsVerified: true}, &now)
+	g.add("suspended owner", &users.User{IsVerified: true, SuspendedAt: &now}, nil)
+	g.add("owner awaiting deletion", &users.User{IsVerified: true, DeletionRequestedAt: &now}, nil)
+	g.add("unverified owner", &users.User{}, nil)
+	g.photoIDs["missing"] = uuid.New()
+	return g
+}
+
+func (g *gallery) add(name string, owner *users.User, hiddenAt *time.Time) {
+	owner.ID = uuid.New()
+	photo := &photos.Photo{ID: uuid.New(), UserID: owner.ID, Filename: name + ".jpg", HiddenAt: hiddenAt}
+	g.userRepo.users[owner.ID] = owner
+	g.photoRepo.photos[photo.ID] = photo
+	g.photoIDs[name] = photo.ID
+}
+
+type memoryLikeRepo struct {
+	likes.LikeRepository
+	liked map[uuid.UUID]bool
+}
+
+func (r *memoryLikeRepo) Like(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (bool, error) {
+	changed := !r.liked[photoID]
+	r.liked[photoID] = true
+	return changed, nil
+}
+
+func (r *memoryLikeRepo) Unlike(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (bool, error) {
+	changed := r.liked[photoID]
+	delete(r.liked, photoID)
+	return changed, nil
+}
+
+func TestLikeOnlyReachesVisiblePhotos(t *testing.T) {
+	g := newGallery()
+	likeRepo := &memoryLikeRepo{liked: map[uuid.UUID]bool{}}
+	likeService := NewLikeService(likeRepo, g.photoRepo, g.userRepo)
+
+	for name, photoID := range g.photoIDs {
+		_, likeErr := likeService.Like(context.Background(), uuid.New(), photoID)
+		_, unlikeErr := likeService.Unlike(context.Background(), uuid.New(), photoID)
+		if name == "visible" {
+			if likeErr != nil || unlikeErr != nil {
+				t.Errorf("visible photo: Like = %v, Unlike = %v", likeErr, unlikeErr)
+			}
+			continue
+		}
+		if !errors.Is(likeErr, helper.ErrNotFound) || !errors.Is(unlikeErr, helper.ErrNotFound) {
+			t.Errorf("%s photo: Like = %v, Unlike = %v; want ErrNotFound", name, likeErr, unlikeErr)
+		}
+		if likeRepo.liked[photoID] {
+			t.Errorf("%s photo was liked", name)
+		}
+	}
+}
@@ -2,51 +2,291 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/meliocool/arkive/internal/helper"
 	"github.com/meliocool/arkive/internal/repository/users"
 	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"sync"
 	"time"
 )
 
+const (
+	accessTokenTTL    = time.Hour * 24
+	twoFactorTokenTTL = time.Minute * 5
+
+	accountLockThreshold = 5
+	accountLockBaseDelay = time.Minute
+	accountLockMaxDelay  = time.Hour * 24
+
+	ipThrottleThreshold = 20
+	ipThrottleBaseDelay = time.Minute
+	ipThrottleMaxDelay  = time.Hour
+
+	// Accounts without a password (e.g. created through OIDC) prove their
+	// identity for sensitive changes with a recently issued access token instead.
+	reauthenticationMaxAge = time.Minute * 10
+)
+
+// dummyPasswordHash is compared against when there is no real hash to check,
+// so unknown emails take as long to reject as wrong passwords.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("arkive-timing-equalizer"), bcrypt.DefaultCost)
+	return hash
+})
+
 type LoginService struct {
-	UserRepository users.UserRepository
-	JwtSecret      string
+	UserRepository      users.UserRepository
+	TwoFactorService    *TwoFactorService
+	EmailService        *EmailService
+	NotificationService *NotificationService
+	Throttler           *LoginThrottler
+	JwtSecret           string
+	Logger              *slog.Logger
+}
+
+// LoginResult carries either the access token or, when the account has
+// two-factor authentication enabled, the challenge token that has to be
+// exchanged through VerifyTwoFactor.
+type LoginResult struct {
+	Token          string
+	ChallengeToken string
 }
 
-func NewLoginService(userRepository users.UserRepository, jwtSecret string) *LoginService {
-	return &LoginService{UserRepository: userRepository, JwtSecret: jwtSecret}
+func NewLoginService(userRepository users.UserRepository, twoFactorService *TwoFactorService, emailService *EmailService, notificationService *NotificationService, jwtSecret string, logger *slog.Logger) *LoginService {
+	return &LoginService{
+		UserRepository:      userRepository,
+		TwoFactorService:    twoFactorService,
+		EmailService:        emailService,
+		NotificationService: notificationService,
+		Throttler:           NewLoginThrottler(ipThrottleThreshold, ipThrottleBaseDelay, ipThrottleMaxDelay),
+		JwtSecret:           jwtSecret,
+		Logger:              logger,
+	}
 }
 
-func (ls *LoginService) Login(ctx context.Context, email, password string) (string, error) {
+// Login answers every credential problem (unknown email, wrong password,
+// unverified or locked account) with the same ErrUnauthorized so the response
+// does not reveal whether an account exists.
+func (ls *LoginService) Login(ctx context.Context, email, password, clientIP string) (*LoginResult, error) {
 	if email == "" || password == "" {
-		return "", fmt.Errorf("invalid input!")
+		return nil, fmt.Errorf("invalid input!")
+	}
+
+	now := time.Now()
+	if !ls.Throttler.Allow(clientIP, now) {
+		return nil, helper.ErrTooManyRequests
 	}
 
 	user, findErr := ls.UserRepository.FindByEmail(ctx, email)
 	if findErr != nil {
-		return "", findErr
+		checkPassword("", password)
+		ls.Throttler.Fail(clientIP, now)
+		return nil, helper.ErrUnauthorized
+	}
+
+	if isLocked(user, now) {
+		checkPassword("", password)
+		ls.Throttler.Fail(clientIP, now)
+		return nil, helper.ErrUnauthorized
+	}
+
+	if !checkPassword(user.PasswordHash, password) {
+		ls.recordFailure(ctx, user, clientIP, now)
+		return nil, helper.ErrUnauthorized
 	}
 
 	if user.IsVerified == false {
-		return "", helper.ErrUnauthorized
+		return nil, helper.ErrUnauthorized
+	}
+
+	result, sessionErr := ls.startSession(ctx, user, clientIP)
+	if sessionErr != nil {
+		return nil, sessionErr
+	}
+	if result.Token != "" {
+		ls.Throttler.Succeed(clientIP)
+	}
+	return result, nil
+}
+
+func (ls *LoginService) VerifyTwoFactor(ctx context.Context, challengeToken, code, clientIP string) (*LoginResult, error) {
+	now := time.Now()
+	if !ls.Throttler.Allow(clientIP, now) {
+		return nil, helper.ErrTooManyRequests
+	}
+
+	claims, parseErr := helper.ParseToken(ls.JwtSecret, challengeToken)
+	if parseErr != nil || claims.Purpose != helper.TokenPurposeTwoFactor {
+		ls.Throttler.Fail(clientIP, now)
+		return nil, helper.ErrUnauthorized
+	}
+
+	userID, uuidErr := uuid.Parse(claims.Subject)
+	if uuidErr != nil {
+		return nil, helper.ErrUnauthorized
+	}
+
+	user, findErr := ls.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, helper.ErrUnauthorized
+	}
+
+	if isLocked(user, now) {
+		ls.Throttler.Fail(clientIP, now)
+		return nil, helper.ErrUnauthorized
+	}
+
+	if statusErr := accountStatusErr(user); statusErr != nil {
+		return nil, statusErr
+	}
+
+	if verifyErr := ls.TwoFactorService.Verify(ctx, user, code); verifyErr != nil {
+		if errors.Is(verifyErr, helper.ErrUnauthorized) {
+			ls.recordFailure(ctx, user, clientIP, now)
+		}
+		return nil, verifyErr
+	}
+
+	ls.Throttler.Succeed(clientIP)
+	ls.loginSucceeded(ctx, user, clientIP)
+
+	token, tokenErr := issueAccessToken(ls.JwtSecret, user)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return &LoginResult{Token: token}, nil
+}
+
+// recordFailure counts a failed attempt against both the client IP and the
+// account, locking the account with exponential backoff once it crosses the
+// threshold. The owner is emailed the first time the account gets locked.
+func (ls *LoginService) recordFailure(ctx context.Context, user *users.User, clientIP string, now time.Time) {
+	ls.Throttler.Fail(clientIP, now)
+
+	failures, incrementErr := ls.UserRepository.IncrementFailedLogins(ctx, user.ID)
+	if incrementErr != nil {
+		ls.Logger.ErrorContext(ctx, "failed to record login failure", "user_id", user.ID, "error", incrementErr)
+		return
+	}
+	if failures < accountLockThreshold {
+		return
+	}
+
+	lockedUntil := now.Add(backoffDelay(failures-accountLockThreshold, accountLockBaseDelay, accountLockMaxDelay))
+	if lockErr := ls.UserRepository.LockUntil(ctx, user.ID, lockedUntil); lockErr != nil {
+		ls.Logger.ErrorContext(ctx, "failed to lock account", "user_id", user.ID, "error", lockErr)
+		return
 	}
 
-	checkErr := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if checkErr != nil {
-		return "", checkErr
+	if failures == accountLockThreshold {
+		go func(u *users.User, until time.Time) {
+			bg, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			defer cancel()
+			if err := ls.EmailService.SendAccountLockedEmailCtx(bg, u.Email, u.Username, u.Locale, until); err != nil {
+				ls.Logger.ErrorContext(bg, "account locked email failed", "user_id", u.ID, "error", err)
+			}
+		}(user, lockedUntil)
 	}
+}
+
+// loginSucceeded clears the failure count and tells the owner about the new
+// sign-in.
+func (ls *LoginService) loginSucceeded(ctx context.Context, user *users.User, clientIP string) {
+	ls.NotificationService.Notify(ctx, NotificationEvent{
+		Type:   NotificationSecurityLogin,
+		UserID: user.ID,
+		Data: map[string]any{
+			"ip": clientIP,
+			"at": time.Now().UTC().Format(time.RFC1123),
+		},
+	})
 
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Subject:   user.ID.String(),
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return
 	}
+	if resetErr := ls.UserRepository.ResetFailedLogins(ctx, user.ID); resetErr != nil {
+		ls.Logger.ErrorContext(ctx, "failed to reset login failures", "user_id", user.ID, "error", resetErr)
+	}
+}
+
+// accountStatusErr rejects accounts that may no longer sign in even with
+// valid credentials.
+func accountStatusErr(user *users.User) error {
+	if user.DeletionRequestedAt != nil {
+		return helper.ErrUnauthorized
+	}
+	if user.SuspendedAt != nil {
+		return helper.ErrForbidden
+	}
+	return nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+func isLocked(user *users.User, now time.Time) bool {
+	return user.LockedUntil != nil && user.LockedUntil.After(now)
+}
+
+func checkPassword(passwordHash string, password string) bool {
+	if passwordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
+
+// reauthenticate confirms the caller still controls the account before a
+// sensitive change such as deleting it or changing its email address.
+func reauthenticate(user *users.User, password string, authenticatedAt time.Time) error {
+	if user.PasswordHash != "" {
+		if !checkPassword(user.PasswordHash, password) {
+			return helper.ErrUnauthorized
+		}
+		return nil
+	}
+	if time.Since(authenticatedAt) > reauthenticationMaxAge {
+		return fmt.Errorf("%w: sign in again to continue", helper.ErrUnauthorized)
+	}
+	return nil
+}
+
+func (ls *LoginService) startSession(ctx context.Context, user *users.User, clientIP string) (*LoginResult, error) {
+	if statusErr := accountStatusErr(user); statusErr != nil {
+		return nil, statusErr
+	}
+
+	if user.TOTPEnabled {
+		challenge, tokenErr := helper.SignToken(ls.JwtSecret, helper.Claims{
+			Purpose: helper.TokenPurposeTwoFactor,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject: user.ID.String(),
+			},
+		}, twoFactorTokenTTL)
+		if tokenErr != nil {
+			return nil, fmt.Errorf("token failed to generated")
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	ls.loginSucceeded(ctx, user, clientIP)
+
+	token, tokenErr := issueAccessToken(ls.JwtSecret, user)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return &LoginResult{Token: token}, nil
+}
 
-	signedToken, tokenErr := token.SignedString([]byte(ls.JwtSecret))
+func issueAccessToken(jwtSecret string, user *users.User) (string, error) {
+	signedToken, tokenErr := helper.SignToken(jwtSecret, helper.Claims{
+		Role:    user.Role,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: user.ID.String(),
+		},
+	}, accessTokenTTL)
 	if tokenErr != nil {
 		return "", fmt.Errorf("token failed to generated")
 	}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginThrottler keeps in-memory failure counters per key (the client IP) and
+// blocks a key with exponential backoff once it crosses the threshold.
+type LoginThrottler struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*throttleEntry
+	lastPrune time.Time
+}
+
+type throttleEntry struct {
+	failures     int
+	blockedUntil time.Time
+	lastFailure  time.Time
+}
+
+func NewLoginThrottler(threshold int, baseDelay time.Duration, maxDelay time.Duration) *LoginThrottler {
+	return &LoginThrottler{
+		Threshold: threshold,
+		BaseDelay: baseDelay,
+		MaxDelay:  maxDelay,
+		entries:   make(map[string]*throttleEntry),
+	}
+}
+
+func (lt *LoginThrottler) Allow(key string, now time.Time) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	entry, ok := lt.entries[key]
+	if !ok {
+		return true
+	}
+	return !now.Before(entry.blockedUntil)
+}
+
+func (lt *LoginThrottler) Fail(key string, now time.Time) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.prune(now)
+
+	entry, ok := lt.entries[key]
+	if !ok {
+		entry = &throttleEntry{}
+		lt.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	if entry.failures >= lt.Threshold {
+		entry.blockedUntil = now.Add(backoffDelay(entry.failures-lt.Threshold, lt.BaseDelay, lt.MaxDelay))
+	}
+}
+
+func (lt *LoginThrottler) Succeed(key string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	delete(lt.entries, key)
+}
+
+// prune forgets keys that have been quiet for longer than the maximum delay so
+// the map does not grow without bound.
+func (lt *LoginThrottler) prune(now time.Time) {
+	if now.Sub(lt.lastPrune) < time.Minute {
+		return
+	}
+	lt.lastPrune = now
+	for key, entry := range lt.entries {
+		if now.Sub(entry.lastFailure) > lt.MaxDelay && !now.Before(entry.blockedUntil) {
+			delete(lt.entries, key)
+		}
+	}
+}
+
+func backoffDelay(step int, baseDelay time.Duration, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 0; i < step && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
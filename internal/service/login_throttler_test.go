@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/mail"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"github.com/meliocool/arkive/templates"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelayDoublesUpToMax(t *testing.T) {
+	cases := []struct {
+		step int
+		want time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{3, 8 * time.Minute},
+		{6, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, c := range cases {
+		if got := backoffDelay(c.step, time.Minute, time.Hour); got != c.want {
+			t.Errorf("backoffDelay(%d) = %s, want %s", c.step, got, c.want)
+		}
+	}
+}
+
+func TestLoginThrottlerBlocksAfterThreshold(t *testing.T) {
+	throttler := NewLoginThrottler(3, time.Minute, time.Hour)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		throttler.Fail("203.0.113.7", now)
+	}
+	if !throttler.Allow("203.0.113.7", now) {
+		t.Fatal("blocked before reaching the threshold")
+	}
+
+	throttler.Fail("203.0.113.7", now)
+	if throttler.Allow("203.0.113.7", now) {
+		t.Fatal("allowed after reaching the threshold")
+	}
+	if !throttler.Allow("198.51.100.2", now) {
+		t.Error("another client was blocked too")
+	}
+	if !throttler.Allow("203.0.113.7", now.Add(time.Minute)) {
+		t.Error("still blocked after the base delay")
+	}
+
+	throttler.Fail("203.0.113.7", now.Add(time.Minute))
+	if throttler.Allow("203.0.113.7", now.Add(2*time.Minute)) {
+		t.Error("second block did not double the delay")
+	}
+	if !throttler.Allow("203.0.113.7", now.Add(3*time.Minute)) {
+		t.Error("still blocked after the doubled delay")
+	}
+}
+
+func TestLoginThrottlerSucceedClearsFailures(t *testing.T) {
+	throttler := NewLoginThrottler(2, time.Minute, time.Hour)
+	now := time.Now()
+
+	throttler.Fail("203.0.113.7", now)
+	throttler.Succeed("203.0.113.7")
+	throttler.Fail("203.0.113.7", now)
+
+	if !throttler.Allow("203.0.113.7", now) {
+		t.Error("failures from before a successful login still counted")
+	}
+}
+
+// lockoutUserRepo keeps the failure counter and lock of a single user; any
+// other call panics on the nil embedded interface.
+type lockoutUserRepo struct {
+	users.UserRepository
+	user *users.User
+}
+
+func (r *lockoutUserRepo) FindByEmail(ctx context.Context, email string) (*users.User, error) {
+	if email != r.user.Email {
+		return nil, errors.New("user not found")
+	}
+	copied := *r.user
+	return &copied, nil
+}
+
+func (r *lockoutUserRepo) IncrementFailedLogins(ctx context.Context, userID uuid.UUID) (int, error) {
+	r.user.FailedLogins++
+	return r.user.FailedLogins, nil
+}
+
+func (r *lockoutUserRepo) LockUntil(ctx context.Context, userID uuid.UUID, lockedUntil time.Time) error {
+	r.user.LockedUntil = &lockedUntil
+	return nil
+}
+
+func newLockoutLoginService(t *testing.T, failedLogins int) (*LoginService, *lockoutUserRepo, *memoryOutboxRepo) {
+	t.Helper()
+	hash, hashErr := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if hashErr != nil {
+		t.Fatal(hashErr)
+	}
+	repo := &lockoutUserRepo{user: &users.User{
+		ID:           uuid.New(),
+		Email:        "ana@example.com",
+		Username:     "ana",
+		PasswordHash: string(hash),
+		IsVerified:   true,
+		FailedLogins: failedLogins,
+	}}
+
+	outbox, outboxRepo, _ := newTestOutbox(mail.NewMemoryOutbox())
+	registry, registryErr := NewTemplateRegistry(templates.FS)
+	if registryErr != nil {
+		t.Fatal(registryErr)
+	}
+	emailService := NewEmailService(outbox, registry, nil, mail.Address{Name: "Arkive", Email: "no-reply@arkive.test"})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewLoginService(repo, nil, emailService, nil, "test-secret", logger), repo, outboxRepo
+}
+
+func TestLoginLocksAccountAtThresholdAndEmailsOwner(t *testing.T) {
+	loginService, repo, outboxRepo := newLockoutLoginService(t, accountLockThreshold-1)
+
+	before := time.Now()
+	if _, loginErr := loginService.Login(context.Background(), "ana@example.com", "wrong", "203.0.113.7"); !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Fatalf("Login = %v, want ErrUnauthorized", loginErr)
+	}
+	if repo.user.LockedUntil == nil {
+		t.Fatal("account was not locked at the threshold")
+	}
+	if delay := repo.user.LockedUntil.Sub(before); delay < accountLockBaseDelay || delay > accountLockBaseDelay+time.Second {
+		t.Errorf("locked for %s, want %s", delay, accountLockBaseDelay)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		outboxRepo.mu.Lock()
+		queued := len(outboxRepo.emails)
+		outboxRepo.mu.Unlock()
+		if queued == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d account locked emails, want 1", queued)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, loginErr := loginService.Login(context.Background(), "ana@example.com", "correct horse", "203.0.113.7"); !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Errorf("locked account signed in with the right password: %v", loginErr)
+	}
+}
+
+func TestLoginBacksOffRepeatedLockouts(t *testing.T) {
+	loginService, repo, _ := newLockoutLoginService(t, accountLockThreshold+2)
+
+	before := time.Now()
+	if _, loginErr := loginService.Login(context.Background(), "ana@example.com", "wrong", "203.0.113.7"); !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Fatalf("Login = %v, want ErrUnauthorized", loginErr)
+	}
+	want := 8 * accountLockBaseDelay
+	if delay := repo.user.LockedUntil.Sub(before); delay < want || delay > want+time.Second {
+		t.Errorf("locked for %s after %d failures, want %s", delay, repo.user.FailedLogins, want)
+	}
+}
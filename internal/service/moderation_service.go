@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/moderation"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/transactor"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxReportDetailsLength = 1000
+
+var reportReasons = map[string]bool{
+	"spam":       true,
+	"nudity":     true,
+	"violence":   true,
+	"harassment": true,
+	"hate":       true,
+	"copyright":  true,
+	"other":      true,
+}
+
+type ModerationService struct {
+	ModerationRepository moderation.ModerationRepository
+	PhotoRepository      photos.PhotoRepository
+	UserRepository       users.UserRepository
+	PhotoService         *PhotoService
+	BlocklistService     *BlocklistService
+	Transactor           transactor.Transactor
+}
+
+func NewModerationService(moderationRepository moderation.ModerationRepository, photoRepository photos.PhotoRepository, userRepository users.UserRepository, photoService *PhotoService, blocklistService *BlocklistService, transactor transactor.Transactor) *ModerationService {
+	return &ModerationService{
+		ModerationRepository: moderationRepository,
+		PhotoRepository:      photoRepository,
+		UserRepository:       userRepository,
+		PhotoService:         photoService,
+		BlocklistService:     blocklistService,
+		Transactor:           transactor,
+	}
+}
+
+func (ms *ModerationService) ReportPhoto(ctx context.Context, reporterID uuid.UUID, photoID uuid.UUID, reason string, details string) (*moderation.Report, error) {
+	if !reportReasons[reason] {
+		return nil, fmt.Errorf("%w: unknown report reason %q", helper.ErrBadRequest, reason)
+	}
+	details = strings.TrimSpace(details)
+	if reason == "other" && details == "" {
+		return nil, fmt.Errorf("%w: details are required for reason \"other\"", helper.ErrBadRequest)
+	}
+	if utf8.RuneCountInString(details) > maxReportDetailsLength {
+		return nil, fmt.Errorf("%w: details must be at most %d characters", helper.ErrBadRequest, maxReportDetailsLength)
+	}
+
+	photo, findErr := findVisiblePhoto(ctx, ms.PhotoRepository, ms.UserRepository, photoID)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if photo.UserID == reporterID {
+		return nil, fmt.Errorf("%w: cannot report your own photo", helper.ErrBadRequest)
+	}
+
+	report, createErr := ms.ModerationRepository.CreateReport(ctx, &moderation.Report{
+		PhotoID:    photoID,
+		ReporterID: reporterID,
+		Reason:     reason,
+		Details:    details,
+	})
+	if createErr != nil {
+		if errors.Is(createErr, moderation.ErrAlreadyReported) {
+			return nil, fmt.Errorf("%w: you already reported this photo", helper.ErrConflict)
+		}
+		return nil, createErr
+	}
+	return report, nil
+}
+
+func (ms *ModerationService) Queue(ctx context.Context, limit int, offset int) ([]*moderation.QueueItem, error) {
+	return ms.ModerationRepository.ListQueue(ctx, limit, offset)
+}
+
+func (ms *ModerationService) Reports(ctx context.Context, photoID uuid.UUID) ([]*moderation.Report, error) {
+	if _, findErr := ms.PhotoRepository.FindByID(ctx, photoID); findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+	return ms.ModerationRepository.ListOpenReports(ctx, photoID)
+}
+
+func (ms *ModerationService) AuditLog(ctx context.Context, limit int, offset int) ([]*moderation.Action, error) {
+	return ms.ModerationRepository.ListActions(ctx, limit, offset)
+}
+
+// ModeratePhoto applies a moderation decision to a reported photo and records
+// it in the audit trail. Every action except unhide closes the photo's open
+// reports.
+func (ms *ModerationService) ModeratePhoto(ctx context.Context, moderatorID uuid.UUID, photoID uuid.UUID, action string, note string) error {
+	photo, findErr := ms.PhotoRepository.FindByID(ctx, photoID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+
+	record := &moderation.Action{
+		ModeratorID: moderatorID,
+		Action:      action,
+		PhotoID:     &photo.ID,
+		Note:        strings.TrimSpace(note),
+	}
+
+	switch action {
+	case moderation.ActionHide, moderation.ActionUnhide:
+		hidden := action == moderation.ActionHide
+		return ms.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if hideErr := ms.PhotoRepository.SetHidden(ctx, photo.ID, hidden); hideErr != nil {
+				return fmt.Errorf("failed to update photo visibility: %w", hideErr)
+			}
+			if hidden {
+				if _, resolveErr := ms.ModerationRepository.ResolveReports(ctx, photo.ID, moderatorID, moderation.ReportStatusResolved); resolveErr != nil {
+					return resolveErr
+				}
+			}
+			return ms.ModerationRepository.RecordAction(ctx, record)
+		})
+
+	case moderation.ActionDismiss:
+		return ms.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if _, resolveErr := ms.ModerationRepository.ResolveReports(ctx, photo.ID, moderatorID, moderation.ReportStatusDismissed); resolveErr != nil {
+				return resolveErr
+			}
+			return ms.ModerationRepository.RecordAction(ctx, record)
+		})
+
+	case moderation.ActionSuspendUploader:
+		uploader, findUserErr := ms.UserRepository.FindByID(ctx, photo.UserID)
+		if findUserErr != nil {
+			return helper.ErrNotFound
+		}
+		if uploader.ID == moderatorID {
+			return fmt.Errorf("%w: cannot suspend your own account", helper.ErrBadRequest)
+		}
+		if users.HasRole(uploader.Role, users.RoleModerator) {
+			return fmt.Errorf("%w: staff accounts cannot be suspended from the moderation queue", helper.ErrForbidden)
+		}
+		record.TargetUserID = &uploader.ID
+		return ms.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if suspendErr := ms.UserRepository.UpdateSuspended(ctx, uploader.ID, true); suspendErr != nil {
+				return fmt.Errorf("failed to update suspension: %w", suspendErr)
+			}
+			if _, resolveErr := ms.ModerationRepository.ResolveReports(ctx, photo.ID, moderatorID, moderation.ReportStatusResolved); resolveErr != nil {
+				return resolveErr
+			}
+			return ms.ModerationRepository.RecordAction(ctx, record)
+		})
+
+	case moderation.ActionRemove, moderation.ActionRemoveAndBlock:
+		// The photo's reports are deleted along with it; the audit entry keeps
+		// the decision. Blocking has to happen first, while the content can
+		// still be fetched from IPFS.
+		record.TargetUserID = &photo.UserID
+		if action == moderation.ActionRemoveAndBlock {
+			if blockErr := ms.BlocklistService.BlockPhoto(ctx, moderatorID, photo, record.Note); blockErr != nil {
+				return fmt.Errorf("failed to block photo content: %w", blockErr)
+			}
+		}
+		if removeErr := ms.PhotoService.RemovePhoto(ctx, photo, PhotoRemovedByModeration); removeErr != nil {
+			return removeErr
+		}
+		return ms.ModerationRepository.RecordAction(ctx, record)
+	}
+
+	return fmt.Errorf("%w: unknown moderation action %q", helper.ErrBadRequest, action)
+}
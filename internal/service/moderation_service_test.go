@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/moderation"
+	"github.com/meliocool/arkive/internal/repository/photos"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportRepo stores reports and rejects a second one from the same reporter
+// the way the unique index does; any other call panics on the nil embedded
+// interface.
+type reportRepo struct {
+	moderation.ModerationRepository
+	reports []*moderation.Report
+}
+
+func (r *reportRepo) CreateReport(ctx context.Context, report *moderation.Report) (*moderation.Report, error) {
+	for _, existing := range r.reports {
+		if existing.PhotoID == report.PhotoID && existing.ReporterID == report.ReporterID {
+			return nil, moderation.ErrAlreadyReported
+		}
+	}
+	stored := *report
+	stored.ID = uuid.New()
+	r.reports = append(r.reports, &stored)
+	return &stored, nil
+}
+
+func newTestModeration(g *gallery) (*ModerationService, *reportRepo) {
+	repo := &reportRepo{}
+	return NewModerationService(repo, g.photoRepo, g.userRepo, nil, nil, &deferredTransactor{}), repo
+}
+
+func TestReportPhotoOnlyReachesVisiblePhotos(t *testing.T) {
+	g := newGallery()
+	moderationService, repo := newTestModeration(g)
+
+	for name, photoID := range g.photoIDs {
+		_, reportErr := moderationService.ReportPhoto(context.Background(), uuid.New(), photoID, "spam", "")
+		if name == "visible" {
+			if reportErr != nil {
+				t.Errorf("visible photo: ReportPhoto = %v", reportErr)
+			}
+			continue
+		}
+		if !errors.Is(reportErr, helper.ErrNotFound) {
+			t.Errorf("%s photo: ReportPhoto = %v, want ErrNotFound", name, reportErr)
+		}
+	}
+	if len(repo.reports) != 1 {
+		t.Errorf("stored %d reports, want only the one on the visible photo", len(repo.reports))
+	}
+}
+
+func TestReportPhotoValidatesReport(t *testing.T) {
+	g := newGallery()
+	moderationService, repo := newTestModeration(g)
+	photoID := g.photoIDs["visible"]
+	ownerID := g.photoRepo.photos[photoID].UserID
+
+	cases := map[string]struct {
+		reporterID      uuid.UUID
+		reason, details string
+	}{
+		"unknown reason":            {uuid.New(), "boring", ""},
+		"other without details":     {uuid.New(), "other", "   "},
+		"details that are too long": {uuid.New(), "spam", strings.Repeat("x", maxReportDetailsLength+1)},
+		"own photo":                 {ownerID, "spam", ""},
+	}
+	for name, c := range cases {
+		if _, reportErr := moderationService.ReportPhoto(context.Background(), c.reporterID, photoID, c.reason, c.details); !errors.Is(reportErr, helper.ErrBadRequest) {
+			t.Errorf("%s: ReportPhoto = %v, want ErrBadRequest", name, reportErr)
+		}
+	}
+	if len(repo.reports) != 0 {
+		t.Errorf("stored %d invalid reports", len(repo.reports))
+	}
+}
+
+func TestReportPhotoRejectsDuplicates(t *testing.T) {
+	g := newGallery()
+	moderationService, _ := newTestModeration(g)
+	reporterID, photoID := uuid.New(), g.photoIDs["visible"]
+
+	report, reportErr := moderationService.ReportPhoto(context.Background(), reporterID, photoID, "other", "  stolen from my portfolio ")
+	if reportErr != nil {
+		t.Fatalf("ReportPhoto: %v", reportErr)
+	}
+	if report.Details != "stolen from my portfolio" {
+		t.Errorf("details = %q, want them trimmed", report.Details)
+	}
+	if _, reportErr = moderationService.ReportPhoto(context.Background(), reporterID, photoID, "spam", ""); !errors.Is(reportErr, helper.ErrConflict) {
+		t.Errorf("second report = %v, want ErrConflict", reportErr)
+	}
+}
+
+func TestVisiblePhotosDropsHiddenPhotos(t *testing.T) {
+	now := time.Now()
+	shown, hidden := &photos.Photo{ID: uuid.New()}, &photos.Photo{ID: uuid.New(), HiddenAt: &now}
+
+	visible := visiblePhotos([]*photos.Photo{hidden, shown})
+	if len(visible) != 1 || visible[0] != shown {
+		t.Errorf("visiblePhotos kept %d photos, want only the shown one", len(visible))
+	}
+}
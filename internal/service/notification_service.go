@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/repository/notifications"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"log/slog"
+)
+
+const (
+	NotificationPhotoUploaded = "photo.uploaded"
+	NotificationPhotoDeleted  = "photo.deleted"
+	NotificationSecurityLogin = "security.login"
+)
+
+// NotificationEvent is something that happened to a user. Data carries the
+// details the notification text is rendered from and is stored alongside it.
+type NotificationEvent struct {
+	Type   string
+	UserID uuid.UUID
+	Data   map[string]any
+}
+
+// notificationKind describes how an event type is turned into a notification
+// and which preference category governs its delivery.
+type notificationKind struct {
+	Category string
+	Render   func(data map[string]any) (title string, body string)
+}
+
+var notificationKinds = map[string]notificationKind{
+	NotificationPhotoUploaded: {
+		Category: CategoryPhotos,
+		Render: func(data map[string]any) (string, string) {
+			return "Upload complete", fmt.Sprintf("%s has been uploaded and pinned.", dataString(data, "filename"))
+		},
+	},
+	NotificationPhotoDeleted: {
+		Category: CategoryPhotos,
+		Render: func(data map[string]any) (string, string) {
+			if dataString(data, "reason") == PhotoRemovedByModeration {
+				return "Photo removed", fmt.Sprintf("%s was removed by a moderator.", dataString(data, "filename"))
+			}
+			return "Photo deleted", fmt.Sprintf("%s has been deleted.", dataString(data, "filename"))
+		},
+	},
+	NotificationSecurityLogin: {
+		Category: CategorySecurity,
+		Render: func(data map[string]any) (string, string) {
+			return "New sign-in to your account", fmt.Sprintf("Your account was signed in to from %s at %s. "+
+				"If this wasn't you, change your password.", dataString(data, "ip"), dataString(data, "at"))
+		},
+	},
+}
+
+func dataString(data map[string]any, key string) string {
+	if value, ok := data[key]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return "unknown"
+}
+
+type NotificationEventData struct {
+	ID    uuid.UUID `json:"id"`
+	Type  string    `json:"type"`
+	Title string    `json:"title"`
+	Body  string    `json:"body"`
+}
+
+type NotificationService struct {
+	NotificationRepository notifications.NotificationRepository
+	UserRepository         users.UserRepository
+	PreferenceService      *PreferenceService
+	EmailService           *EmailService
+	EventBus               *EventBus
+	Logger                 *slog.Logger
+}
+
+type NotificationPage struct {
+	Notifications []*notifications.Notification
+	UnreadCount   int
+}
+
+func NewNotificationService(notificationRepository notifications.NotificationRepository, userRepository users.UserRepository, preferenceService *PreferenceService, emailService *EmailService, eventBus *EventBus, logger *slog.Logger) *NotificationService {
+	return &NotificationService{
+		NotificationRepository: notificationRepository,
+		UserRepository:         userRepository,
+		PreferenceService:      preferenceService,
+		EmailService:           emailService,
+		EventBus:               eventBus,
+		Logger:                 logger,
+	}
+}
+
+// Notify stores the notification for the event and queues it as an email, each
+// when the user's preferences for its category allow. Both are written in
+// ctx's transaction when there is one. Failures are only logged so a
+// notification never fails the action that caused it.
+func (ns *NotificationService) Notify(ctx context.Context, event NotificationEvent) {
+	kind, ok := notificationKinds[event.Type]
+	if !ok {
+		ns.Logger.ErrorContext(ctx, "unknown notification type", "type", event.Type)
+		return
+	}
+
+	preferences, prefErr := ns.PreferenceService.Preferences(ctx, event.UserID)
+	if prefErr != nil {
+		ns.Logger.ErrorContext(ctx, "failed to load notification preferences", "user_id", event.UserID, "error", prefErr)
+		return
+	}
+
+	title, body := kind.Render(event.Data)
+	if preferences[kind.Category][ChannelInApp] {
+		ns.createInApp(ctx, event, title, body)
+	}
+	if !preferences[kind.Category][ChannelEmail] {
+		return
+	}
+
+	user, findErr := ns.UserRepository.FindByID(ctx, event.UserID)
+	if findErr != nil {
+		ns.Logger.ErrorContext(ctx, "failed to find user for notification email", "user_id", event.UserID, "error", findErr)
+		return
+	}
+
+	if emailErr := ns.EmailService.SendNotificationEmailCtx(ctx, preferences, user.ID, user.Email, user.Username, user.Locale, kind.Category, title, body); emailErr != nil {
+		ns.Logger.ErrorContext(ctx, "notification email failed", "user_id", user.ID, "error", emailErr)
+	}
+}
+
+func (ns *NotificationService) createInApp(ctx context.Context, event NotificationEvent, title string, body string) {
+	notification, createErr := ns.NotificationRepository.Create(ctx, &notifications.Notification{
+		UserID: event.UserID,
+		Type:   event.Type,
+		Title:  title,
+		Body:   body,
+		Data:   event.Data,
+	})
+	if createErr != nil {
+		ns.Logger.ErrorContext(ctx, "failed to create notification", "type", event.Type, "user_id", event.UserID, "error", createErr)
+		return
+	}
+	ns.EventBus.Publish(event.UserID, EventNotificationCreated, NotificationEventData{
+		ID:    notification.ID,
+		Type:  notification.Type,
+		Title: notification.Title,
+		Body:  notification.Body,
+	})
+}
+
+func (ns *NotificationService) List(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int, offset int) (*NotificationPage, error) {
+	notificationList, listErr := ns.NotificationRepository.ListByUserID(ctx, userID, unreadOnly, limit, offset)
+	if listErr != nil {
+		return nil, listErr
+	}
+	unread, countErr := ns.NotificationRepository.CountUnread(ctx, userID)
+	if countErr != nil {
+		return nil, countErr
+	}
+	return &NotificationPage{Notifications: notificationList, UnreadCount: unread}, nil
+}
+
+// MarkRead marks the given notifications as read, or all of them when ids is
+// empty, and returns the remaining unread count.
+func (ns *NotificationService) MarkRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int, error) {
+	if _, markErr := ns.NotificationRepository.MarkRead(ctx, userID, ids); markErr != nil {
+		return 0, markErr
+	}
+	return ns.NotificationRepository.CountUnread(ctx, userID)
+}
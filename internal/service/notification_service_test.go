@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/mail"
+	"github.com/meliocool/arkive/internal/repository/notifications"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"github.com/meliocool/arkive/templates"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// notificationRepo adds stored notifications to the in-memory preferences.
+type notificationRepo struct {
+	preferenceRepo
+	created []*notifications.Notification
+}
+
+func (r *notificationRepo) Create(ctx context.Context, notification *notifications.Notification) (*notifications.Notification, error) {
+	stored := *notification
+	stored.ID = uuid.New()
+	r.created = append(r.created, &stored)
+	return &stored, nil
+}
+
+type notificationFixture struct {
+	service    *NotificationService
+	repo       *notificationRepo
+	outboxRepo *memoryOutboxRepo
+	eventBus   *EventBus
+	user       *users.User
+}
+
+func newNotificationFixture(t *testing.T) *notificationFixture {
+	t.Helper()
+	user := &users.User{ID: uuid.New(), Email: "ana@example.com", Username: "ana", IsVerified: true}
+	repo := &notificationRepo{}
+	preferenceService := NewPreferenceService(repo, "test-secret", "https://arkive.test")
+
+	outbox, outboxRepo, _ := newTestOutbox(mail.NewMemoryOutbox())
+	registry, registryErr := NewTemplateRegistry(templates.FS)
+	if registryErr != nil {
+		t.Fatal(registryErr)
+	}
+	emailService := NewEmailService(outbox, registry, preferenceService, mail.Address{Name: "Arkive", Email: "no-reply@arkive.test"})
+
+	eventBus := NewEventBus(nil)
+	t.Cleanup(eventBus.Close)
+
+	userRepo := &galleryUserRepo{users: map[uuid.UUID]*users.User{user.ID: user}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &notificationFixture{
+		service:    NewNotificationService(repo, userRepo, preferenceService, emailService, eventBus, logger),
+		repo:       repo,
+		outboxRepo: outboxRepo,
+		eventBus:   eventBus,
+		user:       user,
+	}
+}
+
+func TestNotifyFollowsCategoryDefaults(t *testing.T) {
+	f := newNotificationFixture(t)
+	events, _, unsubscribe := f.eventBus.Subscribe(f.user.ID, 0)
+	defer unsubscribe()
+
+	f.service.Notify(context.Background(), NotificationEvent{
+		Type:   NotificationPhotoUploaded,
+		UserID: f.user.ID,
+		Data:   map[string]any{"filename": "sunset.jpg"},
+	})
+
+	if len(f.repo.created) != 1 || f.repo.created[0].Body != "sunset.jpg has been uploaded and pinned." {
+		t.Fatalf("created %+v, want one upload notification", f.repo.created)
+	}
+	select {
+	case event := <-events:
+		if event.Type != EventNotificationCreated {
+			t.Errorf("published %q, want %q", event.Type, EventNotificationCreated)
+		}
+	default:
+		t.Error("the new notification was not published")
+	}
+	if len(f.outboxRepo.emails) != 0 {
+		t.Error("photo notifications are emailed although email is off by default")
+	}
+
+	f.service.Notify(context.Background(), NotificationEvent{
+		Type:   NotificationSecurityLogin,
+		UserID: f.user.ID,
+		Data:   map[string]any{"ip": "203.0.113.7"},
+	})
+
+	if len(f.repo.created) != 2 {
+		t.Errorf("created %d notifications, want 2", len(f.repo.created))
+	}
+	if len(f.outboxRepo.emails) != 1 {
+		t.Fatalf("queued %d emails, want the security one", len(f.outboxRepo.emails))
+	}
+	email := f.outboxRepo.emails[0]
+	if email.ToEmail != f.user.Email || !email.OneClickUnsubscribe || len(email.ListUnsubscribe) != 1 ||
+		!strings.HasPrefix(email.ListUnsubscribe[0], "https://arkive.test/unsubscribe/") {
+		t.Errorf("queued email %+v, want it sent to the user with a one-click unsubscribe link", email)
+	}
+}
+
+func TestNotifyRespectsUserPreferences(t *testing.T) {
+	f := newNotificationFixture(t)
+	updateErr := f.service.PreferenceService.Update(context.Background(), f.user.ID, map[string]map[string]bool{
+		CategoryPhotos:   {ChannelInApp: false, ChannelEmail: true},
+		CategorySecurity: {ChannelEmail: false},
+	})
+	if updateErr != nil {
+		t.Fatalf("Update: %v", updateErr)
+	}
+
+	f.service.Notify(context.Background(), NotificationEvent{Type: NotificationPhotoDeleted, UserID: f.user.ID, Data: map[string]any{"filename": "sunset.jpg"}})
+	f.service.Notify(context.Background(), NotificationEvent{Type: NotificationSecurityLogin, UserID: f.user.ID})
+
+	if len(f.repo.created) != 1 || f.repo.created[0].Type != NotificationSecurityLogin {
+		t.Errorf("created %+v, want only the security notification", f.repo.created)
+	}
+	if len(f.outboxRepo.emails) != 1 || f.outboxRepo.emails[0].Subject != "Photo deleted" {
+		t.Errorf("queued %d emails, want only the photo one", len(f.outboxRepo.emails))
+	}
+}
+
+func TestNotifyIgnoresUnknownTypes(t *testing.T) {
+	f := newNotificationFixture(t)
+
+	f.service.Notify(context.Background(), NotificationEvent{Type: "photo.exploded", UserID: f.user.ID})
+
+	if len(f.repo.created) != 0 || len(f.outboxRepo.emails) != 0 {
+		t.Error("an unknown notification type was delivered")
+	}
+}
+
+func TestNotificationKindsRender(t *testing.T) {
+	cases := []struct {
+		eventType string
+		data      map[string]any
+		title     string
+		body      string
+	}{
+		{NotificationPhotoDeleted, map[string]any{"filename": "a.jpg"}, "Photo deleted", "a.jpg has been deleted."},
+		{NotificationPhotoDeleted, map[string]any{"filename": "a.jpg", "reason": PhotoRemovedByModeration}, "Photo removed", "a.jpg was removed by a moderator."},
+		{NotificationPhotoUploaded, nil, "Upload complete", "unknown has been uploaded and pinned."},
+	}
+	for _, c := range cases {
+		title, body := notificationKinds[c.eventType].Render(c.data)
+		if title != c.title || body != c.body {
+			t.Errorf("%s with %v rendered %q / %q, want %q / %q", c.eventType, c.data, title, body, c.title, c.body)
+		}
+	}
+}
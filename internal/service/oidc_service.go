@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"golang.org/x/oauth2"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const oidcStateTTL = time.Minute * 10
+
+var usernameDisallowed = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+type OIDCService struct {
+	UserRepository users.UserRepository
+	LoginService   *LoginService
+	ProviderName   string
+	IssuerURL      string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	JwtSecret      string
+	Logger         *slog.Logger
+
+	mu           sync.Mutex
+	verifier     *oidc.IDTokenVerifier
+	oauth2Config *oauth2.Config
+}
+
+// oidcStateClaims travels in a signed cookie between the redirect to the
+// identity provider and the callback, so no server-side session is needed.
+type oidcStateClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	helper.Claims
+}
+
+type oidcIdentityClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+func NewOIDCService(userRepository users.UserRepository, loginService *LoginService, providerName, issuerURL, clientID, clientSecret, redirectURL string, scopes []string, jwtSecret string, logger *slog.Logger) *OIDCService {
+	return &OIDCService{
+		UserRepository: userRepository,
+		LoginService:   loginService,
+		ProviderName:   providerName,
+		IssuerURL:      issuerURL,
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		RedirectURL:    redirectURL,
+		Scopes:         scopes,
+		JwtSecret:      jwtSecret,
+		Logger:         logger,
+	}
+}
+
+// setup runs provider discovery lazily so a temporarily unreachable identity
+// provider does not stop the API from starting.
+func (o *OIDCService) setup(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.oauth2Config != nil {
+		return o.oauth2Config, o.verifier, nil
+	}
+
+	// The provider keeps this context for later key set refreshes, so it must
+	// outlive the request that happened to trigger discovery.
+	provider, providerErr := oidc.NewProvider(context.WithoutCancel(ctx), o.IssuerURL)
+	if providerErr != nil {
+		return nil, nil, fmt.Errorf("oidc discovery failed: %w", providerErr)
+	}
+
+	scopes := o.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	o.oauth2Config = &oauth2.Config{
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RedirectURL:  o.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: o.ClientID})
+	return o.oauth2Config, o.verifier, nil
+}
+
+// StartLogin returns the provider authorization URL and the signed state
+// token the caller must hand back to CompleteLogin.
+func (o *OIDCService) StartLogin(ctx context.Context) (string, string, error) {
+	config, _, setupErr := o.setup(ctx)
+	if setupErr != nil {
+		return "", "", setupErr
+	}
+
+	state, stateErr := helper.GenerateRandomToken(24)
+	if stateErr != nil {
+		return "", "", stateErr
+	}
+	nonce, nonceErr := helper.GenerateRandomToken(24)
+	if nonceErr != nil {
+		return "", "", nonceErr
+	}
+	codeVerifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	stateClaims := oidcStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		Claims: helper.Claims{
+			Purpose: helper.TokenPurposeOIDCState,
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+			},
+		},
+	}
+	stateToken, signErr := jwt.NewWithClaims(jwt.SigningMethodHS256, stateClaims).SignedString([]byte(o.JwtSecret))
+	if signErr != nil {
+		return "", "", fmt.Errorf("failed to sign oidc state: %w", signErr)
+	}
+
+	authURL := config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+	return authURL, stateToken, nil
+}
+
+func (o *OIDCService) CompleteLogin(ctx context.Context, stateToken, state, code, clientIP string) (*LoginResult, error) {
+	var stateClaims oidcStateClaims
+	if parseErr := helper.ParseTokenClaims(o.JwtSecret, stateToken, &stateClaims); parseErr != nil {
+		return nil, helper.ErrUnauthorized
+	}
+	if stateClaims.Purpose != helper.TokenPurposeOIDCState ||
+		subtle.ConstantTimeCompare([]byte(stateClaims.State), []byte(state)) != 1 {
+		return nil, helper.ErrUnauthorized
+	}
+
+	config, verifier, setupErr := o.setup(ctx)
+	if setupErr != nil {
+		return nil, setupErr
+	}
+
+	// Provider errors stay in the log; the client only learns that the
+	// sign-in failed.
+	oauthToken, exchangeErr := config.Exchange(ctx, code, oauth2.VerifierOption(stateClaims.CodeVerifier))
+	if exchangeErr != nil {
+		o.Logger.WarnContext(ctx, "oidc code exchange failed", "provider", o.ProviderName, "error", exchangeErr)
+		return nil, helper.ErrUnauthorized
+	}
+
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: provider did not return an id_token", helper.ErrUnauthorized)
+	}
+
+	idToken, verifyErr := verifier.Verify(ctx, rawIDToken)
+	if verifyErr != nil {
+		o.Logger.WarnContext(ctx, "oidc id_token verification failed", "provider", o.ProviderName, "error", verifyErr)
+		return nil, helper.ErrUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(stateClaims.Nonce)) != 1 {
+		return nil, helper.ErrUnauthorized
+	}
+
+	var identity oidcIdentityClaims
+	if claimsErr := idToken.Claims(&identity); claimsErr != nil {
+		return nil, fmt.Errorf("failed to decode id_token claims: %w", claimsErr)
+	}
+
+	user, resolveErr := o.resolveUser(ctx, idToken.Subject, identity)
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+
+	return o.LoginService.startSession(ctx, user, clientIP)
+}
+
+// resolveUser finds the account already linked to the identity, links an
+// existing verified account with the same verified email, or creates a new one.
+func (o *OIDCService) resolveUser(ctx context.Context, subject string, identity oidcIdentityClaims) (*users.User, error) {
+	if user, findErr := o.UserRepository.FindByIdentity(ctx, o.ProviderName, subject); findErr == nil {
+		return user, nil
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, fmt.Errorf("%w: identity provider did not supply a verified email", helper.ErrUnauthorized)
+	}
+
+	if existing, findErr := o.UserRepository.FindByEmail(ctx, identity.Email); findErr == nil {
+		// An unverified local account could have been registered by anyone,
+		// so it must not be handed over to the identity provider's user.
+		if !existing.IsVerified {
+			return nil, helper.ErrConflict
+		}
+		if linkErr := o.UserRepository.LinkIdentity(ctx, existing.ID, o.ProviderName, subject, identity.Email); linkErr != nil {
+			return nil, linkErr
+		}
+		return existing, nil
+	}
+
+	username, usernameErr := o.availableUsername(ctx, identity)
+	if usernameErr != nil {
+		return nil, usernameErr
+	}
+
+	user, createErr := o.UserRepository.CreateUser(ctx, &users.User{
+		Username:   username,
+		Email:      identity.Email,
+		IsVerified: true,
+	})
+	if createErr != nil {
+		return nil, fmt.Errorf("failed to create account: %w", createErr)
+	}
+
+	if linkErr := o.UserRepository.LinkIdentity(ctx, user.ID, o.ProviderName, subject, identity.Email); linkErr != nil {
+		return nil, linkErr
+	}
+	return user, nil
+}
+
+func (o *OIDCService) availableUsername(ctx context.Context, identity oidcIdentityClaims) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	base = usernameDisallowed.ReplaceAllString(strings.ToLower(base), "")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, findErr := o.UserRepository.FindByUsername(ctx, candidate); findErr != nil {
+			return candidate, nil
+		}
+		suffix, suffixErr := helper.GenerateVerificationCode()
+		if suffixErr != nil {
+			return "", suffixErr
+		}
+		candidate = base + suffix[:4]
+	}
+	return "", fmt.Errorf("could not find an available username for %s", base)
+}
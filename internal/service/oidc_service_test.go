@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testOIDCClientID = "arkive-test"
+
+// stubOIDCProvider is a local stand-in identity provider serving discovery,
+// a key set and a token endpoint that hands out id_tokens with the claims the
+// test sets.
+type stubOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu            sync.Mutex
+	claims        jwt.MapClaims
+	tokenFailure  string
+	tokenRequests int
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	t.Helper()
+	key, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	if keyErr != nil {
+		t.Fatal(keyErr)
+	}
+	provider := &stubOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(writer http.ResponseWriter, request *http.Request) {
+		writeStubJSON(writer, http.StatusOK, map[string]any{
+			"issuer":                                provider.server.URL,
+			"authorization_endpoint":                provider.server.URL + "/authorize",
+			"token_endpoint":                        provider.server.URL + "/token",
+			"jwks_uri":                              provider.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(writer http.ResponseWriter, request *http.Request) {
+		writeStubJSON(writer, http.StatusOK, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "stub",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", provider.token)
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (p *stubOIDCProvider) token(writer http.ResponseWriter, request *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokenRequests++
+
+	if p.tokenFailure != "" {
+		writeStubJSON(writer, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": p.tokenFailure})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": p.server.URL,
+		"aud": testOIDCClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub"
+	idToken, signErr := token.SignedString(p.key)
+	if signErr != nil {
+		http.Error(writer, signErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeStubJSON(writer, http.StatusOK, map[string]any{
+		"access_token": "stub-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *stubOIDCProvider) issue(claims jwt.MapClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+func writeStubJSON(writer http.ResponseWriter, status int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(body)
+}
+
+// oidcUserRepo implements the lookups OIDC sign-in makes; any other call
+// panics on the nil embedded interface.
+type oidcUserRepo struct {
+	users.UserRepository
+	byEmail    map[string]*users.User
+	byIdentity map[string]*users.User
+	linked     map[string]uuid.UUID
+}
+
+func newOIDCUserRepo(existing ...*users.User) *oidcUserRepo {
+	repo := &oidcUserRepo{byEmail: map[string]*users.User{}, byIdentity: map[string]*users.User{}, linked: map[string]uuid.UUID{}}
+	for _, user := range existing {
+		repo.byEmail[user.Email] = user
+	}
+	return repo
+}
+
+func (r *oidcUserRepo) FindByIdentity(ctx context.Context, provider string, subject string) (*users.User, error) {
+	if user, ok := r.byIdentity[provider+"|"+subject]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("identity not found")
+}
+
+func (r *oidcUserRepo) FindByEmail(ctx context.Context, email string) (*users.User, error) {
+	if user, ok := r.byEmail[email]; ok {
+		return user, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (r *oidcUserRepo) LinkIdentity(ctx context.Context, userID uuid.UUID, provider string, subject string, email string) error {
+	r.linked[provider+"|"+subject] = userID
+	return nil
+}
+
+type oidcLogin struct {
+	stateToken, state, nonce string
+}
+
+func newTestOIDCService(t *testing.T, repo *oidcUserRepo) (*OIDCService, *stubOIDCProvider) {
+	t.Helper()
+	provider := newStubOIDCProvider(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	loginService := &LoginService{UserRepository: repo, JwtSecret: "test-secret", Logger: logger}
+	oidcService := NewOIDCService(repo, loginService, "stub", provider.server.URL, testOIDCClientID, "client-secret",
+		"https://arkive.test/auth/oidc/callback", nil, "test-secret", logger)
+	return oidcService, provider
+}
+
+func startTestLogin(t *testing.T, oidcService *OIDCService) oidcLogin {
+	t.Helper()
+	authURL, stateToken, startErr := oidcService.StartLogin(context.Background())
+	if startErr != nil {
+		t.Fatalf("StartLogin: %v", startErr)
+	}
+	parsed, parseErr := url.Parse(authURL)
+	if parseErr != nil {
+		t.Fatalf("parse authorization URL: %v", parseErr)
+	}
+	query := parsed.Query()
+	if query.Get("state") == "" || query.Get("nonce") == "" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL %s lacks state, nonce or PKCE challenge", authURL)
+	}
+	return oidcLogin{stateToken: stateToken, state: query.Get("state"), nonce: query.Get("nonce")}
+}
+
+func identityClaims(nonce string, subject string, email string, emailVerified bool) jwt.MapClaims {
+	return jwt.MapClaims{"sub": subject, "nonce": nonce, "email": email, "email_verified": emailVerified}
+}
+
+// Accounts with two-factor authentication get a challenge token from
+// startSession without touching notifications, which keeps the fixtures small.
+func twoFactorUser(email string, verified bool) *users.User {
+	return &users.User{ID: uuid.New(), Username: "ana", Email: email, IsVerified: verified, TOTPEnabled: true}
+}
+
+func TestOIDCLinksVerifiedAccountWithSameEmail(t *testing.T) {
+	existing := twoFactorUser("ana@example.com", true)
+	repo := newOIDCUserRepo(existing)
+	oidcService, provider := newTestOIDCService(t, repo)
+
+	login := startTestLogin(t, oidcService)
+	provider.issue(identityClaims(login.nonce, "subject-1", "ana@example.com", true))
+
+	result, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, login.state, "code", "203.0.113.7")
+	if loginErr != nil {
+		t.Fatalf("CompleteLogin: %v", loginErr)
+	}
+	if result.ChallengeToken == "" {
+		t.Error("expected a two-factor challenge for the linked account")
+	}
+	if repo.linked["stub|subject-1"] != existing.ID {
+		t.Errorf("identity linked to %v, want %v", repo.linked["stub|subject-1"], existing.ID)
+	}
+}
+
+func TestOIDCSignsInAlreadyLinkedIdentity(t *testing.T) {
+	existing := twoFactorUser("ana@example.com", true)
+	repo := newOIDCUserRepo()
+	repo.byIdentity["stub|subject-1"] = existing
+	oidcService, provider := newTestOIDCService(t, repo)
+
+	login := startTestLogin(t, oidcService)
+	// The provider's email changed since the account was linked.
+	provider.issue(identityClaims(login.nonce, "subject-1", "ana@elsewhere.example", false))
+
+	if _, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, login.state, "code", "203.0.113.7"); loginErr != nil {
+		t.Fatalf("CompleteLogin: %v", loginErr)
+	}
+	if len(repo.linked) != 0 {
+		t.Errorf("linked identities again: %v", repo.linked)
+	}
+}
+
+func TestOIDCRefusesToLinkUnverifiedAccount(t *testing.T) {
+	repo := newOIDCUserRepo(twoFactorUser("ana@example.com", false))
+	oidcService, provider := newTestOIDCService(t, repo)
+
+	login := startTestLogin(t, oidcService)
+	provider.issue(identityClaims(login.nonce, "subject-1", "ana@example.com", true))
+
+	_, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, login.state, "code", "203.0.113.7")
+	if !errors.Is(loginErr, helper.ErrConflict) {
+		t.Fatalf("CompleteLogin = %v, want %v", loginErr, helper.ErrConflict)
+	}
+	if len(repo.linked) != 0 {
+		t.Errorf("linked an unverified account: %v", repo.linked)
+	}
+}
+
+func TestOIDCRequiresVerifiedProviderEmail(t *testing.T) {
+	repo := newOIDCUserRepo(twoFactorUser("ana@example.com", true))
+	oidcService, provider := newTestOIDCService(t, repo)
+
+	login := startTestLogin(t, oidcService)
+	provider.issue(identityClaims(login.nonce, "subject-1", "ana@example.com", false))
+
+	_, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, login.state, "code", "203.0.113.7")
+	if !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Fatalf("CompleteLogin = %v, want %v", loginErr, helper.ErrUnauthorized)
+	}
+	if len(repo.linked) != 0 {
+		t.Errorf("linked on an unverified provider email: %v", repo.linked)
+	}
+}
+
+func TestOIDCRejectsStateMismatch(t *testing.T) {
+	repo := newOIDCUserRepo(twoFactorUser("ana@example.com", true))
+	oidcService, provider := newTestOIDCService(t, repo)
+
+	login := startTestLogin(t, oidcService)
+	other := startTestLogin(t, oidcService)
+	provider.issue(identityClaims(login.nonce, "subject-1", "ana@example.com", true))
+
+	_, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, other.state, "code", "203.0.113.7")
+	if !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Fatalf("CompleteLogin = %v, want %v", loginErr, helper.ErrUnauthorized)
+	}
+	if provider.tokenRequests != 0 {
+		t.Error("exchanged the code despite the state mismatch")
+	}
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	repo := newOIDCUserRepo(twoFactorUser("ana@example.com", true))
+	oidcService, provider := newTestOIDCService(t, repo)
+
+	login := startTestLogin(t, oidcService)
+	other := startTestLogin(t, oidcService)
+	provider.issue(identityClaims(other.nonce, "subject-1", "ana@example.com", true))
+
+	_, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, login.state, "code", "203.0.113.7")
+	if !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Fatalf("CompleteLogin = %v, want %v", loginErr, helper.ErrUnauthorized)
+	}
+	if len(repo.linked) != 0 {
+		t.Errorf("linked despite the nonce mismatch: %v", repo.linked)
+	}
+}
+
+func TestOIDCKeepsProviderErrorsOutOfTheResponse(t *testing.T) {
+	oidcService, provider := newTestOIDCService(t, newOIDCUserRepo())
+	provider.tokenFailure = "code was issued to another client"
+
+	login := startTestLogin(t, oidcService)
+	_, loginErr := oidcService.CompleteLogin(context.Background(), login.stateToken, login.state, "code", "203.0.113.7")
+	if !errors.Is(loginErr, helper.ErrUnauthorized) {
+		t.Fatalf("CompleteLogin = %v, want %v", loginErr, helper.ErrUnauthorized)
+	}
+	if strings.Contains(loginErr.Error(), "another client") || strings.Contains(loginErr.Error(), "invalid_grant") {
+		t.Errorf("provider detail reached the error: %q", loginErr)
+	}
+}
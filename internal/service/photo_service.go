@@ -2,46 +2,202 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/metrics"
 	"github.com/meliocool/arkive/internal/repository/photos"
+	"github.com/meliocool/arkive/internal/repository/transactor"
 	"github.com/meliocool/arkive/internal/repository/users"
+	"github.com/meliocool/arkive/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
+	"log/slog"
+	"time"
 )
 
 type PhotoService struct {
-	PhotoRepository photos.PhotoRepository
-	UserRepository  users.UserRepository
-	IpfsService     IpfsService
+	PhotoRepository     photos.PhotoRepository
+	UserRepository      users.UserRepository
+	IpfsService         IpfsService
+	Transactor          transactor.Transactor
+	BlocklistService    *BlocklistService
+	NotificationService *NotificationService
+	EventBus            *EventBus
+	DefaultQuotaBytes   int64
+	Metrics             *metrics.Metrics
+	Logger              *slog.Logger
 }
 
-func NewPhotoService(photoRepository photos.PhotoRepository, userRepository users.UserRepository, ipfsService IpfsService) *PhotoService {
+// Reasons passed to RemovePhoto; they end up in the owner's notification.
+const (
+	PhotoRemovedByOwner      = "owner"
+	PhotoRemovedByModeration = "moderation"
+)
+
+type StorageUsage struct {
+	PhotoCount     int
+	UsedBytes      int64
+	QuotaBytes     int64
+	RemainingBytes int64
+}
+
+func NewPhotoService(photoRepository photos.PhotoRepository, userRepository users.UserRepository, ipfsService IpfsService, transactor transactor.Transactor, blocklistService *BlocklistService, notificationService *NotificationService, eventBus *EventBus, defaultQuotaBytes int64, appMetrics *metrics.Metrics, logger *slog.Logger) *PhotoService {
 	return &PhotoService{
-		PhotoRepository: photoRepository,
-		UserRepository:  userRepository,
-		IpfsService:     ipfsService,
+		PhotoRepository:     photoRepository,
+		UserRepository:      userRepository,
+		IpfsService:         ipfsService,
+		Transactor:          transactor,
+		BlocklistService:    blocklistService,
+		NotificationService: notificationService,
+		EventBus:            eventBus,
+		DefaultQuotaBytes:   defaultQuotaBytes,
+		Metrics:             appMetrics,
+		Logger:              logger,
+	}
+}
+
+// UploadPhoto rejects the upload up front when the declared size would not fit
+// the user's quota or the file matches the blocklist, then checks the quota
+// again against the size Pinata actually pinned while holding a lock on the
+// user, so parallel uploads cannot overshoot it.
+func (ps *PhotoService) UploadPhoto(ctx context.Context, userID uuid.UUID, filename string, file io.ReadSeeker, size int64) (savedPhoto *photos.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.UploadPhoto",
+		attribute.String("user.id", userID.String()),
+		attribute.Int64("photo.declared_size", size),
+	)
+	defer tracing.End(span, &err)
+
+	start := time.Now()
+	savedPhoto, err = ps.uploadPhoto(ctx, userID, filename, file, size)
+	if err != nil {
+		ps.Metrics.ObserveUpload(0, time.Since(start), err)
+		return nil, err
 	}
+	ps.Metrics.ObserveUpload(savedPhoto.SizeBytes, time.Since(start), nil)
+	span.SetAttributes(attribute.String("photo.id", savedPhoto.ID.String()), attribute.Int64("photo.size", savedPhoto.SizeBytes))
+	return savedPhoto, nil
 }
 
-func (ps *PhotoService) UploadPhoto(ctx context.Context, userID uuid.UUID, filename string, file io.Reader) (*photos.Photo, error) {
-	ipfsCid, uploadErr := ps.IpfsService.UploadFile(ctx, filename, file)
+func (ps *PhotoService) uploadPhoto(ctx context.Context, userID uuid.UUID, filename string, file io.ReadSeeker, size int64) (*photos.Photo, error) {
+	usage, usageErr := ps.Usage(ctx, userID)
+	if usageErr != nil {
+		return nil, usageErr
+	}
+	if size > usage.RemainingBytes {
+		return nil, quotaExceededErr(usage)
+	}
+
+	if blockErr := ps.BlocklistService.CheckUpload(ctx, userID, filename, file); blockErr != nil {
+		return nil, blockErr
+	}
+
+	counter := &countingReader{reader: file}
+	uploaded, uploadErr := ps.IpfsService.UploadFile(ctx, filename, counter)
 	if uploadErr != nil {
 		return nil, uploadErr
 	}
-	photo := photos.Photo{
-		IPFSCid:  ipfsCid,
-		Filename: filename,
-		UserID:   userID,
+	sizeBytes := uploaded.PinSize
+	if sizeBytes <= 0 {
+		sizeBytes = counter.count
 	}
-	savedPhoto, createErr := ps.PhotoRepository.Create(ctx, &photo)
-	if createErr != nil {
-		return nil, createErr
+
+	var savedPhoto *photos.Photo
+	txErr := ps.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if lockErr := ps.UserRepository.LockForUpdate(ctx, userID); lockErr != nil {
+			return lockErr
+		}
+		usage, usageErr := ps.Usage(ctx, userID)
+		if usageErr != nil {
+			return usageErr
+		}
+		if sizeBytes > usage.RemainingBytes {
+			return quotaExceededErr(usage)
+		}
+
+		var createErr error
+		savedPhoto, createErr = ps.PhotoRepository.Create(ctx, &photos.Photo{
+			IPFSCid:   uploaded.IpfsHash,
+			Filename:  filename,
+			UserID:    userID,
+			SizeBytes: sizeBytes,
+		})
+		return createErr
+	})
+	if txErr != nil {
+		// A duplicate pin is shared with an earlier upload, so it must stay.
+		if !uploaded.IsDuplicate {
+			if unpinErr := ps.IpfsService.UnpinFile(context.WithoutCancel(ctx), uploaded.IpfsHash); unpinErr != nil {
+				ps.Logger.ErrorContext(ctx, "failed to unpin rejected upload", "cid", uploaded.IpfsHash, "error", unpinErr)
+			}
+		}
+		return nil, txErr
 	}
+
+	ps.EventBus.Publish(userID, EventPhotoCreated, PhotoEventData{
+		ID:        savedPhoto.ID,
+		Filename:  savedPhoto.Filename,
+		IPFSCid:   savedPhoto.IPFSCid,
+		SizeBytes: savedPhoto.SizeBytes,
+	})
+	ps.NotificationService.Notify(ctx, NotificationEvent{
+		Type:   NotificationPhotoUploaded,
+		UserID: userID,
+		Data: map[string]any{
+			"photo_id":   savedPhoto.ID.String(),
+			"filename":   savedPhoto.Filename,
+			"ipfs_cid":   savedPhoto.IPFSCid,
+			"size_bytes": savedPhoto.SizeBytes,
+		},
+	})
 	return savedPhoto, nil
 }
 
-func (ps *PhotoService) ListPhotos(ctx context.Context, userID uuid.UUID) ([]*photos.Photo, error) {
+func (ps *PhotoService) Usage(ctx context.Context, userID uuid.UUID) (_ *StorageUsage, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.Usage", attribute.String("user.id", userID.String()))
+	defer tracing.End(span, &err)
+
+	user, findErr := ps.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+	usage, usageErr := ps.PhotoRepository.UsageByUserID(ctx, userID)
+	if usageErr != nil {
+		return nil, usageErr
+	}
+
+	quota := ps.DefaultQuotaBytes
+	if user.StorageQuotaBytes != nil {
+		quota = *user.StorageQuotaBytes
+	}
+	return &StorageUsage{
+		PhotoCount:     usage.PhotoCount,
+		UsedBytes:      usage.TotalBytes,
+		QuotaBytes:     quota,
+		RemainingBytes: max(quota-usage.TotalBytes, 0),
+	}, nil
+}
+
+func quotaExceededErr(usage *StorageUsage) error {
+	return fmt.Errorf("%w: %d of %d bytes used", helper.ErrQuotaExceeded, usage.UsedBytes, usage.QuotaBytes)
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+func (ps *PhotoService) ListPhotos(ctx context.Context, userID uuid.UUID) (_ []*photos.Photo, err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.ListPhotos", attribute.String("user.id", userID.String()))
+	defer tracing.End(span, &err)
+
 	photoList, findErr := ps.PhotoRepository.FindByUserID(ctx, userID)
 	if findErr != nil {
 		return nil, findErr
@@ -49,35 +205,78 @@ func (ps *PhotoService) ListPhotos(ctx context.Context, userID uuid.UUID) ([]*ph
 	return photoList, nil
 }
 
-func (ps *PhotoService) DeletePhoto(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) error {
+func (ps *PhotoService) DeletePhoto(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.DeletePhoto",
+		attribute.String("user.id", userID.String()),
+		attribute.String("photo.id", photoID.String()),
+	)
+	defer tracing.End(span, &err)
+
 	allPhotos, getAllPhotosErr := ps.PhotoRepository.FindByUserID(ctx, userID)
 	if getAllPhotosErr != nil {
 		return fmt.Errorf("could not find all photos owned by this user: %w", getAllPhotosErr)
 	}
-	var ipfsCID string
-	found := false
 	for i := range allPhotos {
 		if allPhotos[i].ID == photoID {
-			ipfsCID = allPhotos[i].IPFSCid
-			found = true
-			break
+			return ps.RemovePhoto(ctx, allPhotos[i], PhotoRemovedByOwner)
 		}
 	}
-	if !found {
-		return helper.ErrNotFound
-	}
+	return helper.ErrNotFound
+}
 
-	if unpinErr := ps.IpfsService.UnpinFile(ctx, ipfsCID); unpinErr != nil {
-		return fmt.Errorf("unpin ipfs cid %s: %w", ipfsCID, unpinErr)
+// RemovePhoto deletes a photo without any ownership check; callers are
+// responsible for authorizing the removal. Once the row is gone the content
+// is unpinned unless another photo shares its CID; a failed unpin is logged
+// rather than undoing the removal. The owner is notified with the given reason.
+func (ps *PhotoService) RemovePhoto(ctx context.Context, photo *photos.Photo, reason string) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.RemovePhoto",
+		attribute.String("photo.id", photo.ID.String()),
+		attribute.String("photo.removal_reason", reason),
+	)
+	defer tracing.End(span, &err)
+
+	var inUse bool
+	txErr := ps.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if deleteErr := ps.PhotoRepository.Delete(ctx, photo.ID); deleteErr != nil {
+			return fmt.Errorf("delete photo record failed: %w", deleteErr)
+		}
+		var inUseErr error
+		inUse, inUseErr = ps.PhotoRepository.IsCIDInUse(ctx, photo.IPFSCid)
+		return inUseErr
+	})
+	if txErr != nil {
+		return txErr
 	}
 
-	if deleteErr := ps.PhotoRepository.Delete(ctx, photoID); deleteErr != nil {
-		return fmt.Errorf("delete photo record failed: %w", deleteErr)
+	if !inUse {
+		if unpinErr := ps.IpfsService.UnpinFile(ctx, photo.IPFSCid); unpinErr != nil && !errors.Is(unpinErr, ErrNotPinned) {
+			ps.Logger.ErrorContext(ctx, "failed to unpin removed photo", "photo_id", photo.ID, "cid", photo.IPFSCid, "error", unpinErr)
+		}
 	}
+
+	ps.EventBus.Publish(photo.UserID, EventPhotoDeleted, PhotoEventData{
+		ID:       photo.ID,
+		Filename: photo.Filename,
+	})
+	ps.NotificationService.Notify(ctx, NotificationEvent{
+		Type:   NotificationPhotoDeleted,
+		UserID: photo.UserID,
+		Data: map[string]any{
+			"photo_id": photo.ID.String(),
+			"filename": photo.Filename,
+			"reason":   reason,
+		},
+	})
 	return nil
 }
 
-func (ps *PhotoService) SetProfilePictureCID(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) error {
+func (ps *PhotoService) SetProfilePictureCID(ctx context.Context, userID uuid.UUID, photoID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "PhotoService.SetProfilePictureCID",
+		attribute.String("user.id", userID.String()),
+		attribute.String("photo.id", photoID.String()),
+	)
+	defer tracing.End(span, &err)
+
 	allPhotos, getAllPhotosErr := ps.PhotoRepository.FindByUserID(ctx, userID)
 	if getAllPhotosErr != nil {
 		return fmt.Errorf("could not find all photos owned by this user: %w", getAllPhotosErr)
@@ -101,5 +300,8 @@ func (ps *PhotoService) SetProfilePictureCID(ctx context.Context, userID uuid.UU
 	if updateErr != nil {
 		return fmt.Errorf("failure in updating profile picture: %w", updateErr)
 	}
+	if user, findErr := ps.UserRepository.FindByID(ctx, userID); findErr == nil {
+		ps.EventBus.Publish(userID, EventProfileUpdated, profileEventData(user))
+	}
 	return nil
 }
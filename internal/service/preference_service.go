@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/notifications"
+)
+
+const (
+	CategoryPhotos   = "photos"
+	CategorySecurity = "security"
+
+	ChannelInApp = notifications.ChannelInApp
+	ChannelEmail = notifications.ChannelEmail
+)
+
+// notificationCategories holds the default for every category and channel a
+// user can choose. Account emails such as verification codes have no category
+// and are always sent.
+var notificationCategories = map[string]map[string]bool{
+	CategoryPhotos:   {ChannelInApp: true, ChannelEmail: false},
+	CategorySecurity: {ChannelInApp: true, ChannelEmail: true},
+}
+
+type PreferenceService struct {
+	NotificationRepository notifications.NotificationRepository
+	JwtSecret              string
+	BaseURL                string
+}
+
+func NewPreferenceService(notificationRepository notifications.NotificationRepository, jwtSecret string, baseURL string) *PreferenceService {
+	return &PreferenceService{NotificationRepository: notificationRepository, JwtSecret: jwtSecret, BaseURL: baseURL}
+}
+
+// Preferences returns every category and channel with the choice in effect,
+// falling back to the default where the user has not picked one.
+func (ps *PreferenceService) Preferences(ctx context.Context, userID uuid.UUID) (map[string]map[string]bool, error) {
+	stored, prefErr := ps.NotificationRepository.Preferences(ctx, userID)
+	if prefErr != nil {
+		return nil, prefErr
+	}
+
+	preferences := make(map[string]map[string]bool, len(notificationCategories))
+	for category, defaults := range notificationCategories {
+		preferences[category] = make(map[string]bool, len(defaults))
+		for channel, enabled := range defaults {
+			if choice, ok := stored[category][channel]; ok {
+				enabled = choice
+			}
+			preferences[category][channel] = enabled
+		}
+	}
+	return preferences, nil
+}
+
+// Update applies choices keyed by category and then by channel. Nothing is
+// saved when any of them is unknown.
+func (ps *PreferenceService) Update(ctx context.Context, userID uuid.UUID, choices map[string]map[string]bool) error {
+	for category, channels := range choices {
+		defaults, ok := notificationCategories[category]
+		if !ok {
+			return fmt.Errorf("%w: unknown notification category %q", helper.ErrBadRequest, category)
+		}
+		for channel := range channels {
+			if _, ok := defaults[channel]; !ok {
+				return fmt.Errorf("%w: unknown channel %q", helper.ErrBadRequest, channel)
+			}
+		}
+	}
+
+	for category, channels := range choices {
+		for channel, enabled := range channels {
+			if setErr := ps.NotificationRepository.SetPreference(ctx, userID, category, channel, enabled); setErr != nil {
+				return setErr
+			}
+		}
+	}
+	return nil
+}
+
+// UnsubscribeURL returns the link that turns off email for category, used in
+// the List-Unsubscribe header and the email footer.
+func (ps *PreferenceService) UnsubscribeURL(userID uuid.UUID, category string) (string, error) {
+	token, tokenErr := helper.SignToken(ps.JwtSecret, helper.Claims{
+		Purpose: helper.TokenPurposeUnsubscribe,
+		Scope:   category,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: userID.String(),
+		},
+	}, 0)
+	if tokenErr != nil {
+		return "", fmt.Errorf("failed to sign unsubscribe token: %w", tokenErr)
+	}
+	return fmt.Sprintf("%s/unsubscribe/%s", ps.BaseURL, token), nil
+}
+
+// UnsubscribeTarget checks an unsubscribe token and returns who and what it is
+// for, without changing anything.
+func (ps *PreferenceService) UnsubscribeTarget(token string) (uuid.UUID, string, error) {
+	claims, parseErr := helper.ParseToken(ps.JwtSecret, token)
+	if parseErr != nil || claims.Purpose != helper.TokenPurposeUnsubscribe {
+		return uuid.Nil, "", helper.ErrNotFound
+	}
+	userID, idErr := uuid.Parse(claims.Subject)
+	if idErr != nil {
+		return uuid.Nil, "", helper.ErrNotFound
+	}
+	if _, ok := notificationCategories[claims.Scope]; !ok {
+		return uuid.Nil, "", helper.ErrNotFound
+	}
+	return userID, claims.Scope, nil
+}
+
+// Unsubscribe turns off email for the category in token and returns it.
+func (ps *PreferenceService) Unsubscribe(ctx context.Context, token string) (string, error) {
+	userID, category, targetErr := ps.UnsubscribeTarget(token)
+	if targetErr != nil {
+		return "", targetErr
+	}
+	if setErr := ps.NotificationRepository.SetPreference(ctx, userID, category, ChannelEmail, false); setErr != nil {
+		return "", setErr
+	}
+	return category, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/notifications"
+	"strings"
+	"testing"
+	"time"
+)
+
+// preferenceRepo keeps stored preferences in memory; any other call panics on
+// the nil embedded interface.
+type preferenceRepo struct {
+	notifications.NotificationRepository
+	stored map[string]map[string]bool
+}
+
+func (r *preferenceRepo) Preferences(ctx context.Context, userID uuid.UUID) (map[string]map[string]bool, error) {
+	return r.stored, nil
+}
+
+func (r *preferenceRepo) SetPreference(ctx context.Context, userID uuid.UUID, category string, channel string, enabled bool) error {
+	if r.stored == nil {
+		r.stored = map[string]map[string]bool{}
+	}
+	if r.stored[category] == nil {
+		r.stored[category] = map[string]bool{}
+	}
+	r.stored[category][channel] = enabled
+	return nil
+}
+
+func newTestPreferences() (*PreferenceService, *preferenceRepo) {
+	repo := &preferenceRepo{}
+	return NewPreferenceService(repo, "test-secret", "https://arkive.test"), repo
+}
+
+func unsubscribeToken(t *testing.T, preferenceService *PreferenceService, userID uuid.UUID, category string) string {
+	t.Helper()
+	url, urlErr := preferenceService.UnsubscribeURL(userID, category)
+	if urlErr != nil {
+		t.Fatalf("UnsubscribeURL: %v", urlErr)
+	}
+	token, found := strings.CutPrefix(url, "https://arkive.test/unsubscribe/")
+	if !found {
+		t.Fatalf("unsubscribe URL %q is not under the base URL", url)
+	}
+	return token
+}
+
+func TestUnsubscribeTargetReadsSignedToken(t *testing.T) {
+	preferenceService, _ := newTestPreferences()
+	userID := uuid.New()
+
+	target, category, targetErr := preferenceService.UnsubscribeTarget(unsubscribeToken(t, preferenceService, userID, CategoryPhotos))
+	if targetErr != nil || target != userID || category != CategoryPhotos {
+		t.Errorf("UnsubscribeTarget = %s, %q, %v; want %s, %q", target, category, targetErr, userID, CategoryPhotos)
+	}
+}
+
+func TestUnsubscribeTargetRejectsOtherTokens(t *testing.T) {
+	preferenceService, _ := newTestPreferences()
+	userID := uuid.New()
+	sign := func(secret string, claims helper.Claims) string {
+		token, signErr := helper.SignToken(secret, claims, time.Hour)
+		if signErr != nil {
+			t.Fatal(signErr)
+		}
+		return token
+	}
+	subject := jwt.RegisteredClaims{Subject: userID.String()}
+
+	tokens := map[string]string{
+		"malformed":        "not-a-token",
+		"wrong secret":     sign("another-secret", helper.Claims{Purpose: helper.TokenPurposeUnsubscribe, Scope: CategoryPhotos, RegisteredClaims: subject}),
+		"other purpose":    sign("test-secret", helper.Claims{Purpose: helper.TokenPurposeExport, Scope: CategoryPhotos, RegisteredClaims: subject}),
+		"unknown category": sign("test-secret", helper.Claims{Purpose: helper.TokenPurposeUnsubscribe, Scope: "marketing", RegisteredClaims: subject}),
+		"missing subject":  sign("test-secret", helper.Claims{Purpose: helper.TokenPurposeUnsubscribe, Scope: CategoryPhotos}),
+	}
+	for name, token := range tokens {
+		if _, _, targetErr := preferenceService.UnsubscribeTarget(token); !errors.Is(targetErr, helper.ErrNotFound) {
+			t.Errorf("%s: UnsubscribeTarget = %v, want ErrNotFound", name, targetErr)
+		}
+	}
+}
+
+func TestUnsubscribeOnlyTurnsOffEmailForItsCategory(t *testing.T) {
+	preferenceService, repo := newTestPreferences()
+	userID := uuid.New()
+
+	category, unsubscribeErr := preferenceService.Unsubscribe(context.Background(), unsubscribeToken(t, preferenceService, userID, CategorySecurity))
+	if unsubscribeErr != nil || category != CategorySecurity {
+		t.Fatalf("Unsubscribe = %q, %v; want %q", category, unsubscribeErr, CategorySecurity)
+	}
+
+	preferences, prefErr := preferenceService.Preferences(context.Background(), userID)
+	if prefErr != nil {
+		t.Fatalf("Preferences: %v", prefErr)
+	}
+	if preferences[CategorySecurity][ChannelEmail] {
+		t.Error("security email is still on")
+	}
+	if !preferences[CategorySecurity][ChannelInApp] {
+		t.Error("in-app security notifications were turned off too")
+	}
+	if len(repo.stored) != 1 || len(repo.stored[CategorySecurity]) != 1 {
+		t.Errorf("stored %v, want only the security email choice", repo.stored)
+	}
+}
+
+func TestUpdatePreferencesRejectsUnknownChoices(t *testing.T) {
+	preferenceService, repo := newTestPreferences()
+
+	updateErr := preferenceService.Update(context.Background(), uuid.New(), map[string]map[string]bool{
+		CategoryPhotos: {ChannelEmail: true},
+		"marketing":    {ChannelEmail: true},
+	})
+	if !errors.Is(updateErr, helper.ErrBadRequest) {
+		t.Fatalf("Update = %v, want ErrBadRequest", updateErr)
+	}
+	if len(repo.stored) != 0 {
+		t.Errorf("stored %v although the update was rejected", repo.stored)
+	}
+}
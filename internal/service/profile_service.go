@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/transactor"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	emailChangeCodeTTL = time.Minute * 15
+	// maxEmailChangeAttempts cancels a pending email change after this many
+	// wrong codes, so the 6-digit code cannot be guessed.
+	maxEmailChangeAttempts = 5
+
+	maxDisplayNameLength = 50
+	maxBioLength         = 500
+	maxWebsiteLength     = 200
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,30}$`)
+
+// reservedUsernames would collide with routes such as /users/me.
+var reservedUsernames = map[string]bool{
+	"me":    true,
+	"admin": true,
+}
+
+type ProfileService struct {
+	UserRepository users.UserRepository
+	Transactor     transactor.Transactor
+	EmailService   *EmailService
+	EventBus       *EventBus
+	Logger         *slog.Logger
+}
+
+// ProfileUpdate holds the fields of a PATCH request; nil fields are left as they are.
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Website     *string
+	Username    *string
+	Locale      *string
+}
+
+func NewProfileService(userRepository users.UserRepository, transactor transactor.Transactor, emailService *EmailService, eventBus *EventBus, logger *slog.Logger) *ProfileService {
+	return &ProfileService{UserRepository: userRepository, Transactor: transactor, EmailService: emailService, EventBus: eventBus, Logger: logger}
+}
+
+func (ps *ProfileService) UpdateProfile(ctx context.Context, userID uuid.UUID, update ProfileUpdate) (*users.User, error) {
+	user, findErr := ps.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+
+	displayName, bio, website := user.DisplayName, user.Bio, user.Website
+	if update.DisplayName != nil {
+		displayName = strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			return nil, fmt.Errorf("%w: display name must be at most %d characters", helper.ErrBadRequest, maxDisplayNameLength)
+		}
+	}
+	if update.Bio != nil {
+		bio = strings.TrimSpace(*update.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return nil, fmt.Errorf("%w: bio must be at most %d characters", helper.ErrBadRequest, maxBioLength)
+		}
+	}
+	if update.Website != nil {
+		website = strings.TrimSpace(*update.Website)
+		if websiteErr := validateWebsite(website); websiteErr != nil {
+			return nil, websiteErr
+		}
+	}
+
+	locale := user.Locale
+	if update.Locale != nil {
+		var localeErr error
+		if locale, localeErr = ValidateLocale(*update.Locale); localeErr != nil {
+			return nil, localeErr
+		}
+	}
+	username := user.Username
+	if update.Username != nil {
+		username = strings.TrimSpace(*update.Username)
+	}
+
+	// The fields are saved together or not at all.
+	txErr := ps.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if displayName != user.DisplayName || bio != user.Bio || website != user.Website {
+			if updateErr := ps.UserRepository.UpdateProfile(ctx, user.ID, displayName, bio, website); updateErr != nil {
+				return fmt.Errorf("failed to update profile: %w", updateErr)
+			}
+		}
+		if locale != user.Locale {
+			if updateErr := ps.UserRepository.UpdateLocale(ctx, user.ID, locale); updateErr != nil {
+				return fmt.Errorf("failed to update locale: %w", updateErr)
+			}
+		}
+		if username != user.Username {
+			return ps.changeUsername(ctx, user, username)
+		}
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return ps.updated(ctx, user.ID)
+}
+
+// updated reloads the user and pushes the new profile to their open streams.
+func (ps *ProfileService) updated(ctx context.Context, userID uuid.UUID) (*users.User, error) {
+	user, findErr := ps.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, findErr
+	}
+	ps.EventBus.Publish(user.ID, EventProfileUpdated, profileEventData(user))
+	return user, nil
+}
+
+// validateUsername applies to new accounts and renames alike.
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("%w: username must be 3-30 letters, digits, '.', '_' or '-'", helper.ErrBadRequest)
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		return fmt.Errorf("%w: username is reserved", helper.ErrBadRequest)
+	}
+	return nil
+}
+
+func (ps *ProfileService) changeUsername(ctx context.Context, user *users.User, username string) error {
+	if usernameErr := validateUsername(username); usernameErr != nil {
+		return usernameErr
+	}
+
+	// A case-only change of the caller's own name is allowed; anything else
+	// must be free.
+	if existing, findErr := ps.UserRepository.FindByUsername(ctx, username); findErr == nil && existing.ID != user.ID {
+		return fmt.Errorf("%w: username already taken", helper.ErrConflict)
+	}
+
+	if updateErr := ps.UserRepository.UpdateUsername(ctx, user.ID, username); updateErr != nil {
+		if errors.Is(updateErr, users.ErrUsernameTaken) {
+			return fmt.Errorf("%w: username already taken", helper.ErrConflict)
+		}
+		return fmt.Errorf("failed to update username: %w", updateErr)
+	}
+	return nil
+}
+
+// RequestEmailChange re-authenticates the caller and emails a confirmation
+// code to the new address. The address only changes once ConfirmEmailChange
+// is called with that code.
+func (ps *ProfileService) RequestEmailChange(ctx context.Context, userID uuid.UUID, newEmail, password string, authenticatedAt time.Time) error {
+	user, findErr := ps.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+
+	address, parseErr := mail.ParseAddress(strings.TrimSpace(newEmail))
+	if parseErr != nil || address.Name != "" {
+		return fmt.Errorf("%w: invalid email address", helper.ErrBadRequest)
+	}
+	newEmail = address.Address
+	if strings.EqualFold(newEmail, user.Email) {
+		return fmt.Errorf("%w: that is already your email address", helper.ErrBadRequest)
+	}
+
+	if reauthErr := reauthenticate(user, password, authenticatedAt); reauthErr != nil {
+		return reauthErr
+	}
+
+	if _, takenErr := ps.UserRepository.FindByEmail(ctx, newEmail); takenErr == nil {
+		return fmt.Errorf("%w: email already in use", helper.ErrConflict)
+	}
+
+	code, codeErr := helper.GenerateVerificationCode()
+	if codeErr != nil {
+		return fmt.Errorf("failed generating verification code: %w", codeErr)
+	}
+
+	expiresAt := time.Now().Add(emailChangeCodeTTL)
+	return ps.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if setErr := ps.UserRepository.SetPendingEmail(ctx, user.ID, newEmail, hashOneTimeCode(code), expiresAt); setErr != nil {
+			return fmt.Errorf("failed to store email change: %w", setErr)
+		}
+		return ps.EmailService.SendEmailChangeCodeEmailCtx(ctx, newEmail, user.Username, user.Locale, code)
+	})
+}
+
+func (ps *ProfileService) ConfirmEmailChange(ctx context.Context, userID uuid.UUID, code string) (*users.User, error) {
+	user, findErr := ps.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+
+	if user.PendingEmail == "" || user.EmailChangeExpires == nil || user.EmailChangeExpires.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: no email change pending", helper.ErrBadRequest)
+	}
+
+	// The attempt is counted before the code is compared, so parallel guesses
+	// cannot get past the limit.
+	attempts, attemptErr := ps.UserRepository.IncrementEmailChangeAttempts(ctx, user.ID)
+	if attemptErr != nil {
+		return nil, fmt.Errorf("%w: no email change pending", helper.ErrBadRequest)
+	}
+	matches := subtle.ConstantTimeCompare([]byte(hashOneTimeCode(code)), []byte(user.EmailChangeCodeHash)) == 1
+	if attempts > maxEmailChangeAttempts || (!matches && attempts == maxEmailChangeAttempts) {
+		if cancelErr := ps.UserRepository.CancelEmailChange(ctx, user.ID); cancelErr != nil {
+			return nil, cancelErr
+		}
+		return nil, fmt.Errorf("%w: too many wrong codes, request a new one", helper.ErrTooManyRequests)
+	}
+	if !matches {
+		return nil, helper.ErrUnauthorized
+	}
+
+	if confirmErr := ps.UserRepository.ConfirmEmailChange(ctx, user.ID); confirmErr != nil {
+		if errors.Is(confirmErr, users.ErrEmailTaken) {
+			return nil, fmt.Errorf("%w: email already in use", helper.ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to change email: %w", confirmErr)
+	}
+
+	return ps.updated(ctx, user.ID)
+}
+
+func validateWebsite(website string) error {
+	if website == "" {
+		return nil
+	}
+	if len(website) > maxWebsiteLength {
+		return fmt.Errorf("%w: website must be at most %d characters", helper.ErrBadRequest, maxWebsiteLength)
+	}
+	parsed, parseErr := url.Parse(website)
+	if parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: website must be an http or https URL", helper.ErrBadRequest)
+	}
+	return nil
+}
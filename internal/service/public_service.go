@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
 	"github.com/meliocool/arkive/internal/repository/photos"
 	"github.com/meliocool/arkive/internal/repository/users"
+	"time"
 )
 
 type PublicService struct {
@@ -28,14 +30,68 @@ func (ps *PublicService) FindAll(ctx context.Context) ([]*photos.Photo, error) {
 	return photoList, nil
 }
 
+// popularWindow is how far back likes count towards the popular ranking.
+const popularWindow = time.Hour * 24 * 7
+
+func (ps *PublicService) FindPopular(ctx context.Context, limit int, offset int) ([]*photos.Photo, error) {
+	return ps.PhotoRepository.FindPopular(ctx, time.Now().Add(-popularWindow), limit, offset)
+}
+
 func (ps *PublicService) FindUserProfile(ctx context.Context, userId uuid.UUID) (*users.User, []*photos.Photo, error) {
 	user, findUserErr := ps.UserRepository.FindByID(ctx, userId)
 	if findUserErr != nil {
-		return nil, nil, fmt.Errorf("failure in finding user: %w", findUserErr)
+		return nil, nil, fmt.Errorf("%w: failure in finding user: %v", helper.ErrNotFound, findUserErr)
+	}
+	return ps.profile(ctx, user)
+}
+
+func (ps *PublicService) FindUserProfileByUsername(ctx context.Context, username string) (*users.User, []*photos.Photo, error) {
+	user, findUserErr := ps.UserRepository.FindByUsername(ctx, username)
+	if findUserErr != nil {
+		return nil, nil, fmt.Errorf("%w: failure in finding user: %v", helper.ErrNotFound, findUserErr)
+	}
+	return ps.profile(ctx, user)
+}
+
+// profile hides accounts that are suspended, awaiting deletion or not yet
+// verified, answering as if they did not exist.
+func (ps *PublicService) profile(ctx context.Context, user *users.User) (*users.User, []*photos.Photo, error) {
+	if !isVisibleUser(user) {
+		return nil, nil, helper.ErrNotFound
 	}
-	userPhotos, findPhotosErr := ps.PhotoRepository.FindByUserID(ctx, userId)
+	userPhotos, findPhotosErr := ps.PhotoRepository.FindByUserID(ctx, user.ID)
 	if findPhotosErr != nil {
 		return nil, nil, fmt.Errorf("failure in finding photos for this user: %w", findPhotosErr)
 	}
-	return user, userPhotos, nil
+	return user, visiblePhotos(userPhotos), nil
+}
+
+// visiblePhotos drops photos hidden by moderation. The list queries used for
+// public listings already exclude them; FindByUserID also serves the owner.
+func visiblePhotos(photoList []*photos.Photo) []*photos.Photo {
+	visible := make([]*photos.Photo, 0, len(photoList))
+	for _, photo := range photoList {
+		if photo.HiddenAt == nil {
+			visible = append(visible, photo)
+		}
+	}
+	return visible
+}
+
+func isVisibleUser(user *users.User) bool {
+	return user.IsVerified && user.SuspendedAt == nil && user.DeletionRequestedAt == nil
+}
+
+// findVisiblePhoto answers as if the photo did not exist when it was hidden by
+// moderation or its owner is suspended, awaiting deletion or not yet verified.
+func findVisiblePhoto(ctx context.Context, photoRepository photos.PhotoRepository, userRepository users.UserRepository, photoID uuid.UUID) (*photos.Photo, error) {
+	photo, findErr := photoRepository.FindByID(ctx, photoID)
+	if findErr != nil || photo.HiddenAt != nil {
+		return nil, helper.ErrNotFound
+	}
+	owner, ownerErr := userRepository.FindByID(ctx, photo.UserID)
+	if ownerErr != nil || !isVisibleUser(owner) {
+		return nil, helper.ErrNotFound
+	}
+	return photo, nil
 }
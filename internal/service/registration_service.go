@@ -3,22 +3,22 @@ package service
 import (
 	"context"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/transactor"
 	"github.com/meliocool/arkive/internal/repository/users"
 	"golang.org/x/crypto/bcrypt"
-	"log"
-	"time"
+	"strings"
 )
 
 type RegistrationService struct {
 	UserRepository users.UserRepository
 	EmailService   *EmailService
+	Transactor     transactor.Transactor
 	JwtSecret      string
 }
 
-func NewRegistrationService(userRepository users.UserRepository, emailService *EmailService, jwtSecret string) *RegistrationService {
-	return &RegistrationService{UserRepository: userRepository, EmailService: emailService, JwtSecret: jwtSecret}
+func NewRegistrationService(userRepository users.UserRepository, emailService *EmailService, transactor transactor.Transactor, jwtSecret string) *RegistrationService {
+	return &RegistrationService{UserRepository: userRepository, EmailService: emailService, Transactor: transactor, JwtSecret: jwtSecret}
 }
 
 func (rs *RegistrationService) VerifyUser(ctx context.Context, email string, verificationCode string) (*users.User, string, error) {
@@ -36,23 +36,25 @@ func (rs *RegistrationService) VerifyUser(ctx context.Context, email string, ver
 		return nil, "", verifErr
 	}
 
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Subject:   user.ID.String(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	signedToken, tokenErr := token.SignedString([]byte(rs.JwtSecret))
+	signedToken, tokenErr := issueAccessToken(rs.JwtSecret, user)
 	if tokenErr != nil {
-		return nil, "", fmt.Errorf("token failed to generated")
+		return nil, "", tokenErr
 	}
 
 	return user, signedToken, nil
 }
 
-func (rs *RegistrationService) Register(ctx context.Context, username string, email string, password string) (*users.User, error) {
+func (rs *RegistrationService) Register(ctx context.Context, username string, email string, password string, locale string) (*users.User, error) {
+	username = strings.TrimSpace(username)
+	if usernameErr := validateUsername(username); usernameErr != nil {
+		return nil, usernameErr
+	}
+
+	locale, localeErr := ValidateLocale(locale)
+	if localeErr != nil {
+		return nil, localeErr
+	}
+
 	code, codeErr := helper.GenerateVerificationCode()
 	if codeErr != nil {
 		return nil, fmt.Errorf("failed generating verification code: %w", codeErr)
@@ -69,22 +71,23 @@ func (rs *RegistrationService) Register(ctx context.Context, username string, em
 		PasswordHash:     string(hashedPassword),
 		IsVerified:       false,
 		VerificationCode: code,
+		Locale:           locale,
 	}
 
-	user, createErr := rs.UserRepository.CreateUser(ctx, &userData)
-	if createErr != nil {
-		return nil, fmt.Errorf("failed to create account: %w", createErr)
-	}
-
-	go func(u *users.User, code string) {
-		bg, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := rs.EmailService.SendVerificationEmailCtx(bg, u.Email, u.Username, code, u.CreatedAt); err != nil {
-			log.Printf("async email failed: %v", err)
-		} else {
-			log.Printf("verification email queued/sent to %s", u.Email)
+	// The verification email is queued in the same transaction, so an account
+	// is never created without one.
+	var user *users.User
+	txErr := rs.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		created, createErr := rs.UserRepository.CreateUser(ctx, &userData)
+		if createErr != nil {
+			return fmt.Errorf("failed to create account: %w", createErr)
 		}
-	}(user, code)
+		user = created
+		return rs.EmailService.SendVerificationEmailCtx(ctx, created.Email, created.Username, created.Locale, code, created.CreatedAt)
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
 
 	return user, nil
 }
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/users"
+)
+
+type SessionService struct {
+	UserRepository users.UserRepository
+}
+
+func NewSessionService(userRepository users.UserRepository) *SessionService {
+	return &SessionService{UserRepository: userRepository}
+}
+
+// ValidateSession checks that the account behind an access token still
+// exists, may still sign in, and has not revoked its tokens since this one
+// was issued.
+func (ss *SessionService) ValidateSession(ctx context.Context, userID uuid.UUID, tokenVersion int) error {
+	user, findErr := ss.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return helper.ErrUnauthorized
+	}
+	if statusErr := accountStatusErr(user); statusErr != nil {
+		return statusErr
+	}
+	if user.TokenVersion != tokenVersion {
+		return helper.ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/transactor"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorService struct {
+	UserRepository users.UserRepository
+	Transactor     transactor.Transactor
+	Issuer         string
+}
+
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+func NewTwoFactorService(userRepository users.UserRepository, transactor transactor.Transactor, issuer string) *TwoFactorService {
+	return &TwoFactorService{UserRepository: userRepository, Transactor: transactor, Issuer: issuer}
+}
+
+func (ts *TwoFactorService) Enroll(ctx context.Context, userID uuid.UUID) (*TwoFactorEnrollment, error) {
+	user, findErr := ts.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, helper.ErrConflict
+	}
+
+	secret, secretErr := helper.GenerateTOTPSecret()
+	if secretErr != nil {
+		return nil, fmt.Errorf("failed generating totp secret: %w", secretErr)
+	}
+
+	if updateErr := ts.UserRepository.UpdateTOTP(ctx, user.ID, secret, false); updateErr != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", updateErr)
+	}
+
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    helper.TOTPAuthURI(ts.Issuer, user.Email, secret),
+	}, nil
+}
+
+func (ts *TwoFactorService) Confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, findErr := ts.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return nil, helper.ErrNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, helper.ErrConflict
+	}
+	if user.TOTPSecret == "" {
+		return nil, helper.ErrBadRequest
+	}
+	step, valid := helper.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !valid {
+		return nil, helper.ErrUnauthorized
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, codeErr := helper.GenerateRecoveryCode()
+		if codeErr != nil {
+			return nil, fmt.Errorf("failed generating recovery code: %w", codeErr)
+		}
+		codes = append(codes, recoveryCode)
+		hashes = append(hashes, hashOneTimeCode(recoveryCode))
+	}
+
+	txErr := ts.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if replaceErr := ts.UserRepository.ReplaceRecoveryCodes(ctx, user.ID, hashes); replaceErr != nil {
+			return replaceErr
+		}
+		if updateErr := ts.UserRepository.UpdateTOTP(ctx, user.ID, user.TOTPSecret, true); updateErr != nil {
+			return fmt.Errorf("failed to enable two-factor authentication: %w", updateErr)
+		}
+		used, useErr := ts.UserRepository.UseTOTPStep(ctx, user.ID, step)
+		if useErr != nil {
+			return useErr
+		}
+		if !used {
+			return helper.ErrUnauthorized
+		}
+		return nil
+	})
+	if txErr != nil {
+		return nil, txErr
+	}
+
+	return codes, nil
+}
+
+func (ts *TwoFactorService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	user, findErr := ts.UserRepository.FindByID(ctx, userID)
+	if findErr != nil {
+		return helper.ErrNotFound
+	}
+	if !user.TOTPEnabled {
+		return helper.ErrBadRequest
+	}
+	if verifyErr := ts.Verify(ctx, user, code); verifyErr != nil {
+		return verifyErr
+	}
+
+	return ts.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if replaceErr := ts.UserRepository.ReplaceRecoveryCodes(ctx, user.ID, nil); replaceErr != nil {
+			return replaceErr
+		}
+		return ts.UserRepository.UpdateTOTP(ctx, user.ID, "", false)
+	})
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code. A
+// recovery code is burned as soon as it is accepted, and a TOTP code is only
+// accepted once: its time step and every earlier one are refused afterwards.
+func (ts *TwoFactorService) Verify(ctx context.Context, user *users.User, code string) error {
+	if !user.TOTPEnabled {
+		return helper.ErrUnauthorized
+	}
+	if step, valid := helper.ValidateTOTP(user.TOTPSecret, code, time.Now()); valid {
+		used, useErr := ts.UserRepository.UseTOTPStep(ctx, user.ID, step)
+		if useErr != nil {
+			return useErr
+		}
+		if !used {
+			return helper.ErrUnauthorized
+		}
+		return nil
+	}
+
+	used, useErr := ts.UserRepository.UseRecoveryCode(ctx, user.ID, hashOneTimeCode(code))
+	if useErr != nil {
+		return fmt.Errorf("failed to check recovery code: %w", useErr)
+	}
+	if !used {
+		return helper.ErrUnauthorized
+	}
+	return nil
+}
+
+func hashOneTimeCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/meliocool/arkive/internal/helper"
+	"github.com/meliocool/arkive/internal/repository/users"
+	"strings"
+	"testing"
+	"time"
+)
+
+// twoFactorUserRepo keeps one user's TOTP state the way the users table
+// does; any other call panics on the nil embedded interface.
+type twoFactorUserRepo struct {
+	users.UserRepository
+	user          *users.User
+	lastStep      int64
+	recoveryCodes map[string]bool
+}
+
+func (r *twoFactorUserRepo) FindByID(ctx context.Context, userID uuid.UUID) (*users.User, error) {
+	if userID != r.user.ID {
+		return nil, fmt.Errorf("user not found")
+	}
+	copied := *r.user
+	return &copied, nil
+}
+
+func (r *twoFactorUserRepo) UpdateTOTP(ctx context.Context, userID uuid.UUID, secret string, enabled bool) error {
+	r.user.TOTPSecret, r.user.TOTPEnabled = secret, enabled
+	if !enabled {
+		r.lastStep = 0
+	}
+	return nil
+}
+
+func (r *twoFactorUserRepo) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	if r.lastStep >= step {
+		return false, nil
+	}
+	r.lastStep = step
+	return true, nil
+}
+
+func (r *twoFactorUserRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	r.recoveryCodes = map[string]bool{}
+	for _, codeHash := range codeHashes {
+		r.recoveryCodes[codeHash] = true
+	}
+	return nil
+}
+
+func (r *twoFactorUserRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	if !r.recoveryCodes[codeHash] {
+		return false, nil
+	}
+	delete(r.recoveryCodes, codeHash)
+	return true, nil
+}
+
+// totpAt computes the RFC 6238 code for secret at the given step, independent
+// of the helper package.
+func totpAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, decodeErr := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if decodeErr != nil {
+		t.Fatal(decodeErr)
+	}
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// enrolledTwoFactor enables two-factor authentication for a fresh user and
+// returns the time step whose code confirmed it.
+func enrolledTwoFactor(t *testing.T) (*TwoFactorService, *twoFactorUserRepo, []string, int64) {
+	t.Helper()
+	repo := &twoFactorUserRepo{user: &users.User{ID: uuid.New(), Email: "ana@example.com"}}
+	twoFactor := NewTwoFactorService(repo, &deferredTransactor{}, "Arkive")
+
+	enrollment, enrollErr := twoFactor.Enroll(context.Background(), repo.user.ID)
+	if enrollErr != nil {
+		t.Fatalf("Enroll: %v", enrollErr)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || !strings.Contains(enrollment.URI, "secret="+enrollment.Secret) {
+		t.Errorf("unexpected enrollment URI %q", enrollment.URI)
+	}
+
+	step := time.Now().Unix() / 30
+	codes, confirmErr := twoFactor.Confirm(context.Background(), repo.user.ID, totpAt(t, enrollment.Secret, step))
+	if confirmErr != nil {
+		t.Fatalf("Confirm: %v", confirmErr)
+	}
+	return twoFactor, repo, codes, step
+}
+
+func TestTwoFactorConfirmEnablesAndIssuesRecoveryCodes(t *testing.T) {
+	_, repo, codes, _ := enrolledTwoFactor(t)
+
+	if !repo.user.TOTPEnabled {
+		t.Error("two-factor authentication was not enabled")
+	}
+	if len(codes) != recoveryCodeCount || len(repo.recoveryCodes) != recoveryCodeCount {
+		t.Errorf("issued %d codes and stored %d, want %d", len(codes), len(repo.recoveryCodes), recoveryCodeCount)
+	}
+	for _, code := range codes {
+		if repo.recoveryCodes[code] {
+			t.Fatal("recovery codes are stored in plain text")
+		}
+	}
+}
+
+func TestTwoFactorVerifyRejectsReplayedCode(t *testing.T) {
+	twoFactor, repo, _, step := enrolledTwoFactor(t)
+	user, _ := repo.FindByID(context.Background(), repo.user.ID)
+
+	// The code used to confirm enrollment cannot sign in.
+	if verifyErr := twoFactor.Verify(context.Background(), user, totpAt(t, user.TOTPSecret, step)); !errors.Is(verifyErr, helper.ErrUnauthorized) {
+		t.Fatalf("Verify with the confirmation code = %v, want %v", verifyErr, helper.ErrUnauthorized)
+	}
+
+	next := totpAt(t, user.TOTPSecret, step+1)
+	if verifyErr := twoFactor.Verify(context.Background(), user, next); verifyErr != nil {
+		t.Fatalf("Verify with the next code: %v", verifyErr)
+	}
+	if verifyErr := twoFactor.Verify(context.Background(), user, next); !errors.Is(verifyErr, helper.ErrUnauthorized) {
+		t.Errorf("replayed code = %v, want %v", verifyErr, helper.ErrUnauthorized)
+	}
+	// Once a later step was accepted, earlier codes still inside the drift
+	// window are refused too.
+	if verifyErr := twoFactor.Verify(context.Background(), user, totpAt(t, user.TOTPSecret, step-1)); !errors.Is(verifyErr, helper.ErrUnauthorized) {
+		t.Errorf("earlier code = %v, want %v", verifyErr, helper.ErrUnauthorized)
+	}
+}
+
+func TestTwoFactorRecoveryCodesWorkOnce(t *testing.T) {
+	twoFactor, repo, codes, _ := enrolledTwoFactor(t)
+	user, _ := repo.FindByID(context.Background(), repo.user.ID)
+
+	// Codes are accepted regardless of case and the dash.
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if verifyErr := twoFactor.Verify(context.Background(), user, typed); verifyErr != nil {
+		t.Fatalf("Verify with a recovery code: %v", verifyErr)
+	}
+	if verifyErr := twoFactor.Verify(context.Background(), user, codes[0]); !errors.Is(verifyErr, helper.ErrUnauthorized) {
+		t.Errorf("reused recovery code = %v, want %v", verifyErr, helper.ErrUnauthorized)
+	}
+	if verifyErr := twoFactor.Verify(context.Background(), user, "not-a-code"); !errors.Is(verifyErr, helper.ErrUnauthorized) {
+		t.Errorf("unknown recovery code = %v, want %v", verifyErr, helper.ErrUnauthorized)
+	}
+}
+
+func TestTwoFactorDisableRequiresValidCode(t *testing.T) {
+	twoFactor, repo, codes, _ := enrolledTwoFactor(t)
+
+	if disableErr := twoFactor.Disable(context.Background(), repo.user.ID, "000000"); !errors.Is(disableErr, helper.ErrUnauthorized) {
+		t.Fatalf("Disable with a wrong code = %v, want %v", disableErr, helper.ErrUnauthorized)
+	}
+	if !repo.user.TOTPEnabled {
+		t.Fatal("a wrong code disabled two-factor authentication")
+	}
+
+	if disableErr := twoFactor.Disable(context.Background(), repo.user.ID, codes[1]); disableErr != nil {
+		t.Fatalf("Disable: %v", disableErr)
+	}
+	if repo.user.TOTPEnabled || repo.user.TOTPSecret != "" || len(repo.recoveryCodes) != 0 || repo.lastStep != 0 {
+		t.Errorf("two-factor state left behind: %+v, %d recovery codes, last step %d", repo.user, len(repo.recoveryCodes), repo.lastStep)
+	}
+}
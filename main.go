@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"github.com/meliocool/arkive/config"
 	"github.com/meliocool/arkive/internal/handler"
+	"github.com/meliocool/arkive/internal/logging"
+	"github.com/meliocool/arkive/internal/mail"
+	"github.com/meliocool/arkive/internal/metrics"
 	"github.com/meliocool/arkive/internal/middleware"
 	"github.com/meliocool/arkive/internal/repository/postgresql"
+	"github.com/meliocool/arkive/internal/repository/users"
 	"github.com/meliocool/arkive/internal/service"
+	"github.com/meliocool/arkive/internal/tracing"
+	"github.com/meliocool/arkive/templates"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func wrapRouterHandler(routerHandler httprouter.Handle) http.Handler {
@@ -18,6 +32,45 @@ func wrapRouterHandler(routerHandler httprouter.Handle) http.Handler {
 	})
 }
 
+// importBlocklist loads the hash list configured through BLOCKLIST_FILE;
+// entries that are already blocked are skipped.
+func importBlocklist(blocklistService *service.BlocklistService, path string, logger *slog.Logger) error {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return fmt.Errorf("failed to open blocklist file: %w", openErr)
+	}
+	defer file.Close()
+
+	added, skipped, importErr := blocklistService.Import(context.Background(), nil, file)
+	if importErr != nil {
+		return fmt.Errorf("failed to import blocklist file %s: %w", path, importErr)
+	}
+	logger.Info("imported blocklist", "path", path, "added", added, "already_present", skipped)
+	return nil
+}
+
+// newMailer picks the email transport configured through EMAIL_TRANSPORT.
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.EmailTransport {
+	case "sendgrid":
+		return mail.NewSendGridMailer(cfg.SendGridAPIKey), nil
+	case "memory":
+		return mail.NewMemoryOutbox(), nil
+	case "file":
+		return mail.NewFileOutbox(cfg.EmailOutboxDir)
+	default:
+		mailer := mail.NewSMTPMailer(cfg.ZohoHost, cfg.ZohoPort, cfg.ZohoUser, cfg.ZohoPassword)
+		if cfg.DKIMDomain != "" {
+			signer, signerErr := mail.LoadDKIMSigner(cfg.DKIMDomain, cfg.DKIMSelector, cfg.DKIMPrivateKeyPath)
+			if signerErr != nil {
+				return nil, signerErr
+			}
+			mailer.DKIM = signer
+		}
+		return mailer, nil
+	}
+}
+
 func main() {
 	cfg, cfgErr := config.LoadConfig()
 	if cfgErr != nil {
@@ -25,47 +78,243 @@ func main() {
 		return
 	}
 
+	logger, loggerErr := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if loggerErr != nil {
+		log.Fatal(loggerErr)
+		return
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, tracingErr := tracing.Setup(context.Background(), cfg.TracingEndpoint, cfg.TracingServiceName, cfg.TracingSampleRatio)
+	if tracingErr != nil {
+		logger.Error("failed to set up tracing", "error", tracingErr)
+		os.Exit(1)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if flushErr := shutdownTracing(flushCtx); flushErr != nil {
+			logger.Error("failed to flush traces", "error", flushErr)
+		}
+	}()
+
 	connString := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBName)
 
-	db, dbErr := postgresql.NewPostgresDB(connString)
+	db, dbErr := postgresql.NewPostgresDB(connString, logger)
 
 	if dbErr != nil {
-		log.Fatal(dbErr)
-		return
+		logger.Error("failed to connect to database", "error", dbErr)
+		os.Exit(1)
 	}
 
 	defer db.Close()
 
-	userRepository := postgresql.NewUserRepo(db)
-	emailService := service.NewEmailService(cfg.ZohoUser, cfg.ZohoPassword, cfg.ZohoHost, cfg.ZohoPort)
-	loginService := service.NewLoginService(userRepository, cfg.JwtSecret)
-	registrationService := service.NewRegistrationService(userRepository, emailService, cfg.JwtSecret)
-	userHandler := handler.NewUserHandler(registrationService, loginService)
+	appMetrics := metrics.New()
+	appMetrics.RegisterPool(db)
+
+	mailer, mailerErr := newMailer(cfg)
+	if mailerErr != nil {
+		logger.Error("failed to set up email transport", "error", mailerErr)
+		os.Exit(1)
+	}
+	logger.Info("sending email", "transport", cfg.EmailTransport)
+
+	userRepository := postgresql.NewUserRepo(db, logger)
+	transactor := postgresql.NewTransactor(db)
+	emailOutboxRepository := postgresql.NewEmailOutboxRepo(db)
+	emailOutboxService := service.NewEmailOutboxService(emailOutboxRepository, transactor, mailer, appMetrics, logger)
+	emailOutboxHandler := handler.NewEmailOutboxHandler(emailOutboxService)
+	templateRegistry, templateErr := service.NewTemplateRegistry(templates.FS)
+	if templateErr != nil {
+		logger.Error("failed to load email templates", "error", templateErr)
+		os.Exit(1)
+	}
+	emailTemplateHandler := handler.NewEmailTemplateHandler(templateRegistry)
+	notificationRepository := postgresql.NewNotificationRepo(db)
+	preferenceService := service.NewPreferenceService(notificationRepository, cfg.JwtSecret, cfg.PublicBaseURL)
+	unsubscribeHandler := handler.NewUnsubscribeHandler(preferenceService)
+	emailService := service.NewEmailService(emailOutboxService, templateRegistry, preferenceService, mail.Address{Name: cfg.EmailFromName, Email: cfg.EmailFrom})
+	sessionService := service.NewSessionService(userRepository)
+	twoFactorService := service.NewTwoFactorService(userRepository, transactor, cfg.TOTPIssuer)
+	eventBus := service.NewEventBus(appMetrics)
+	eventHandler := handler.NewEventHandler(eventBus)
+	notificationService := service.NewNotificationService(notificationRepository, userRepository, preferenceService, emailService, eventBus, logger)
+	notificationHandler := handler.NewNotificationHandler(notificationService, preferenceService)
+	loginService := service.NewLoginService(userRepository, twoFactorService, emailService, notificationService, cfg.JwtSecret, logger)
+	registrationService := service.NewRegistrationService(userRepository, emailService, transactor, cfg.JwtSecret)
+	userHandler := handler.NewUserHandler(registrationService, loginService, twoFactorService)
 	photoRepository := postgresql.NewPhotoRepo(db)
 	ipfsService := service.NewIpfsService(cfg.IPFSAPIKey, cfg.IPFSAPISecret)
-	photoService := service.NewPhotoService(photoRepository, userRepository, *ipfsService)
+	if cfg.IPFSGatewayURL != "" {
+		ipfsService.GatewayURL = cfg.IPFSGatewayURL
+	}
+	ipfsService.Metrics = appMetrics
+	blocklistRepository := postgresql.NewBlocklistRepo(db)
+	blocklistService := service.NewBlocklistService(blocklistRepository, transactor, ipfsService, logger)
+	blocklistHandler := handler.NewBlocklistHandler(blocklistService)
+	if cfg.BlocklistFile != "" {
+		if importErr := importBlocklist(blocklistService, cfg.BlocklistFile, logger); importErr != nil {
+			logger.Error("failed to import blocklist", "error", importErr)
+			os.Exit(1)
+		}
+	}
+	photoService := service.NewPhotoService(photoRepository, userRepository, *ipfsService, transactor, blocklistService, notificationService, eventBus, cfg.StorageQuotaBytes, appMetrics, logger)
 	photoHandler := handler.NewPhotoHandler(*photoService)
 	publicService := service.NewPublicService(photoRepository, userRepository)
 	publicHandler := handler.NewPublicHandler(publicService)
+	followRepository := postgresql.NewFollowRepo(db)
+	followService := service.NewFollowService(followRepository, userRepository, photoRepository)
+	followHandler := handler.NewFollowHandler(followService)
+	likeRepository := postgresql.NewLikeRepo(db)
+	likeService := service.NewLikeService(likeRepository, photoRepository, userRepository)
+	likeHandler := handler.NewLikeHandler(likeService)
+	commentRepository := postgresql.NewCommentRepo(db)
+	commentService := service.NewCommentService(commentRepository, photoRepository, userRepository)
+	commentHandler := handler.NewCommentHandler(commentService)
+	moderationRepository := postgresql.NewModerationRepo(db)
+	moderationService := service.NewModerationService(moderationRepository, photoRepository, userRepository, photoService, blocklistService, transactor)
+	moderationHandler := handler.NewModerationHandler(moderationService)
+	adminService := service.NewAdminService(userRepository, photoRepository, moderationRepository, photoService)
+	adminHandler := handler.NewAdminHandler(adminService)
+	deletionRepository := postgresql.NewAccountDeletionRepo(db)
+	dataExportRepository := postgresql.NewDataExportRepo(db)
+	accountDeletionService := service.NewAccountDeletionService(userRepository, photoRepository, deletionRepository, dataExportRepository, transactor, twoFactorService, ipfsService, emailService, logger)
+	dataExportService := service.NewDataExportService(dataExportRepository, userRepository, photoRepository, ipfsService, emailService, cfg.JwtSecret, cfg.PublicBaseURL, cfg.ExportDir, logger)
+	profileService := service.NewProfileService(userRepository, transactor, emailService, eventBus, logger)
+	accountHandler := handler.NewAccountHandler(accountDeletionService, dataExportService, profileService)
 
-	router := httprouter.New()
+	router := middleware.NewRouter()
 	router.GET("/health", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 		fmt.Fprint(writer, "Server is Up and Running!")
 	})
 	router.POST("/users/register", userHandler.RegisterUser)
 	router.POST("/users/verify", userHandler.VerifyUser)
 	router.POST("/users/login", userHandler.LoginUser)
-	router.POST("/photos", middleware.AuthMiddleware(photoHandler.UploadPhoto, cfg.JwtSecret))
-	router.GET("/photos", middleware.AuthMiddleware(photoHandler.ListPhotos, cfg.JwtSecret))
-	router.DELETE("/photos/:photoId", middleware.AuthMiddleware(photoHandler.DeletePhoto, cfg.JwtSecret))
-	router.POST("/photos/:photoId/profile", middleware.AuthMiddleware(photoHandler.SetProfilePicture, cfg.JwtSecret))
+	router.POST("/users/login/2fa", userHandler.LoginTwoFactor)
+	router.POST("/users/2fa/enroll", middleware.AuthMiddleware(userHandler.EnrollTwoFactor, cfg.JwtSecret, sessionService))
+	router.POST("/users/2fa/confirm", middleware.AuthMiddleware(userHandler.ConfirmTwoFactor, cfg.JwtSecret, sessionService))
+	router.POST("/users/2fa/disable", middleware.AuthMiddleware(userHandler.DisableTwoFactor, cfg.JwtSecret, sessionService))
+	if cfg.OIDCIssuerURL != "" {
+		oidcService := service.NewOIDCService(userRepository, loginService, cfg.OIDCProviderName, cfg.OIDCIssuerURL,
+			cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL, cfg.OIDCScopes, cfg.JwtSecret, logger)
+		oidcHandler := handler.NewOIDCHandler(oidcService)
+		router.GET("/auth/oidc/login", oidcHandler.Login)
+		router.GET("/auth/oidc/callback", oidcHandler.Callback)
+	}
+	router.POST("/photos", middleware.AuthMiddleware(photoHandler.UploadPhoto, cfg.JwtSecret, sessionService))
+	router.GET("/photos", middleware.AuthMiddleware(photoHandler.ListPhotos, cfg.JwtSecret, sessionService))
+	router.DELETE("/photos/:photoId", middleware.AuthMiddleware(photoHandler.DeletePhoto, cfg.JwtSecret, sessionService))
+	router.POST("/photos/:photoId/profile", middleware.AuthMiddleware(photoHandler.SetProfilePicture, cfg.JwtSecret, sessionService))
+	router.PATCH("/users/me", middleware.AuthMiddleware(accountHandler.UpdateProfile, cfg.JwtSecret, sessionService))
+	router.POST("/users/me/email", middleware.AuthMiddleware(accountHandler.ChangeEmail, cfg.JwtSecret, sessionService))
+	router.POST("/users/me/email/confirm", middleware.AuthMiddleware(accountHandler.ConfirmEmailChange, cfg.JwtSecret, sessionService))
+	router.DELETE("/users/me", middleware.AuthMiddleware(accountHandler.DeleteAccount, cfg.JwtSecret, sessionService))
+	router.POST("/users/me/export", middleware.AuthMiddleware(accountHandler.RequestExport, cfg.JwtSecret, sessionService))
+	router.GET("/exports/:exportId", accountHandler.DownloadExport)
+	router.POST("/photos/:photoId/like", middleware.AuthMiddleware(likeHandler.LikePhoto, cfg.JwtSecret, sessionService))
+	router.DELETE("/photos/:photoId/like", middleware.AuthMiddleware(likeHandler.UnlikePhoto, cfg.JwtSecret, sessionService))
+	router.PATCH("/photos/:photoId", middleware.AuthMiddleware(commentHandler.UpdatePhoto, cfg.JwtSecret, sessionService))
+	router.POST("/photos/:photoId/report", middleware.AuthMiddleware(moderationHandler.ReportPhoto, cfg.JwtSecret, sessionService))
+	router.GET("/photos/:photoId/comments", commentHandler.ListComments)
+	router.POST("/photos/:photoId/comments", middleware.AuthMiddleware(commentHandler.CreateComment, cfg.JwtSecret, sessionService))
+	router.GET("/photos/:photoId/comments/hidden", middleware.AuthMiddleware(commentHandler.ListHiddenComments, cfg.JwtSecret, sessionService))
+	router.PATCH("/comments/:commentId", middleware.AuthMiddleware(commentHandler.EditComment, cfg.JwtSecret, sessionService))
+	router.DELETE("/comments/:commentId", middleware.AuthMiddleware(commentHandler.DeleteComment, cfg.JwtSecret, sessionService))
+	router.POST("/comments/:commentId/hide", middleware.AuthMiddleware(commentHandler.HideComment, cfg.JwtSecret, sessionService))
+	router.DELETE("/comments/:commentId/hide", middleware.AuthMiddleware(commentHandler.UnhideComment, cfg.JwtSecret, sessionService))
 	router.GET("/public/photos", publicHandler.ListAllPublicPhotos)
 	router.GET("/users/:userId", publicHandler.ViewUserProfile)
+	router.GET("/users/:userId/usage", middleware.AuthMiddleware(photoHandler.GetUsage, cfg.JwtSecret, sessionService))
+	router.POST("/follows/:userId", middleware.AuthMiddleware(followHandler.Follow, cfg.JwtSecret, sessionService))
+	router.DELETE("/follows/:userId", middleware.AuthMiddleware(followHandler.Unfollow, cfg.JwtSecret, sessionService))
+	router.GET("/users/:userId/followers", followHandler.ListFollowers)
+	router.GET("/users/:userId/following", followHandler.ListFollowing)
+	router.GET("/users/:userId/favorites", middleware.AuthMiddleware(likeHandler.ListFavorites, cfg.JwtSecret, sessionService))
+	router.GET("/feed", middleware.AuthMiddleware(followHandler.Feed, cfg.JwtSecret, sessionService))
+	router.GET("/events", middleware.AuthMiddleware(eventHandler.Stream, cfg.JwtSecret, sessionService))
+	router.GET("/notifications", middleware.AuthMiddleware(notificationHandler.ListNotifications, cfg.JwtSecret, sessionService))
+	router.POST("/notifications/read", middleware.AuthMiddleware(notificationHandler.MarkRead, cfg.JwtSecret, sessionService))
+	router.GET("/notifications/preferences", middleware.AuthMiddleware(notificationHandler.GetPreferences, cfg.JwtSecret, sessionService))
+	router.PUT("/notifications/preferences", middleware.AuthMiddleware(notificationHandler.UpdatePreferences, cfg.JwtSecret, sessionService))
+	router.GET("/unsubscribe/:token", unsubscribeHandler.ConfirmUnsubscribe)
+	router.POST("/unsubscribe/:token", unsubscribeHandler.Unsubscribe)
+	router.GET("/u/:username", publicHandler.ViewUserProfileByUsername)
+	router.GET("/admin/users", middleware.AuthMiddleware(middleware.RequireRole(adminHandler.ListUsers, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.POST("/admin/users/:userId/suspend", middleware.AuthMiddleware(middleware.RequireRole(adminHandler.SuspendUser, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.POST("/admin/users/:userId/unsuspend", middleware.AuthMiddleware(middleware.RequireRole(adminHandler.UnsuspendUser, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.PUT("/admin/users/:userId/role", middleware.AuthMiddleware(middleware.RequireRole(adminHandler.SetRole, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.PUT("/admin/users/:userId/quota", middleware.AuthMiddleware(middleware.RequireRole(adminHandler.SetStorageQuota, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.GET("/admin/reports", middleware.AuthMiddleware(middleware.RequireRole(moderationHandler.ListQueue, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.GET("/admin/reports/:photoId", middleware.AuthMiddleware(middleware.RequireRole(moderationHandler.ListPhotoReports, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.POST("/admin/photos/:photoId/moderate", middleware.AuthMiddleware(middleware.RequireRole(moderationHandler.ModeratePhoto, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.GET("/admin/moderation/log", middleware.AuthMiddleware(middleware.RequireRole(moderationHandler.AuditLog, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.GET("/admin/blocklist", middleware.AuthMiddleware(middleware.RequireRole(blocklistHandler.ListBlockedHashes, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.POST("/admin/blocklist", middleware.AuthMiddleware(middleware.RequireRole(blocklistHandler.AddBlockedHash, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.POST("/admin/blocklist/import", middleware.AuthMiddleware(middleware.RequireRole(blocklistHandler.ImportBlocklist, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.DELETE("/admin/blocklist/:hashId", middleware.AuthMiddleware(middleware.RequireRole(blocklistHandler.RemoveBlockedHash, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.GET("/admin/blocklist/attempts", middleware.AuthMiddleware(middleware.RequireRole(blocklistHandler.ListBlockedUploads, users.RoleModerator), cfg.JwtSecret, sessionService))
+	router.DELETE("/admin/photos/:photoId", middleware.AuthMiddleware(middleware.RequireRole(adminHandler.ForceDeletePhoto, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.GET("/admin/emails/dead", middleware.AuthMiddleware(middleware.RequireRole(emailOutboxHandler.ListDeadLetters, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.GET("/admin/emails/templates", middleware.AuthMiddleware(middleware.RequireRole(emailTemplateHandler.ListTemplates, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.GET("/admin/emails/templates/:name", middleware.AuthMiddleware(middleware.RequireRole(emailTemplateHandler.PreviewTemplate, users.RoleAdmin), cfg.JwtSecret, sessionService))
+	router.POST("/admin/emails/:emailId/retry", middleware.AuthMiddleware(middleware.RequireRole(emailOutboxHandler.RetryEmail, users.RoleAdmin), cfg.JwtSecret, sessionService))
 
 	server := http.Server{
 		Addr:    ":8080",
-		Handler: router,
+		Handler: middleware.ClientIP(middleware.RequestID(middleware.Tracing(middleware.AccessLog(middleware.Metrics(router, appMetrics), logger))), cfg.TrustedProxies),
 	}
+	// Shutdown does not interrupt open event streams, so end them explicitly.
+	server.RegisterOnShutdown(eventBus.Close)
 
-	server.ListenAndServe()
+	// Metrics are served on their own listener so the port can be kept off
+	// the public network instead of sharing the API's.
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", appMetrics.Handler())
+	metricsServer := http.Server{
+		Addr:    cfg.MetricsAddr,
+		Handler: metricsMux,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	workers.Add(3)
+	go func() {
+		defer workers.Done()
+		emailOutboxService.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		accountDeletionService.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		dataExportService.Run(ctx)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+			logger.Error("server shutdown", "error", shutdownErr)
+		}
+		if shutdownErr := metricsServer.Shutdown(shutdownCtx); shutdownErr != nil {
+			logger.Error("metrics server shutdown", "error", shutdownErr)
+		}
+	}()
+
+	go func() {
+		if serveErr := metricsServer.ListenAndServe(); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			logger.Error("metrics server stopped", "error", serveErr)
+			stop()
+		}
+	}()
+
+	if serveErr := server.ListenAndServe(); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		logger.Error("server stopped", "error", serveErr)
+		stop()
+	}
+	workers.Wait()
 }
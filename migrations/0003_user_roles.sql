@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role         TEXT NOT NULL DEFAULT 'user'
+        CHECK (role IN ('user', 'moderator', 'admin')),
+    ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMPTZ;
+
+-- Promote the first administrator by hand, e.g.:
+-- UPDATE users SET role = 'admin' WHERE email = 'you@example.com';
@@ -0,0 +1,24 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS token_version         INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMPTZ;
+
+-- user_id deliberately has no foreign key: the job outlives the user row so
+-- the confirmation email can still be sent after the account is gone.
+CREATE TABLE IF NOT EXISTS account_deletion_jobs
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    user_id         UUID        NOT NULL UNIQUE,
+    email           TEXT        NOT NULL,
+    username        TEXT        NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending',
+    attempts        INT         NOT NULL DEFAULT 0,
+    unpinned_cids   TEXT[]      NOT NULL DEFAULT '{}',
+    last_error      TEXT        NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS account_deletion_jobs_due_idx
+    ON account_deletion_jobs (next_attempt_at) WHERE status = 'pending';
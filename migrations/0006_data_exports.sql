@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS data_exports
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    user_id         UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status          TEXT        NOT NULL DEFAULT 'pending',
+    attempts        INT         NOT NULL DEFAULT 0,
+    file_path       TEXT        NOT NULL DEFAULT '',
+    size_bytes      BIGINT      NOT NULL DEFAULT 0,
+    last_error      TEXT        NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at    TIMESTAMPTZ,
+    expires_at      TIMESTAMPTZ
+);
+
+-- At most one export per user may be in progress at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS data_exports_one_pending_idx
+    ON data_exports (user_id) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS data_exports_due_idx
+    ON data_exports (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS data_exports_expires_idx
+    ON data_exports (expires_at) WHERE status = 'ready';
@@ -0,0 +1,12 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS display_name            TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS bio                     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS website                 TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS pending_email           TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS email_change_code_hash  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS email_change_expires_at TIMESTAMPTZ;
+
+-- Usernames are looked up case-insensitively, so they must also be unique
+-- case-insensitively.
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_idx ON users (LOWER(username));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (LOWER(email));
@@ -0,0 +1,8 @@
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- NULL means the user gets the server-wide default quota (STORAGE_QUOTA_BYTES).
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS storage_quota_bytes BIGINT;
+
+CREATE INDEX IF NOT EXISTS photos_user_id_idx ON photos (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS follows
+(
+    follower_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    followee_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followee_idx ON follows (followee_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS photos_user_created_idx ON photos (user_id, created_at DESC);
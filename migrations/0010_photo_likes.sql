@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS photo_likes
+(
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    photo_id   UUID        NOT NULL REFERENCES photos (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT photo_likes_user_photo_key UNIQUE (user_id, photo_id)
+);
+
+CREATE INDEX IF NOT EXISTS photo_likes_photo_created_idx ON photo_likes (photo_id, created_at);
+CREATE INDEX IF NOT EXISTS photo_likes_created_idx ON photo_likes (created_at);
+
+-- like_count is kept in step with photo_likes by the like/unlike statements so
+-- photo listings do not have to aggregate.
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS like_count INT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS comments_disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Replies are limited to one level: parent_id always points at a top-level
+-- comment of the same photo. That rule is enforced by the service.
+CREATE TABLE IF NOT EXISTS photo_comments
+(
+    id         UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    photo_id   UUID        NOT NULL REFERENCES photos (id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    parent_id  UUID REFERENCES photo_comments (id) ON DELETE CASCADE,
+    body       TEXT        NOT NULL,
+    hidden_at  TIMESTAMPTZ,
+    edited_at  TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS photo_comments_photo_idx ON photo_comments (photo_id, created_at) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS photo_comments_parent_idx ON photo_comments (parent_id, created_at);
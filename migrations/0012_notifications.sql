@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id         UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type       TEXT        NOT NULL,
+    title      TEXT        NOT NULL,
+    body       TEXT        NOT NULL,
+    data       JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    read_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- Only explicit choices are stored; a missing row means the default for the
+-- notification type applies.
+CREATE TABLE IF NOT EXISTS notification_preferences
+(
+    user_id       UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type          TEXT        NOT NULL,
+    email_enabled BOOLEAN     NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, type)
+);
@@ -0,0 +1,35 @@
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS photo_reports
+(
+    id          UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    photo_id    UUID        NOT NULL REFERENCES photos (id) ON DELETE CASCADE,
+    reporter_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reason      TEXT        NOT NULL,
+    details     TEXT        NOT NULL DEFAULT '',
+    status      TEXT        NOT NULL DEFAULT 'open',
+    resolved_by UUID REFERENCES users (id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A user can have one open report per photo; they may report it again once
+-- a moderator has dealt with the earlier one.
+CREATE UNIQUE INDEX IF NOT EXISTS photo_reports_open_key ON photo_reports (photo_id, reporter_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS photo_reports_queue_idx ON photo_reports (photo_id, created_at) WHERE status = 'open';
+
+-- The audit trail outlives the photos and accounts it refers to, so those
+-- columns are deliberately not foreign keys.
+CREATE TABLE IF NOT EXISTS moderation_actions
+(
+    id             UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    moderator_id   UUID        NOT NULL,
+    action         TEXT        NOT NULL,
+    photo_id       UUID,
+    target_user_id UUID,
+    note           TEXT        NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS moderation_actions_created_idx ON moderation_actions (created_at DESC);
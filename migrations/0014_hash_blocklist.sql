@@ -0,0 +1,25 @@
+-- kind is 'sha256' (exact file hash) or 'phash' (64-bit difference hash of the
+-- decoded image); both are stored as lowercase hex.
+CREATE TABLE IF NOT EXISTS blocked_hashes
+(
+    id         UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    kind       TEXT        NOT NULL,
+    value      TEXT        NOT NULL,
+    note       TEXT        NOT NULL DEFAULT '',
+    added_by   UUID REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT blocked_hashes_kind_value_key UNIQUE (kind, value)
+);
+
+CREATE TABLE IF NOT EXISTS blocked_upload_attempts
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    user_id         UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    blocked_hash_id UUID REFERENCES blocked_hashes (id) ON DELETE SET NULL,
+    sha256          TEXT        NOT NULL,
+    phash           TEXT        NOT NULL DEFAULT '',
+    filename        TEXT        NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS blocked_upload_attempts_created_idx ON blocked_upload_attempts (created_at DESC);
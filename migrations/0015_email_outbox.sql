@@ -0,0 +1,26 @@
+-- Rendered emails waiting for delivery. Rows are written in the same
+-- transaction as the change that triggers them, so an email is never lost
+-- when the mail provider is down and never sent for a rolled back change.
+CREATE TABLE IF NOT EXISTS email_outbox
+(
+    id              UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    to_email        TEXT        NOT NULL,
+    to_name         TEXT        NOT NULL DEFAULT '',
+    from_email      TEXT        NOT NULL,
+    from_name       TEXT        NOT NULL DEFAULT '',
+    subject         TEXT        NOT NULL,
+    text_body       TEXT        NOT NULL,
+    html_body       TEXT        NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending',
+    attempts        INT         NOT NULL DEFAULT 0,
+    last_error      TEXT        NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_due_idx
+    ON email_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS email_outbox_dead_idx
+    ON email_outbox (updated_at DESC) WHERE status = 'dead';
@@ -0,0 +1,8 @@
+-- Empty means the default (English) email templates.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
+
+-- The deletion job outlives the user row, so it keeps the locale for the
+-- confirmation email.
+ALTER TABLE account_deletion_jobs
+    ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
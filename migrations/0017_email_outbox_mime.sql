@@ -0,0 +1,4 @@
+ALTER TABLE email_outbox
+    ADD COLUMN IF NOT EXISTS list_unsubscribe      TEXT[]  NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS one_click_unsubscribe BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS inline_images         JSONB   NOT NULL DEFAULT '[]'::jsonb;
@@ -0,0 +1,24 @@
+-- Preferences per notification category and delivery channel. Only explicit
+-- choices are stored; a missing row means the category's default applies.
+CREATE TABLE IF NOT EXISTS notification_channel_preferences
+(
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    category   TEXT        NOT NULL,
+    channel    TEXT        NOT NULL,
+    enabled    BOOLEAN     NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, category, channel)
+);
+
+-- Carry over the per-type email choices from 0012_notifications.sql.
+INSERT INTO notification_channel_preferences (user_id, category, channel, enabled, updated_at)
+SELECT user_id,
+       CASE WHEN type LIKE 'security.%' THEN 'security' ELSE 'photos' END,
+       'email',
+       bool_or(email_enabled),
+       max(updated_at)
+FROM notification_preferences
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS notification_preferences;
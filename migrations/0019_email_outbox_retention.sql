@@ -0,0 +1,9 @@
+-- queued_at starts the delivery deadline; it is reset when a dead letter is
+-- requeued so the email gets a full window again.
+ALTER TABLE email_outbox
+    ADD COLUMN IF NOT EXISTS queued_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Sent emails carry verification codes and download links, so they are
+-- swept shortly after delivery.
+CREATE INDEX IF NOT EXISTS email_outbox_sent_idx
+    ON email_outbox (sent_at) WHERE status = 'sent';
@@ -0,0 +1,26 @@
+-- like_count was kept in step by the like/unlike statements only, so likes
+-- removed by the users foreign key cascade left it too high. A trigger covers
+-- every way a like can disappear.
+CREATE OR REPLACE FUNCTION photo_likes_count() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE photos SET like_count = like_count + 1 WHERE id = NEW.photo_id;
+    ELSE
+        UPDATE photos SET like_count = GREATEST(like_count - 1, 0) WHERE id = OLD.photo_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS photo_likes_count_trigger ON photo_likes;
+CREATE TRIGGER photo_likes_count_trigger
+    AFTER INSERT OR DELETE
+    ON photo_likes
+    FOR EACH ROW
+EXECUTE FUNCTION photo_likes_count();
+
+-- Repair counts left behind by accounts deleted before the trigger existed.
+UPDATE photos p
+SET like_count = (SELECT COUNT(*) FROM photo_likes l WHERE l.photo_id = p.id)
+WHERE like_count <> (SELECT COUNT(*) FROM photo_likes l WHERE l.photo_id = p.id);
@@ -0,0 +1,4 @@
+-- Wrong confirmation codes count against the pending email change, which is
+-- cancelled once too many have been tried.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_change_attempts INT NOT NULL DEFAULT 0;
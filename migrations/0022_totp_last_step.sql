@@ -0,0 +1,4 @@
+-- The time step of the last accepted TOTP code. Codes for that step or an
+-- earlier one are rejected, so a code cannot be replayed while it is valid.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+// Package templates embeds the email templates into the binary. Every email
+// has an HTML body (name.html) and a plain text body (name.txt) that also
+// defines its "subject"; translations are named name.<locale>.html and
+// name.<locale>.txt.
+package templates
+
+import "embed"
+
+//go:embed *.html *.txt
+var FS embed.FS